@@ -67,6 +67,9 @@ func main() {
 		routes.GlobalHub.Stop()
 		logger.L().Info("WebSocket hub stopped")
 	}
+	for _, w := range routes.GlobalWorkers {
+		w.Stop()
+	}
 
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
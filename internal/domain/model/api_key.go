@@ -0,0 +1,21 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// APIKey is a bot credential. Only the hash of the key is stored; Prefix is
+// kept so owners can tell keys apart.
+type APIKey struct {
+	ID         string       `json:"id"`
+	BotID      string       `json:"bot_id"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	KeyHash    string       `json:"-"`
+	Scopes     []string     `json:"scopes"`
+	CreatedBy  string       `json:"-"`
+	CreatedAt  time.Time    `json:"created_at"`
+	LastUsedAt sql.NullTime `json:"-"`
+	RevokedAt  sql.NullTime `json:"-"`
+}
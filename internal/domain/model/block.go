@@ -0,0 +1,21 @@
+package model
+
+import "time"
+
+// BlockDTO is a user the owner has blocked. Reason is private to the owner.
+type BlockDTO struct {
+	BlockedID          string    `json:"blocked_id"`
+	BlockedName        string    `json:"blocked_name"`
+	BlockedDisplayName string    `json:"blocked_display_name"`
+	BlockedAvatarURL   string    `json:"blocked_avatar_url"`
+	Reason             string    `json:"reason"`
+	CreatedAt          time.Time `json:"created_at"`
+}
+
+type BlocksDTO []*BlockDTO
+
+// BlockCursor is the position after which the next page of blocks starts.
+type BlockCursor struct {
+	CreatedAt time.Time
+	BlockedID string
+}
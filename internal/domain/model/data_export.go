@@ -0,0 +1,41 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+type ExportStatus string
+
+const (
+	ExportPending ExportStatus = "pending"
+	ExportRunning ExportStatus = "running"
+	ExportReady   ExportStatus = "ready"
+	ExportFailed  ExportStatus = "failed"
+	ExportExpired ExportStatus = "expired" // archive deleted after the retention period
+)
+
+// DataExport is a personal data export job and, once ready, its archive.
+type DataExport struct {
+	ID          string
+	UserID      string
+	Status      ExportStatus
+	FilePath    string
+	SizeBytes   int64
+	CreatedAt   time.Time
+	CompletedAt sql.NullTime
+	ExpiresAt   sql.NullTime // when the archive is deleted
+}
+
+// DataExportDTO is what the owner sees. DownloadURL is only set on ready
+// exports and works until LinkExpiresAt.
+type DataExportDTO struct {
+	ID            string       `json:"id"`
+	Status        ExportStatus `json:"status"`
+	SizeBytes     int64        `json:"size_bytes,omitempty"`
+	CreatedAt     time.Time    `json:"created_at"`
+	CompletedAt   *time.Time   `json:"completed_at,omitempty"`
+	ExpiresAt     *time.Time   `json:"expires_at,omitempty"`
+	DownloadURL   string       `json:"download_url,omitempty"`
+	LinkExpiresAt *time.Time   `json:"link_expires_at,omitempty"`
+}
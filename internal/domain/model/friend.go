@@ -23,3 +23,12 @@ type FriendDTO struct {
 }
 
 type FriendsDTO []*FriendDTO
+
+// FriendSuggestionDTO is a friend of the user's friends, with how many
+// friends they have in common.
+type FriendSuggestionDTO struct {
+	UserSummaryDTO
+	MutualFriends int `json:"mutual_friends"`
+}
+
+type FriendSuggestionsDTO []*FriendSuggestionDTO
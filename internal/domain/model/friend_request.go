@@ -22,6 +22,7 @@ type FriendRequest struct {
 	Status     FriendRequestStatus
 	CreatedAt  time.Time    `json:"created_at,omitempty" db:"created_at" `
 	ModifiedAt time.Time    `json:"modified_at,omitempty" db:"modified_at" `
+	ExpiresAt  time.Time    `json:"expires_at,omitempty" db:"expires_at" ` // while pending
 	DeletedAt  sql.NullTime `json:"deleted_at,omitempty" db:"deleted_at" `
 }
 
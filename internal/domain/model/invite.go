@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+// Registration modes (registration.mode)
+const (
+	RegistrationOpen       = "open"
+	RegistrationInviteOnly = "invite_only"
+	RegistrationClosed     = "closed"
+)
+
+// Invite is a sign-up invite code. Only the hash of the code is stored;
+// Prefix is kept so creators can tell codes apart.
+type Invite struct {
+	ID        string    `json:"id"`
+	Prefix    string    `json:"prefix"`
+	CodeHash  string    `json:"-"`
+	CreatedBy string    `json:"created_by,omitempty"` // empty once the creator is gone
+	Email     string    `json:"email,omitempty"`      // only this address may redeem it
+	MaxUses   int       `json:"max_uses"`
+	Uses      int       `json:"uses"`
+	ExpiresAt time.Time `json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -9,6 +9,7 @@ import (
 type Message struct {
 	ID         string       `json:"id" db:"id"`
 	SenderID   string       `json:"sender_id" db:"sender_id"`
+	SenderName string       `json:"sender_name,omitempty" db:"sender_name"`
 	ReceiverID string       `json:"receiver_id" db:"receiver_id"`
 	Body       string       `json:"content" db:"body"`
 	IsGroup    bool         `json:"is_group" db:"is_group"`
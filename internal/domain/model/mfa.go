@@ -0,0 +1,19 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// DAO -> TOTP enrollment of a user, secret encrypted at rest
+type UserMFA struct {
+	UserID       string       `db:"user_id"`
+	SecretEnc    string       `db:"secret_enc"`
+	EnabledAt    sql.NullTime `db:"enabled_at"`
+	LastUsedStep int64        `db:"last_used_step"`
+	CreatedAt    time.Time    `db:"created_at"`
+}
+
+func (m *UserMFA) Enabled() bool {
+	return m != nil && m.EnabledAt.Valid
+}
@@ -0,0 +1,32 @@
+package model
+
+// Audience says who a privacy setting lets in.
+type Audience string
+
+const (
+	AudienceEveryone         Audience = "everyone"
+	AudienceFriendsOfFriends Audience = "friends_of_friends" // includes friends
+	AudienceFriends          Audience = "friends"
+	AudienceNobody           Audience = "nobody"
+)
+
+// PrivacySettings are the user's choices about who can find and reach them.
+type PrivacySettings struct {
+	// Discoverability: who finds the user in search
+	Discoverability Audience `json:"discoverability"`
+	// EmailSearchable lets search match the user's full email address
+	EmailSearchable bool `json:"email_searchable"`
+	// FriendRequests: who may send the user a friend request
+	FriendRequests Audience `json:"friend_requests"`
+	// Presence: who sees the user go online/offline and their last seen time
+	Presence Audience `json:"presence"`
+}
+
+// Valid reports whether every setting uses an audience it supports.
+func (p *PrivacySettings) Valid() bool {
+	reach := func(a Audience) bool {
+		return a == AudienceEveryone || a == AudienceFriendsOfFriends || a == AudienceNobody
+	}
+	return reach(p.Discoverability) && reach(p.FriendRequests) &&
+		(p.Presence == AudienceEveryone || p.Presence == AudienceFriends || p.Presence == AudienceNobody)
+}
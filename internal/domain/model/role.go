@@ -0,0 +1,55 @@
+package model
+
+type Role string
+
+const (
+	RoleUser      Role = "user"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+
+	// RoleBot marks service accounts. They sign in with API keys only and
+	// their permissions are the scopes of the key in use.
+	RoleBot Role = "bot"
+)
+
+type Permission string
+
+const (
+	PermUsersRead        Permission = "users:read"
+	PermUsersManageRoles Permission = "users:manage_roles"
+	PermBotsManage       Permission = "bots:manage"
+	PermInvitesManage    Permission = "invites:manage"
+	PermMessagesRead     Permission = "messages:read"
+	PermMessagesWrite    Permission = "messages:write"
+)
+
+// rolePermissions is the fixed role -> permission mapping
+var rolePermissions = map[Role][]Permission{
+	RoleUser:      {PermMessagesRead, PermMessagesWrite},
+	RoleModerator: {PermMessagesRead, PermMessagesWrite, PermUsersRead},
+	RoleAdmin:     {PermMessagesRead, PermMessagesWrite, PermUsersRead, PermUsersManageRoles, PermBotsManage, PermInvitesManage},
+}
+
+// botScopes are the permissions an API key can be granted
+var botScopes = []Permission{PermMessagesRead, PermMessagesWrite}
+
+// ValidRole reports whether role is one of the roles a human account can have.
+func ValidRole(role string) bool {
+	_, ok := rolePermissions[Role(role)]
+	return ok
+}
+
+// PermissionsFor returns the permissions granted to role; unknown roles get none.
+func PermissionsFor(role string) []Permission {
+	return rolePermissions[Role(role)]
+}
+
+// ValidBotScope reports whether an API key may be granted scope.
+func ValidBotScope(scope string) bool {
+	for _, s := range botScopes {
+		if string(s) == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,22 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+type SecurityEventType string
+
+const (
+	SecurityEventLoginLockout SecurityEventType = "login_lockout"
+)
+
+type SecurityEvent struct {
+	ID        string            `json:"id"`
+	UserID    sql.NullString    `json:"-"`
+	Type      SecurityEventType `json:"type"`
+	Subject   string            `json:"subject"`
+	IP        string            `json:"ip"`
+	UserAgent string            `json:"user_agent"`
+	CreatedAt time.Time         `json:"created_at"`
+}
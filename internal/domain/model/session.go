@@ -0,0 +1,41 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+// DAO -> one login (refresh token family)
+type Session struct {
+	ID         string       `json:"id" db:"id"`
+	UserID     string       `json:"user_id" db:"user_id"`
+	CreatedAt  time.Time    `json:"created_at" db:"created_at"`
+	LastSeenAt time.Time    `json:"last_seen_at" db:"last_seen_at"`
+	ExpiresAt  time.Time    `json:"expires_at" db:"expires_at"`
+	RevokedAt  sql.NullTime `json:"revoked_at,omitempty" db:"revoked_at"`
+	DeviceName string       `json:"device_name" db:"device_name"`
+	UserAgent  string       `json:"user_agent" db:"user_agent"`
+	IP         string       `json:"ip" db:"ip"`
+}
+
+// DTO -> an active session as listed to its owner
+type SessionDTO struct {
+	ID         string    `json:"id"`
+	DeviceName string    `json:"device_name"`
+	UserAgent  string    `json:"user_agent"`
+	IP         string    `json:"ip"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+	Current    bool      `json:"current"`
+}
+
+// DAO -> a single issued refresh token, stored hashed
+type RefreshToken struct {
+	ID        string       `db:"id"`
+	SessionID string       `db:"session_id"`
+	TokenHash string       `db:"token_hash"`
+	CreatedAt time.Time    `db:"created_at"`
+	ExpiresAt time.Time    `db:"expires_at"`
+	UsedAt    sql.NullTime `db:"used_at"`
+}
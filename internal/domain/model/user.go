@@ -12,9 +12,51 @@ type User struct {
 	Email        string       `db:"email" json:"email"`     // email address
 	PasswordHash string       `db:"password_hash" json:"-"` // hashed password
 	Role         string       `db:"role" json:"role"`       // user / admin
-	CreatedAt    time.Time    `json:"created_at,omitempty" db:"created_at" `
-	ModifiedAt   time.Time    `json:"modified_at,omitempty" db:"modified_at" `
-	DeletedAt    sql.NullTime `json:"deleted_at,omitempty" db:"deleted_at" `
+	VerifiedAt   sql.NullTime `db:"verified_at" json:"verified_at,omitempty"`
+	// UsernameChangedAt is the last handle change, for the rename cooldown
+	UsernameChangedAt sql.NullTime `db:"username_changed_at" json:"-"`
+	Profile
+	Privacy    PrivacySettings `json:"-"`
+	LastSeenAt sql.NullTime    `db:"last_seen_at" json:"-"` // last WebSocket disconnect
+	InvitedBy  string          `db:"invited_by" json:"-"`   // empty unless signed up with an invite
+	CreatedAt  time.Time       `json:"created_at,omitempty" db:"created_at" `
+	ModifiedAt time.Time       `json:"modified_at,omitempty" db:"modified_at" `
+	DeletedAt  sql.NullTime    `json:"deleted_at,omitempty" db:"deleted_at" `
+}
+
+// Profile holds the self-managed, publicly visible part of a user
+type Profile struct {
+	DisplayName string `db:"display_name" json:"display_name"`
+	Bio         string `db:"bio" json:"bio"`
+	AvatarURL   string `db:"avatar_url" json:"avatar_url"`
+	StatusText  string `db:"status_text" json:"status_text"`
+	StatusEmoji string `db:"status_emoji" json:"status_emoji"`
+	Timezone    string `db:"timezone" json:"timezone"`
+}
+
+// ProfileDTO is what other users see
+type ProfileDTO struct {
+	ID       string `json:"id"`
+	Username string `json:"username"`
+	Profile
+	// LastSeenAt is only set for viewers the presence setting allows
+	LastSeenAt *time.Time `json:"last_seen_at,omitempty"`
+}
+
+// MeDTO is the owner's view of their account
+type MeDTO struct {
+	ProfileDTO
+	Email         string `json:"email"`
+	Role          string `json:"role"`
+	EmailVerified bool   `json:"email_verified"`
+}
+
+// UserSummaryDTO is the little needed to show another user in a list
+type UserSummaryDTO struct {
+	ID          string `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"display_name"`
+	AvatarURL   string `json:"avatar_url"`
 }
 
 type UserDTO struct {
@@ -22,6 +64,8 @@ type UserDTO struct {
 	Username string `db:"username" json:"username"`
 	Email    string `db:"email" json:"email"`
 	Role     string `db:"role" json:"role"`
+	// Blocked is set in search results when the searcher blocked this user
+	Blocked bool `json:"blocked,omitempty"`
 }
 
 type UsersDTO []*UserDTO
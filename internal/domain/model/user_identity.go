@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// UserIdentity links an account at an external OpenID provider to a user.
+type UserIdentity struct {
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	Provider    string    `json:"provider"`
+	Subject     string    `json:"-"`
+	Email       string    `json:"email"`
+	CreatedAt   time.Time `json:"created_at"`
+	LastLoginAt time.Time `json:"last_login_at"`
+}
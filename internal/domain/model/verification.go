@@ -0,0 +1,26 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+type VerificationPurpose string
+
+const (
+	PurposeEmailVerification VerificationPurpose = "email_verification"
+	PurposePasswordReset     VerificationPurpose = "password_reset"
+	PurposeReauthentication  VerificationPurpose = "reauthentication" // SSO accounts without a password
+)
+
+// DAO -> emailed one-time code, stored hashed
+type VerificationCode struct {
+	ID        string              `db:"id"`
+	UserID    string              `db:"user_id"`
+	Purpose   VerificationPurpose `db:"purpose"`
+	CodeHash  string              `db:"code_hash"`
+	Attempts  int                 `db:"attempts"`
+	ExpiresAt time.Time           `db:"expires_at"`
+	UsedAt    sql.NullTime        `db:"used_at"`
+	CreatedAt time.Time           `db:"created_at"`
+}
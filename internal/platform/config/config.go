@@ -16,10 +16,25 @@ type AppConfig struct {
 	Server   Server         `mapstructure:"server"`
 	Redis    RedisConfig    `mapstructure:"redis"`
 	CORS     CORS           `mapstructure:"CORS"`
+	Mail     MailConfig     `mapstructure:"mail"`
+	MFA      MFAConfig      `mapstructure:"mfa"`
+	Account  AccountConfig  `mapstructure:"account"`
+	Lockout  LockoutConfig  `mapstructure:"lockout"`
+	OIDC     OIDCConfig     `mapstructure:"oidc"`
+	Export   ExportConfig   `mapstructure:"export"`
+
+	Registration RegistrationConfig `mapstructure:"registration"`
+	Password     PasswordConfig     `mapstructure:"password"`
+
+	FriendRequests FriendRequestConfig `mapstructure:"friend_requests"`
+	Friends        FriendConfig        `mapstructure:"friends"`
 }
 type Server struct {
 	Host string `mapstructure:"host"`
 	Port int    `mapstructure:"port"`
+	// TrustedProxyHops is how many reverse proxies append to X-Forwarded-For
+	// in front of the server; 0 ignores the header.
+	TrustedProxyHops int `mapstructure:"trusted_proxy_hops"`
 }
 
 type CORS struct {
@@ -53,6 +68,40 @@ type JWTConfig struct {
 	Expiry        time.Duration `mapstructure:"expiry"`
 	Issuer        string        `mapstructure:"issuer"`
 	RefreshExpiry time.Duration `mapstructure:"refresh_expiry"`
+
+	// Algorithm is HS256 (shared secret, default), RS256 or EdDSA. The
+	// asymmetric ones keep their private keys as PEM files in KeysDir.
+	Algorithm        string        `mapstructure:"algorithm"`
+	KeysDir          string        `mapstructure:"keys_dir"`
+	RotationInterval time.Duration `mapstructure:"rotation_interval"`
+	// LegacyHS256Until (RFC 3339) keeps HS256 tokens signed with Secret
+	// valid after switching to RS256 or EdDSA, until then. Empty rejects
+	// them right away.
+	LegacyHS256Until string `mapstructure:"legacy_hs256_until"`
+}
+
+// LockoutConfig throttles failed logins per account. After FreeAttempts
+// failures each further failure blocks the account for a doubling delay;
+// MaxAttempts failures within Window lock it for Duration.
+type LockoutConfig struct {
+	FreeAttempts int           `mapstructure:"free_attempts"`
+	MaxAttempts  int           `mapstructure:"max_attempts"`
+	Window       time.Duration `mapstructure:"window"`
+	Duration     time.Duration `mapstructure:"duration"`
+}
+
+// OIDCConfig is the single sign-on provider (authorization code flow with
+// PKCE). RedirectURL is the web app page that receives the code and posts it
+// to /auth/oidc/callback.
+type OIDCConfig struct {
+	Enabled       bool     `mapstructure:"enabled"`
+	Name          string   `mapstructure:"name"` // stored with linked identities
+	Issuer        string   `mapstructure:"issuer"`
+	ClientID      string   `mapstructure:"client_id"`
+	ClientSecret  string   `mapstructure:"client_secret"` // empty for public clients
+	RedirectURL   string   `mapstructure:"redirect_url"`
+	Scopes        []string `mapstructure:"scopes"`
+	AutoProvision bool     `mapstructure:"auto_provision"` // create accounts for unknown identities
 }
 
 // Redis
@@ -63,6 +112,74 @@ type RedisConfig struct {
 	DB       int    `mapstructure:"db"`
 }
 
+// Mail
+type MailConfig struct {
+	Driver string `mapstructure:"driver"` // log | file
+	From   string `mapstructure:"from"`
+	Dir    string `mapstructure:"dir"`     // output directory for the file driver
+	AppURL string `mapstructure:"app_url"` // web app base URL used in email links
+}
+
+// MFA
+type MFAConfig struct {
+	Issuer        string `mapstructure:"issuer"`         // shown in authenticator apps
+	EncryptionKey string `mapstructure:"encryption_key"` // base64, 32 bytes; encrypts TOTP secrets at rest
+}
+
+// Account lifecycle
+type AccountConfig struct {
+	DeletionGracePeriod  time.Duration `mapstructure:"deletion_grace_period"` // soft-deleted accounts are anonymized after this
+	PurgeInterval        time.Duration `mapstructure:"purge_interval"`
+	HandleChangeCooldown time.Duration `mapstructure:"handle_change_cooldown"` // minimum time between handle changes
+	HandleReservation    time.Duration `mapstructure:"handle_reservation"`     // how long an old handle stays reserved
+}
+
+// RegistrationConfig decides who can sign up. Mode is open (invite codes
+// are optional), invite_only or closed.
+type RegistrationConfig struct {
+	Mode              string        `mapstructure:"mode"`
+	UserInvites       bool          `mapstructure:"user_invites"`         // regular users may create invite codes
+	MaxUserInviteUses int           `mapstructure:"max_user_invite_uses"` // usage limit cap for user-created codes
+	InviteTTL         time.Duration `mapstructure:"invite_ttl"`           // default lifetime, the maximum for users
+}
+
+// PasswordConfig is how new password hashes are made. Existing hashes keep
+// working and are rehashed with these settings on the next login.
+type PasswordConfig struct {
+	Algorithm         string `mapstructure:"algorithm"`          // argon2id | bcrypt
+	Argon2Memory      uint32 `mapstructure:"argon2_memory"`      // KiB
+	Argon2Iterations  uint32 `mapstructure:"argon2_iterations"`  // passes over the memory
+	Argon2Parallelism uint8  `mapstructure:"argon2_parallelism"` // lanes
+	BcryptCost        int    `mapstructure:"bcrypt_cost"`
+}
+
+// FriendRequestConfig keeps friend requests from piling up or being used
+// for spam.
+type FriendRequestConfig struct {
+	ExpireAfter       time.Duration `mapstructure:"expire_after"`       // pending requests are dropped after this
+	RejectionCooldown time.Duration `mapstructure:"rejection_cooldown"` // before asking someone who said no again
+	DailyLimit        int           `mapstructure:"daily_limit"`        // requests a user may send per day
+	SweepInterval     time.Duration `mapstructure:"sweep_interval"`     // how often expired requests are removed
+}
+
+// FriendConfig decides which users get their friend suggestions cached.
+// Computing them walks all friends of friends, which adds up for users with
+// many friends.
+type FriendConfig struct {
+	SuggestionCacheTTL        time.Duration `mapstructure:"suggestion_cache_ttl"`
+	SuggestionCacheMinFriends int           `mapstructure:"suggestion_cache_min_friends"` // cache only from this many friends on
+}
+
+// ExportConfig is where personal data export archives are built and how
+// long they and their download links stay valid.
+type ExportConfig struct {
+	Dir          string        `mapstructure:"dir"`
+	LinkTTL      time.Duration `mapstructure:"link_ttl"`  // lifetime of one download link
+	Retention    time.Duration `mapstructure:"retention"` // archives are deleted after this
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	Cooldown     time.Duration `mapstructure:"cooldown"` // between two exports of a user
+}
+
 // LOGGING
 type LoggingConfig struct {
 	Level  string `mapstructure:"level"`
@@ -156,6 +273,12 @@ func overrideFromEnv() {
 	if v := os.Getenv("JWT_SECRET"); v != "" {
 		viper.Set("jwt.secret", v)
 	}
+	if v := os.Getenv("MFA_ENCRYPTION_KEY"); v != "" {
+		viper.Set("mfa.encryption_key", v)
+	}
+	if v := os.Getenv("OIDC_CLIENT_SECRET"); v != "" {
+		viper.Set("oidc.client_secret", v)
+	}
 	if v := os.Getenv("PORT"); v != "" {
 		if port, err := strconv.Atoi(v); err == nil && port > 0 {
 			viper.Set("server.port", port)
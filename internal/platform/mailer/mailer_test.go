@@ -0,0 +1,41 @@
+package mailer
+
+import (
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+)
+
+func TestFileMailerWritesEmail(t *testing.T) {
+	dir := t.TempDir()
+	m, err := New(config.MailConfig{Driver: "file", From: "no-reply@example.com", Dir: dir})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	err = m.Send(context.Background(), Message{To: "alice@example.com", Subject: "Verify", Body: "code 123456"})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one email file, got %d (err %v)", len(entries), err)
+	}
+	content, err := os.ReadFile(dir + "/" + entries[0].Name())
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if !strings.Contains(string(content), "To: alice@example.com") || !strings.Contains(string(content), "code 123456") {
+		t.Fatalf("unexpected email content: %s", content)
+	}
+}
+
+func TestNewRejectsUnknownDriver(t *testing.T) {
+	if _, err := New(config.MailConfig{Driver: "carrier-pigeon"}); err == nil {
+		t.Fatalf("expected error for unknown driver")
+	}
+}
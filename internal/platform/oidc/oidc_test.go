@@ -0,0 +1,172 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// mockIdP is a minimal OpenID provider: discovery, a token endpoint that
+// checks the PKCE verifier, and a JWKS with one RSA key.
+type mockIdP struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+
+	// pending authorization: code -> challenge and nonce
+	code      string
+	challenge string
+	nonce     string
+	audience  string
+}
+
+func newMockIdP(t *testing.T) *mockIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("GenerateKey failed: %v", err)
+	}
+	idp := &mockIdP{key: key, clientID: "chat-app"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.server.URL,
+			"authorization_endpoint": idp.server.URL + "/authorize",
+			"token_endpoint":         idp.server.URL + "/token",
+			"jwks_uri":               idp.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "k1",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		if r.Form.Get("grant_type") != "authorization_code" || r.Form.Get("code") != idp.code ||
+			CodeChallenge(r.Form.Get("code_verifier")) != idp.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"invalid_grant"}`))
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": idp.idToken(t), "token_type": "Bearer"})
+	})
+	idp.server = httptest.NewServer(mux)
+	t.Cleanup(idp.server.Close)
+	return idp
+}
+
+func (idp *mockIdP) idToken(t *testing.T) string {
+	aud := idp.audience
+	if aud == "" {
+		aud = idp.clientID
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":                idp.server.URL,
+		"sub":                "user-42",
+		"aud":                aud,
+		"exp":                time.Now().Add(time.Minute).Unix(),
+		"iat":                time.Now().Unix(),
+		"nonce":              idp.nonce,
+		"email":              "jane@example.com",
+		"email_verified":     true,
+		"preferred_username": "jane",
+	})
+	token.Header["kid"] = "k1"
+	signed, err := token.SignedString(idp.key)
+	if err != nil {
+		t.Fatalf("SignedString failed: %v", err)
+	}
+	return signed
+}
+
+// authorize plays the browser: it follows the authorization URL and keeps
+// what the provider would remember for the code.
+func (idp *mockIdP) authorize(t *testing.T, authURL string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil || !strings.HasPrefix(authURL, idp.server.URL+"/authorize?") {
+		t.Fatalf("unexpected authorization URL %q", authURL)
+	}
+	q := u.Query()
+	if q.Get("client_id") != idp.clientID || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("unexpected authorization request %v", q)
+	}
+	idp.code = "code-1"
+	idp.challenge = q.Get("code_challenge")
+	idp.nonce = q.Get("nonce")
+}
+
+func newTestProvider(t *testing.T, idp *mockIdP) *Provider {
+	t.Helper()
+	p, err := New(config.OIDCConfig{
+		Issuer:      idp.server.URL,
+		ClientID:    idp.clientID,
+		RedirectURL: "http://localhost:5173/auth/oidc/callback",
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return p
+}
+
+func TestExchangeVerifiesIDToken(t *testing.T) {
+	idp := newMockIdP(t)
+	p := newTestProvider(t, idp)
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", CodeChallenge("verifier-1"))
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed: %v", err)
+	}
+	idp.authorize(t, authURL)
+
+	if _, err := p.Exchange(ctx, "code-1", "other-verifier", "nonce-1"); err == nil {
+		t.Fatalf("expected exchange with the wrong verifier to fail")
+	}
+	if _, err := p.Exchange(ctx, "code-1", "verifier-1", "other-nonce"); err == nil {
+		t.Fatalf("expected exchange with the wrong nonce to fail")
+	}
+
+	identity, err := p.Exchange(ctx, "code-1", "verifier-1", "nonce-1")
+	if err != nil {
+		t.Fatalf("Exchange failed: %v", err)
+	}
+	if identity.Subject != "user-42" || identity.Email != "jane@example.com" || !identity.EmailVerified || identity.PreferredUsername != "jane" {
+		t.Fatalf("unexpected identity %#v", identity)
+	}
+}
+
+func TestExchangeRejectsTokenForOtherClient(t *testing.T) {
+	idp := newMockIdP(t)
+	idp.audience = "someone-else"
+	p := newTestProvider(t, idp)
+	ctx := context.Background()
+
+	authURL, err := p.AuthCodeURL(ctx, "state-1", "nonce-1", CodeChallenge("verifier-1"))
+	if err != nil {
+		t.Fatalf("AuthCodeURL failed: %v", err)
+	}
+	idp.authorize(t, authURL)
+
+	if _, err := p.Exchange(ctx, "code-1", "verifier-1", "nonce-1"); err == nil {
+		t.Fatalf("expected an ID token for another audience to be rejected")
+	}
+}
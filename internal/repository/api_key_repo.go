@@ -0,0 +1,104 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// lastUsedResolution limits how often last_used_at is written for a key
+const lastUsedResolution = time.Minute
+
+type APIKeyRepository interface {
+	CreateKey(ctx context.Context, key *model.APIKey) error
+	ListKeys(ctx context.Context, botID string) ([]*model.APIKey, error)
+	RevokeKey(ctx context.Context, botID, keyID string) error
+	Authenticate(ctx context.Context, keyHash string) (*model.APIKey, error)
+}
+
+type APIKeyRepositoryImpl struct {
+	db *pgxpool.Pool
+}
+
+func NewAPIKeyRepositoryImpl(db *pgxpool.Pool) *APIKeyRepositoryImpl {
+	return &APIKeyRepositoryImpl{db: db}
+}
+
+func (r *APIKeyRepositoryImpl) CreateKey(ctx context.Context, key *model.APIKey) error {
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO api_keys (id, bot_id, name, key_prefix, key_hash, scopes, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at
+	`, key.ID, key.BotID, key.Name, key.Prefix, key.KeyHash, key.Scopes, key.CreatedBy).Scan(&key.CreatedAt)
+	return errs.Wrap("repository.APIKeyRepository.CreateKey", err)
+}
+
+// ListKeys returns the active keys of a bot, newest first.
+func (r *APIKeyRepositoryImpl) ListKeys(ctx context.Context, botID string) ([]*model.APIKey, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, bot_id, name, key_prefix, scopes, created_at, last_used_at
+		FROM api_keys
+		WHERE bot_id=$1 AND revoked_at IS NULL
+		ORDER BY created_at DESC
+	`, botID)
+	if err != nil {
+		return nil, errs.Wrap("repository.APIKeyRepository.ListKeys", err)
+	}
+	defer rows.Close()
+
+	keys := []*model.APIKey{}
+	for rows.Next() {
+		var k model.APIKey
+		if err := rows.Scan(&k.ID, &k.BotID, &k.Name, &k.Prefix, &k.Scopes, &k.CreatedAt, &k.LastUsedAt); err != nil {
+			return nil, errs.Wrap("repository.APIKeyRepository.ListKeys", err)
+		}
+		keys = append(keys, &k)
+	}
+	return keys, errs.Wrap("repository.APIKeyRepository.ListKeys", rows.Err())
+}
+
+func (r *APIKeyRepositoryImpl) RevokeKey(ctx context.Context, botID, keyID string) error {
+	cmd, err := r.db.Exec(ctx, `
+		UPDATE api_keys
+		SET revoked_at=NOW()
+		WHERE id=$1 AND bot_id=$2 AND revoked_at IS NULL
+	`, keyID, botID)
+	if err != nil {
+		return errs.Wrap("repository.APIKeyRepository.RevokeKey", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return errs.ErrNotFound
+	}
+	return nil
+}
+
+// Authenticate returns the active key with keyHash whose bot still exists,
+// or nil. Usage is recorded at most once per lastUsedResolution.
+func (r *APIKeyRepositoryImpl) Authenticate(ctx context.Context, keyHash string) (*model.APIKey, error) {
+	var k model.APIKey
+	err := r.db.QueryRow(ctx, `
+		SELECT k.id, k.bot_id, k.name, k.key_prefix, k.scopes, k.created_at, k.last_used_at
+		FROM api_keys k
+		JOIN users u ON u.id = k.bot_id
+		WHERE k.key_hash=$1 AND k.revoked_at IS NULL
+			AND u.role='bot' AND u.deleted_at IS NULL
+	`, keyHash).Scan(&k.ID, &k.BotID, &k.Name, &k.Prefix, &k.Scopes, &k.CreatedAt, &k.LastUsedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errs.Wrap("repository.APIKeyRepository.Authenticate", err)
+	}
+
+	if !k.LastUsedAt.Valid || time.Since(k.LastUsedAt.Time) > lastUsedResolution {
+		if _, err := r.db.Exec(ctx, `UPDATE api_keys SET last_used_at=NOW() WHERE id=$1`, k.ID); err != nil {
+			return nil, errs.Wrap("repository.APIKeyRepository.Authenticate", err)
+		}
+	}
+	return &k, nil
+}
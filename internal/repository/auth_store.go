@@ -0,0 +1,193 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	revokedSessionPrefix = "auth:revoked:sid:"
+	revokedTokenPrefix   = "auth:revoked:jti:"
+	mfaChallengePrefix   = "auth:mfa:"
+	wsTicketPrefix       = "auth:ws:"
+	loginFailurePrefix   = "auth:login:fail:"
+	loginBlockPrefix     = "auth:login:block:"
+	oidcStatePrefix      = "auth:oidc:"
+)
+
+// AuthStore keeps short-lived auth state in Redis. Entries expire on their own
+// once the access tokens they refer to can no longer be valid.
+type AuthStore interface {
+	RevokeSessions(ctx context.Context, sessionIDs []string, ttl time.Duration) error
+	RevokeToken(ctx context.Context, tokenID string, ttl time.Duration) error
+	IsRevoked(ctx context.Context, sessionID, tokenID string) (bool, error)
+	Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error)
+	SetMFAChallenge(ctx context.Context, tokenHash, userID string, ttl time.Duration) error
+	GetMFAChallenge(ctx context.Context, tokenHash string) (string, error)
+	DeleteMFAChallenge(ctx context.Context, tokenHash string) (bool, error)
+	SetWSTicket(ctx context.Context, ticketHash, userID, sessionID string, ttl time.Duration) error
+	ConsumeWSTicket(ctx context.Context, ticketHash string) (userID, sessionID string, err error)
+	LoginBlockedFor(ctx context.Context, account string) (time.Duration, error)
+	RecordLoginFailure(ctx context.Context, account string, window time.Duration) (int64, error)
+	BlockLogin(ctx context.Context, account string, d time.Duration) error
+	ClearLoginFailures(ctx context.Context, account string) error
+	SetOIDCState(ctx context.Context, stateHash, codeVerifier, nonce string, ttl time.Duration) error
+	ConsumeOIDCState(ctx context.Context, stateHash string) (codeVerifier, nonce string, err error)
+}
+
+type AuthStoreImpl struct {
+	rdb *redis.Client
+}
+
+func NewAuthStoreImpl(rdb *redis.Client) *AuthStoreImpl {
+	return &AuthStoreImpl{rdb: rdb}
+}
+
+func (s *AuthStoreImpl) RevokeSessions(ctx context.Context, sessionIDs []string, ttl time.Duration) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+
+	pipe := s.rdb.Pipeline()
+	for _, id := range sessionIDs {
+		pipe.Set(ctx, revokedSessionPrefix+id, 1, ttl)
+	}
+	_, err := pipe.Exec(ctx)
+	return errs.Wrap("repository.AuthStore.RevokeSessions", err)
+}
+
+func (s *AuthStoreImpl) RevokeToken(ctx context.Context, tokenID string, ttl time.Duration) error {
+	err := s.rdb.Set(ctx, revokedTokenPrefix+tokenID, 1, ttl).Err()
+	return errs.Wrap("repository.AuthStore.RevokeToken", err)
+}
+
+func (s *AuthStoreImpl) IsRevoked(ctx context.Context, sessionID, tokenID string) (bool, error) {
+	n, err := s.rdb.Exists(ctx, revokedSessionPrefix+sessionID, revokedTokenPrefix+tokenID).Result()
+	if err != nil {
+		return false, errs.Wrap("repository.AuthStore.IsRevoked", err)
+	}
+	return n > 0, nil
+}
+
+// Allow is a fixed-window counter: it reports whether the call identified by
+// key is still within limit for the current window.
+func (s *AuthStoreImpl) Allow(ctx context.Context, key string, limit int, window time.Duration) (bool, error) {
+	pipe := s.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, key)
+	pipe.ExpireNX(ctx, key, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return false, errs.Wrap("repository.AuthStore.Allow", err)
+	}
+	return incr.Val() <= int64(limit), nil
+}
+
+// SetMFAChallenge remembers which user passed the password step of a login
+// that still needs a second factor.
+func (s *AuthStoreImpl) SetMFAChallenge(ctx context.Context, tokenHash, userID string, ttl time.Duration) error {
+	err := s.rdb.Set(ctx, mfaChallengePrefix+tokenHash, userID, ttl).Err()
+	return errs.Wrap("repository.AuthStore.SetMFAChallenge", err)
+}
+
+// GetMFAChallenge returns the user of a pending challenge, or "" if it
+// expired or was already completed.
+func (s *AuthStoreImpl) GetMFAChallenge(ctx context.Context, tokenHash string) (string, error) {
+	userID, err := s.rdb.Get(ctx, mfaChallengePrefix+tokenHash).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errs.Wrap("repository.AuthStore.GetMFAChallenge", err)
+	}
+	return userID, nil
+}
+
+// DeleteMFAChallenge ends a challenge. Only the first caller gets true, so a
+// challenge completes at most once.
+func (s *AuthStoreImpl) DeleteMFAChallenge(ctx context.Context, tokenHash string) (bool, error) {
+	n, err := s.rdb.Del(ctx, mfaChallengePrefix+tokenHash).Result()
+	if err != nil {
+		return false, errs.Wrap("repository.AuthStore.DeleteMFAChallenge", err)
+	}
+	return n == 1, nil
+}
+
+// SetWSTicket stores a WebSocket connection ticket for a session.
+func (s *AuthStoreImpl) SetWSTicket(ctx context.Context, ticketHash, userID, sessionID string, ttl time.Duration) error {
+	err := s.rdb.Set(ctx, wsTicketPrefix+ticketHash, userID+":"+sessionID, ttl).Err()
+	return errs.Wrap("repository.AuthStore.SetWSTicket", err)
+}
+
+// ConsumeWSTicket reads and deletes a ticket in one step, so it can open at
+// most one connection. Unknown or expired tickets return empty IDs.
+func (s *AuthStoreImpl) ConsumeWSTicket(ctx context.Context, ticketHash string) (string, string, error) {
+	val, err := s.rdb.GetDel(ctx, wsTicketPrefix+ticketHash).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", errs.Wrap("repository.AuthStore.ConsumeWSTicket", err)
+	}
+	userID, sessionID, _ := strings.Cut(val, ":")
+	return userID, sessionID, nil
+}
+
+// LoginBlockedFor returns how long logins for account are still blocked.
+func (s *AuthStoreImpl) LoginBlockedFor(ctx context.Context, account string) (time.Duration, error) {
+	ttl, err := s.rdb.PTTL(ctx, loginBlockPrefix+account).Result()
+	if err != nil {
+		return 0, errs.Wrap("repository.AuthStore.LoginBlockedFor", err)
+	}
+	// Negative values mean the key does not exist or has no expiry
+	if ttl < 0 {
+		return 0, nil
+	}
+	return ttl, nil
+}
+
+// RecordLoginFailure counts a failed login and returns the failures within
+// window, which starts at the first failure.
+func (s *AuthStoreImpl) RecordLoginFailure(ctx context.Context, account string, window time.Duration) (int64, error) {
+	pipe := s.rdb.TxPipeline()
+	incr := pipe.Incr(ctx, loginFailurePrefix+account)
+	pipe.ExpireNX(ctx, loginFailurePrefix+account, window)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, errs.Wrap("repository.AuthStore.RecordLoginFailure", err)
+	}
+	return incr.Val(), nil
+}
+
+func (s *AuthStoreImpl) BlockLogin(ctx context.Context, account string, d time.Duration) error {
+	err := s.rdb.Set(ctx, loginBlockPrefix+account, 1, d).Err()
+	return errs.Wrap("repository.AuthStore.BlockLogin", err)
+}
+
+func (s *AuthStoreImpl) ClearLoginFailures(ctx context.Context, account string) error {
+	err := s.rdb.Del(ctx, loginFailurePrefix+account, loginBlockPrefix+account).Err()
+	return errs.Wrap("repository.AuthStore.ClearLoginFailures", err)
+}
+
+// SetOIDCState remembers the PKCE verifier and nonce of a started sign-in
+// until the provider redirects back with the state.
+func (s *AuthStoreImpl) SetOIDCState(ctx context.Context, stateHash, codeVerifier, nonce string, ttl time.Duration) error {
+	err := s.rdb.Set(ctx, oidcStatePrefix+stateHash, codeVerifier+":"+nonce, ttl).Err()
+	return errs.Wrap("repository.AuthStore.SetOIDCState", err)
+}
+
+// ConsumeOIDCState reads and deletes a sign-in state, so each one completes
+// at most once. Unknown or expired states return empty values.
+func (s *AuthStoreImpl) ConsumeOIDCState(ctx context.Context, stateHash string) (string, string, error) {
+	val, err := s.rdb.GetDel(ctx, oidcStatePrefix+stateHash).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", "", nil
+	}
+	if err != nil {
+		return "", "", errs.Wrap("repository.AuthStore.ConsumeOIDCState", err)
+	}
+	codeVerifier, nonce, _ := strings.Cut(val, ":")
+	return codeVerifier, nonce, nil
+}
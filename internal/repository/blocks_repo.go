@@ -3,15 +3,18 @@ package repository
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
 	"github.com/ak-repo/go-chat-system/internal/shared/errs"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type BlockRepository interface {
-	BlockUser(ctx context.Context, blocker, target string) error
+	BlockUser(ctx context.Context, blocker, target, reason string) (unfriended bool, err error)
 	UnblockUser(ctx context.Context, blocker, target string) error
 	IsBlocked(ctx context.Context, a, b string) (bool, error)
+	ListBlocks(ctx context.Context, blocker string, after *model.BlockCursor, limit int) (model.BlocksDTO, error)
 }
 
 type BlockRepositoryImpl struct {
@@ -35,35 +38,40 @@ func (r *BlockRepositoryImpl) IsBlocked(ctx context.Context, a, b string) (bool,
 	return exists, errs.Wrap("repository.BlockRepository.IsBlocked", err)
 }
 
-func (r *BlockRepositoryImpl) BlockUser(ctx context.Context, blocker, target string) error {
+// BlockUser blocks target for blocker, ending any friendship and request
+// between them. unfriended reports whether they were friends. Blocking again
+// with a reason replaces the earlier reason.
+func (r *BlockRepositoryImpl) BlockUser(ctx context.Context, blocker, target, reason string) (bool, error) {
 	if blocker == target {
-		return errs.ErrSelfAction
+		return false, errs.ErrSelfAction
 	}
 
 	tx, err := r.db.Begin(ctx)
 	if err != nil {
-		return errs.Wrap("repository.BlockRepository.BlockUser", err)
+		return false, errs.Wrap("repository.BlockRepository.BlockUser", err)
 	}
 	defer tx.Rollback(ctx)
 
 	// Insert block
 	_, err = tx.Exec(ctx, `
-		INSERT INTO blocks (blocker_id, blocked_id)
-		VALUES ($1, $2)
-		ON CONFLICT DO NOTHING
-	`, blocker, target)
+		INSERT INTO blocks (blocker_id, blocked_id, reason)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (blocker_id, blocked_id) DO UPDATE
+		SET reason = EXCLUDED.reason, modified_at = NOW()
+		WHERE EXCLUDED.reason <> ''
+	`, blocker, target, reason)
 	if err != nil {
-		return errs.Wrap("repository.BlockRepository.BlockUser", err)
+		return false, errs.Wrap("repository.BlockRepository.BlockUser", err)
 	}
 
 	// Remove friendships both ways
-	_, err = tx.Exec(ctx, `
+	cmd, err := tx.Exec(ctx, `
 		DELETE FROM friends
 		WHERE (user_id=$1 AND friend_id=$2)
 		   OR (user_id=$2 AND friend_id=$1)
 	`, blocker, target)
 	if err != nil {
-		return errs.Wrap("repository.BlockRepository.BlockUser", err)
+		return false, errs.Wrap("repository.BlockRepository.BlockUser", err)
 	}
 
 	// Update requests to blocked
@@ -74,10 +82,13 @@ func (r *BlockRepositoryImpl) BlockUser(ctx context.Context, blocker, target str
 		   OR (sender_id=$2 AND receiver_id=$1)
 	`, blocker, target)
 	if err != nil {
-		return errs.Wrap("repository.BlockRepository.BlockUser", err)
+		return false, errs.Wrap("repository.BlockRepository.BlockUser", err)
 	}
 
-	return errs.Wrap("repository.BlockRepository.BlockUser", tx.Commit(ctx))
+	if err := tx.Commit(ctx); err != nil {
+		return false, errs.Wrap("repository.BlockRepository.BlockUser", err)
+	}
+	return cmd.RowsAffected() > 0, nil
 }
 
 func (r *BlockRepositoryImpl) UnblockUser(ctx context.Context, blocker, target string) error {
@@ -93,3 +104,46 @@ func (r *BlockRepositoryImpl) UnblockUser(ctx context.Context, blocker, target s
 	}
 	return nil
 }
+
+// ListBlocks returns up to limit users blocker has blocked, newest first,
+// starting after the given cursor (nil for the first page).
+func (r *BlockRepositoryImpl) ListBlocks(ctx context.Context, blocker string, after *model.BlockCursor, limit int) (model.BlocksDTO, error) {
+	if limit <= 0 {
+		limit = 50
+	}
+
+	var afterTime *time.Time
+	var afterID *string
+	if after != nil {
+		afterTime, afterID = &after.CreatedAt, &after.BlockedID
+	}
+
+	rows, err := r.db.Query(ctx, `
+		SELECT b.blocked_id,
+			   CASE WHEN u.deleted_at IS NULL THEN u.username ELSE 'Deleted user' END,
+			   CASE WHEN u.deleted_at IS NULL THEN u.display_name ELSE '' END,
+			   CASE WHEN u.deleted_at IS NULL THEN u.avatar_url ELSE '' END,
+			   b.reason,
+			   b.created_at
+		FROM blocks b
+		JOIN users u ON u.id = b.blocked_id
+		WHERE b.blocker_id=$1
+		  AND ($2::timestamptz IS NULL OR (b.created_at, b.blocked_id) < ($2, $3::uuid))
+		ORDER BY b.created_at DESC, b.blocked_id DESC
+		LIMIT $4
+	`, blocker, afterTime, afterID, limit)
+	if err != nil {
+		return nil, errs.Wrap("repository.BlockRepository.ListBlocks", err)
+	}
+	defer rows.Close()
+
+	blocks := model.BlocksDTO{}
+	for rows.Next() {
+		var b model.BlockDTO
+		if err := rows.Scan(&b.BlockedID, &b.BlockedName, &b.BlockedDisplayName, &b.BlockedAvatarURL, &b.Reason, &b.CreatedAt); err != nil {
+			return nil, errs.Wrap("repository.BlockRepository.ListBlocks", err)
+		}
+		blocks = append(blocks, &b)
+	}
+	return blocks, errs.Wrap("repository.BlockRepository.ListBlocks", rows.Err())
+}
@@ -0,0 +1,177 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type ExportRepository interface {
+	CreateExport(ctx context.Context, export *model.DataExport) error
+	GetExport(ctx context.Context, id, userID string) (*model.DataExport, error)
+	LatestExport(ctx context.Context, userID string) (*model.DataExport, error)
+	ClaimExport(ctx context.Context, staleBefore time.Time) (*model.DataExport, error)
+	CompleteExport(ctx context.Context, id, filePath string, size int64, expiresAt time.Time) error
+	FailExport(ctx context.Context, id string) error
+	SetDownloadToken(ctx context.Context, id, tokenHash string, expiresAt time.Time) error
+	GetByDownloadToken(ctx context.Context, tokenHash string) (*model.DataExport, error)
+	ExpireExports(ctx context.Context, now time.Time) ([]string, error)
+}
+
+type ExportRepositoryImpl struct {
+	db *pgxpool.Pool
+}
+
+func NewExportRepositoryImpl(db *pgxpool.Pool) *ExportRepositoryImpl {
+	return &ExportRepositoryImpl{db: db}
+}
+
+const exportColumns = `id, user_id, status, file_path, size_bytes, created_at, completed_at, expires_at`
+
+func scanExport(row pgx.Row) (*model.DataExport, error) {
+	var e model.DataExport
+	err := row.Scan(&e.ID, &e.UserID, &e.Status, &e.FilePath, &e.SizeBytes, &e.CreatedAt, &e.CompletedAt, &e.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// CreateExport queues an export. It returns errs.ErrConflict while the user
+// already has one queued or running.
+func (r *ExportRepositoryImpl) CreateExport(ctx context.Context, export *model.DataExport) error {
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO data_exports (id, user_id, status)
+		VALUES ($1, $2, $3)
+		RETURNING created_at
+	`, export.ID, export.UserID, export.Status).Scan(&export.CreatedAt)
+	if utils.IsUniqueViolationOn(err, "data_exports_active_key") {
+		return errs.ErrConflict
+	}
+	return errs.Wrap("repository.ExportRepository.CreateExport", err)
+}
+
+func (r *ExportRepositoryImpl) GetExport(ctx context.Context, id, userID string) (*model.DataExport, error) {
+	export, err := scanExport(r.db.QueryRow(ctx, `
+		SELECT `+exportColumns+`
+		FROM data_exports
+		WHERE id=$1 AND user_id=$2
+	`, id, userID))
+	return export, errs.Wrap("repository.ExportRepository.GetExport", err)
+}
+
+// LatestExport returns the newest export of userID that did not fail, or nil.
+func (r *ExportRepositoryImpl) LatestExport(ctx context.Context, userID string) (*model.DataExport, error) {
+	export, err := scanExport(r.db.QueryRow(ctx, `
+		SELECT `+exportColumns+`
+		FROM data_exports
+		WHERE user_id=$1 AND status <> 'failed'
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, userID))
+	return export, errs.Wrap("repository.ExportRepository.LatestExport", err)
+}
+
+// ClaimExport marks the oldest queued export as running and returns it, or
+// nil if there is none. Running exports started before staleBefore belong
+// to a worker that died and are claimed again.
+func (r *ExportRepositoryImpl) ClaimExport(ctx context.Context, staleBefore time.Time) (*model.DataExport, error) {
+	export, err := scanExport(r.db.QueryRow(ctx, `
+		UPDATE data_exports
+		SET status='running', started_at=NOW()
+		WHERE id = (
+			SELECT id
+			FROM data_exports
+			WHERE status='pending' OR (status='running' AND started_at < $1)
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+exportColumns+`
+	`, staleBefore))
+	return export, errs.Wrap("repository.ExportRepository.ClaimExport", err)
+}
+
+func (r *ExportRepositoryImpl) CompleteExport(ctx context.Context, id, filePath string, size int64, expiresAt time.Time) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE data_exports
+		SET status='ready', file_path=$2, size_bytes=$3, completed_at=NOW(), expires_at=$4
+		WHERE id=$1
+	`, id, filePath, size, expiresAt)
+	return errs.Wrap("repository.ExportRepository.CompleteExport", err)
+}
+
+func (r *ExportRepositoryImpl) FailExport(ctx context.Context, id string) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE data_exports
+		SET status='failed', completed_at=NOW()
+		WHERE id=$1
+	`, id)
+	return errs.Wrap("repository.ExportRepository.FailExport", err)
+}
+
+// SetDownloadToken replaces the download link of a ready export.
+func (r *ExportRepositoryImpl) SetDownloadToken(ctx context.Context, id, tokenHash string, expiresAt time.Time) error {
+	cmd, err := r.db.Exec(ctx, `
+		UPDATE data_exports
+		SET download_token_hash=$2, link_expires_at=$3
+		WHERE id=$1 AND status='ready'
+	`, id, tokenHash, expiresAt)
+	if err != nil {
+		return errs.Wrap("repository.ExportRepository.SetDownloadToken", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return errs.ErrNotFound
+	}
+	return nil
+}
+
+// GetByDownloadToken returns the ready export whose link is still valid, or
+// nil.
+func (r *ExportRepositoryImpl) GetByDownloadToken(ctx context.Context, tokenHash string) (*model.DataExport, error) {
+	export, err := scanExport(r.db.QueryRow(ctx, `
+		SELECT e.id, e.user_id, e.status, e.file_path, e.size_bytes, e.created_at, e.completed_at, e.expires_at
+		FROM data_exports e
+		JOIN users u ON u.id = e.user_id
+		WHERE e.download_token_hash=$1
+		  AND e.status='ready'
+		  AND e.link_expires_at > NOW()
+		  AND e.expires_at > NOW()
+		  AND u.deleted_at IS NULL
+	`, tokenHash))
+	return export, errs.Wrap("repository.ExportRepository.GetByDownloadToken", err)
+}
+
+// ExpireExports marks ready exports past their retention as expired and
+// returns their archive paths so the caller can delete the files.
+func (r *ExportRepositoryImpl) ExpireExports(ctx context.Context, now time.Time) ([]string, error) {
+	rows, err := r.db.Query(ctx, `
+		UPDATE data_exports
+		SET status='expired', download_token_hash=NULL, link_expires_at=NULL
+		WHERE status='ready' AND expires_at <= $1
+		RETURNING file_path
+	`, now)
+	if err != nil {
+		return nil, errs.Wrap("repository.ExportRepository.ExpireExports", err)
+	}
+	defer rows.Close()
+
+	var paths []string
+	for rows.Next() {
+		var path string
+		if err := rows.Scan(&path); err != nil {
+			return nil, errs.Wrap("repository.ExportRepository.ExpireExports", err)
+		}
+		paths = append(paths, path)
+	}
+	return paths, errs.Wrap("repository.ExportRepository.ExpireExports", rows.Err())
+}
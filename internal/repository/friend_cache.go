@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/redis/go-redis/v9"
+)
+
+const friendSuggestionsPrefix = "friends:suggestions:"
+
+// FriendCache keeps friend suggestions that are costly to compute in Redis.
+type FriendCache interface {
+	GetSuggestions(ctx context.Context, userID string) (model.FriendSuggestionsDTO, bool, error)
+	SetSuggestions(ctx context.Context, userID string, suggestions model.FriendSuggestionsDTO, ttl time.Duration) error
+	InvalidateSuggestions(ctx context.Context, userIDs ...string) error
+}
+
+type FriendCacheImpl struct {
+	rdb *redis.Client
+}
+
+func NewFriendCacheImpl(rdb *redis.Client) *FriendCacheImpl {
+	return &FriendCacheImpl{rdb: rdb}
+}
+
+// GetSuggestions reports false if nothing is cached for userID.
+func (c *FriendCacheImpl) GetSuggestions(ctx context.Context, userID string) (model.FriendSuggestionsDTO, bool, error) {
+	raw, err := c.rdb.Get(ctx, friendSuggestionsPrefix+userID).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errs.Wrap("repository.FriendCache.GetSuggestions", err)
+	}
+
+	var suggestions model.FriendSuggestionsDTO
+	if err := json.Unmarshal(raw, &suggestions); err != nil {
+		return nil, false, errs.Wrap("repository.FriendCache.GetSuggestions", err)
+	}
+	return suggestions, true, nil
+}
+
+func (c *FriendCacheImpl) SetSuggestions(ctx context.Context, userID string, suggestions model.FriendSuggestionsDTO, ttl time.Duration) error {
+	raw, err := json.Marshal(suggestions)
+	if err != nil {
+		return errs.Wrap("repository.FriendCache.SetSuggestions", err)
+	}
+	err = c.rdb.Set(ctx, friendSuggestionsPrefix+userID, raw, ttl).Err()
+	return errs.Wrap("repository.FriendCache.SetSuggestions", err)
+}
+
+// InvalidateSuggestions drops the cached suggestions of userIDs, e.g. after
+// they became friends or one blocked the other.
+func (c *FriendCacheImpl) InvalidateSuggestions(ctx context.Context, userIDs ...string) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	keys := make([]string, len(userIDs))
+	for i, id := range userIDs {
+		keys[i] = friendSuggestionsPrefix + id
+	}
+	return errs.Wrap("repository.FriendCache.InvalidateSuggestions", c.rdb.Del(ctx, keys...).Err())
+}
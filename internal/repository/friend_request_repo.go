@@ -3,6 +3,7 @@ package repository
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/ak-repo/go-chat-system/internal/domain/model"
 	"github.com/ak-repo/go-chat-system/internal/shared/errs"
@@ -14,10 +15,14 @@ type FriendRequestRepository interface {
 	CreateRequest(ctx context.Context, req *model.FriendRequest) error
 	GetPendingRequest(ctx context.Context, sender, receiver string) (*model.FriendRequest, error)
 	GetAllRequests(ctx context.Context, userID string) (model.FriendRequestsDTO, error)
+	GetSentRequests(ctx context.Context, userID string) (model.FriendRequestsDTO, error)
 
-	AcceptRequest(ctx context.Context, requestID, receiverID string) error
-	RejectRequest(ctx context.Context, requestID, receiverID string) error
-	CancelRequest(ctx context.Context, requestID, senderID string) error
+	AcceptRequest(ctx context.Context, requestID, receiverID string) (*model.FriendRequest, error)
+	RejectRequest(ctx context.Context, requestID, receiverID string) (*model.FriendRequest, error)
+	CancelRequest(ctx context.Context, requestID, senderID string) (*model.FriendRequest, error)
+
+	LastRejectedAt(ctx context.Context, sender, receiver string) (time.Time, error)
+	DeleteExpiredRequests(ctx context.Context, now time.Time, limit int) ([]*model.FriendRequest, error)
 }
 
 type FriendRequestRepositoryImpl struct {
@@ -28,11 +33,29 @@ func FriendRequestRepositoryInit(db *pgxpool.Pool) *FriendRequestRepositoryImpl
 	return &FriendRequestRepositoryImpl{db: db}
 }
 
+// CreateRequest stores a pending request. It returns errs.ErrConflict if a
+// pending request between the two users exists in either direction. Expired
+// requests the sweeper has not removed yet do not count.
 func (r *FriendRequestRepositoryImpl) CreateRequest(ctx context.Context, req *model.FriendRequest) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return errs.Wrap("repository.FriendRequestRepository.CreateRequest", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM friend_requests
+		WHERE ((sender_id=$1 AND receiver_id=$2) OR (sender_id=$2 AND receiver_id=$1))
+		  AND status='pending' AND expires_at <= NOW()
+	`, req.SenderID, req.ReceiverID)
+	if err != nil {
+		return errs.Wrap("repository.FriendRequestRepository.CreateRequest", err)
+	}
+
 	// Prevent duplicate pending requests both ways
-	_, err := r.db.Exec(ctx, `
-		INSERT INTO friend_requests (id, sender_id, receiver_id, status, created_at)
-		SELECT $1, $2, $3, $4, $5
+	cmd, err := tx.Exec(ctx, `
+		INSERT INTO friend_requests (id, sender_id, receiver_id, status, created_at, expires_at)
+		SELECT $1, $2, $3, $4, $5, $6
 		WHERE NOT EXISTS (
 			SELECT 1
 			FROM friend_requests
@@ -42,8 +65,14 @@ func (r *FriendRequestRepositoryImpl) CreateRequest(ctx context.Context, req *mo
 			)
 			AND status='pending'
 		)
-	`, req.ID, req.SenderID, req.ReceiverID, req.Status, req.CreatedAt)
-	return errs.Wrap("repository.FriendRequestRepository.CreateRequest", err)
+	`, req.ID, req.SenderID, req.ReceiverID, req.Status, req.CreatedAt, req.ExpiresAt)
+	if err != nil {
+		return errs.Wrap("repository.FriendRequestRepository.CreateRequest", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return errs.ErrConflict
+	}
+	return errs.Wrap("repository.FriendRequestRepository.CreateRequest", tx.Commit(ctx))
 }
 
 func (r *FriendRequestRepositoryImpl) GetPendingRequest(
@@ -57,6 +86,7 @@ func (r *FriendRequestRepositoryImpl) GetPendingRequest(
 		WHERE sender_id=$1
 		  AND receiver_id=$2
 		  AND status='pending'
+		  AND expires_at > NOW()
 	`, sender, receiver)
 
 	var fr model.FriendRequest
@@ -71,71 +101,79 @@ func (r *FriendRequestRepositoryImpl) GetPendingRequest(
 	return &fr, nil
 }
 
-func (r *FriendRequestRepositoryImpl) CancelRequest(ctx context.Context, requestID, senderID string) error {
-	cmd, err := r.db.Exec(ctx, `
+// CancelRequest deletes a pending request of senderID and returns it.
+func (r *FriendRequestRepositoryImpl) CancelRequest(ctx context.Context, requestID, senderID string) (*model.FriendRequest, error) {
+	var fr model.FriendRequest
+	err := r.db.QueryRow(ctx, `
 		DELETE FROM friend_requests
 		WHERE id=$1 AND sender_id=$2 AND status='pending'
-	`, requestID, senderID)
-	if err != nil {
-		return errs.Wrap("repository.FriendRequestRepository.CancelRequest", err)
+		RETURNING id, sender_id, receiver_id, status, created_at
+	`, requestID, senderID).Scan(&fr.ID, &fr.SenderID, &fr.ReceiverID, &fr.Status, &fr.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errs.ErrRequestNotFound
 	}
-	if cmd.RowsAffected() == 0 {
-		return errs.ErrRequestNotFound
+	if err != nil {
+		return nil, errs.Wrap("repository.FriendRequestRepository.CancelRequest", err)
 	}
-	return nil
+	return &fr, nil
 }
 
-func (r *FriendRequestRepositoryImpl) RejectRequest(ctx context.Context, requestID, receiverID string) error {
-	cmd, err := r.db.Exec(ctx, `
+// RejectRequest rejects a pending request to receiverID and returns it.
+func (r *FriendRequestRepositoryImpl) RejectRequest(ctx context.Context, requestID, receiverID string) (*model.FriendRequest, error) {
+	var fr model.FriendRequest
+	err := r.db.QueryRow(ctx, `
 		UPDATE friend_requests
-		SET status='rejected'
-		WHERE id=$1 AND receiver_id=$2 AND status='pending'
-	`, requestID, receiverID)
-	if err != nil {
-		return errs.Wrap("repository.FriendRequestRepository.RejectRequest", err)
+		SET status='rejected', modified_at=NOW()
+		WHERE id=$1 AND receiver_id=$2 AND status='pending' AND expires_at > NOW()
+		RETURNING id, sender_id, receiver_id, status, created_at
+	`, requestID, receiverID).Scan(&fr.ID, &fr.SenderID, &fr.ReceiverID, &fr.Status, &fr.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errs.ErrRequestNotFound
 	}
-	if cmd.RowsAffected() == 0 {
-		return errs.ErrRequestNotFound
+	if err != nil {
+		return nil, errs.Wrap("repository.FriendRequestRepository.RejectRequest", err)
 	}
-	return nil
+	return &fr, nil
 }
 
-func (r *FriendRequestRepositoryImpl) AcceptRequest(ctx context.Context, requestID, receiverID string) error {
+// AcceptRequest accepts a pending request to receiverID, makes the two users
+// friends and returns the request.
+func (r *FriendRequestRepositoryImpl) AcceptRequest(ctx context.Context, requestID, receiverID string) (*model.FriendRequest, error) {
 	tx, err := r.db.Begin(ctx)
 	if err != nil {
-		return errs.Wrap("repository.FriendRequestRepository.AcceptRequest", err)
+		return nil, errs.Wrap("repository.FriendRequestRepository.AcceptRequest", err)
 	}
 	defer tx.Rollback(ctx)
 
-	var sender, receiver string
+	var fr model.FriendRequest
 
 	// Lock row to avoid race conditions
 	err = tx.QueryRow(ctx, `
-		SELECT sender_id, receiver_id
+		SELECT id, sender_id, receiver_id, created_at
 		FROM friend_requests
-		WHERE id=$1 AND status='pending'
+		WHERE id=$1 AND status='pending' AND expires_at > NOW()
 		FOR UPDATE
-	`, requestID).Scan(&sender, &receiver)
+	`, requestID).Scan(&fr.ID, &fr.SenderID, &fr.ReceiverID, &fr.CreatedAt)
 
 	if errors.Is(err, pgx.ErrNoRows) {
-		return errs.ErrRequestNotFound
+		return nil, errs.ErrRequestNotFound
 	}
 	if err != nil {
-		return errs.Wrap("repository.FriendRequestRepository.AcceptRequest", err)
+		return nil, errs.Wrap("repository.FriendRequestRepository.AcceptRequest", err)
 	}
 
-	if receiver != receiverID {
-		return errs.ErrRequestNotFound
+	if fr.ReceiverID != receiverID {
+		return nil, errs.ErrRequestNotFound
 	}
 
 	// mark accepted
 	_, err = tx.Exec(ctx, `
 		UPDATE friend_requests
-		SET status='accepted'
+		SET status='accepted', modified_at=NOW()
 		WHERE id=$1 AND status='pending'
 	`, requestID)
 	if err != nil {
-		return errs.Wrap("repository.FriendRequestRepository.AcceptRequest", err)
+		return nil, errs.Wrap("repository.FriendRequestRepository.AcceptRequest", err)
 	}
 
 	// Create mutual friendship (idempotent)
@@ -143,12 +181,16 @@ func (r *FriendRequestRepositoryImpl) AcceptRequest(ctx context.Context, request
 		INSERT INTO friends (user_id, friend_id)
 		VALUES ($1, $2), ($2, $1)
 		ON CONFLICT DO NOTHING
-	`, sender, receiver)
+	`, fr.SenderID, fr.ReceiverID)
 	if err != nil {
-		return errs.Wrap("repository.FriendRequestRepository.AcceptRequest", err)
+		return nil, errs.Wrap("repository.FriendRequestRepository.AcceptRequest", err)
 	}
 
-	return errs.Wrap("repository.FriendRequestRepository.AcceptRequest", tx.Commit(ctx))
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errs.Wrap("repository.FriendRequestRepository.AcceptRequest", err)
+	}
+	fr.Status = model.FriendAccepted
+	return &fr, nil
 }
 
 func (r *FriendRequestRepositoryImpl) GetAllRequests(ctx context.Context, userID string) (model.FriendRequestsDTO, error) {
@@ -157,12 +199,13 @@ func (r *FriendRequestRepositoryImpl) GetAllRequests(ctx context.Context, userID
 			   fr.sender_id,
 			   fr.receiver_id,
 			   fr.status,
-			   u.username,
-			   u.email,
+			   CASE WHEN u.deleted_at IS NULL THEN u.username ELSE 'Deleted user' END,
+			   CASE WHEN u.deleted_at IS NULL THEN u.email ELSE '' END,
 			   fr.created_at
 		FROM friend_requests fr
 		JOIN users u ON u.id = fr.sender_id
 		WHERE fr.receiver_id=$1
+		  AND NOT (fr.status='pending' AND fr.expires_at <= NOW())
 		ORDER BY fr.created_at DESC
 	`
 
@@ -192,3 +235,95 @@ func (r *FriendRequestRepositoryImpl) GetAllRequests(ctx context.Context, userID
 
 	return resp, errs.Wrap("repository.FriendRequestRepository.GetAllRequests", rows.Err())
 }
+
+// GetSentRequests is GetAllRequests for the requests userID sent; the
+// friend columns describe the receiver. The receiver's email is left out,
+// since sending a request does not entitle the sender to it.
+func (r *FriendRequestRepositoryImpl) GetSentRequests(ctx context.Context, userID string) (model.FriendRequestsDTO, error) {
+	query := `
+		SELECT fr.id,
+			   fr.sender_id,
+			   fr.receiver_id,
+			   fr.status,
+			   CASE WHEN u.deleted_at IS NULL THEN u.username ELSE 'Deleted user' END,
+			   fr.created_at
+		FROM friend_requests fr
+		JOIN users u ON u.id = fr.receiver_id
+		WHERE fr.sender_id=$1
+		  AND NOT (fr.status='pending' AND fr.expires_at <= NOW())
+		ORDER BY fr.created_at DESC
+	`
+
+	rows, err := r.db.Query(ctx, query, userID)
+	if err != nil {
+		return nil, errs.Wrap("repository.FriendRequestRepository.GetSentRequests", err)
+	}
+	defer rows.Close()
+
+	var resp model.FriendRequestsDTO
+
+	for rows.Next() {
+		var fr model.FriendRequestDTO
+		if err := rows.Scan(
+			&fr.ID,
+			&fr.SenderID,
+			&fr.ReceiverID,
+			&fr.Status,
+			&fr.FriendName,
+			&fr.CreatedAt,
+		); err != nil {
+			return nil, errs.Wrap("repository.FriendRequestRepository.GetSentRequests", err)
+		}
+		resp = append(resp, &fr)
+	}
+
+	return resp, errs.Wrap("repository.FriendRequestRepository.GetSentRequests", rows.Err())
+}
+
+// LastRejectedAt is when receiver last rejected a request from sender, or
+// the zero time if never.
+func (r *FriendRequestRepositoryImpl) LastRejectedAt(ctx context.Context, sender, receiver string) (time.Time, error) {
+	var at time.Time
+	err := r.db.QueryRow(ctx, `
+		SELECT modified_at
+		FROM friend_requests
+		WHERE sender_id=$1 AND receiver_id=$2 AND status='rejected'
+		ORDER BY modified_at DESC
+		LIMIT 1
+	`, sender, receiver).Scan(&at)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return time.Time{}, nil
+	}
+	return at, errs.Wrap("repository.FriendRequestRepository.LastRejectedAt", err)
+}
+
+// DeleteExpiredRequests removes up to limit pending requests that expired
+// before now and returns them.
+func (r *FriendRequestRepositoryImpl) DeleteExpiredRequests(ctx context.Context, now time.Time, limit int) ([]*model.FriendRequest, error) {
+	rows, err := r.db.Query(ctx, `
+		DELETE FROM friend_requests
+		WHERE id IN (
+			SELECT id
+			FROM friend_requests
+			WHERE status='pending' AND expires_at <= $1
+			ORDER BY expires_at
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, sender_id, receiver_id, status, created_at, expires_at
+	`, now, limit)
+	if err != nil {
+		return nil, errs.Wrap("repository.FriendRequestRepository.DeleteExpiredRequests", err)
+	}
+	defer rows.Close()
+
+	var expired []*model.FriendRequest
+	for rows.Next() {
+		var fr model.FriendRequest
+		if err := rows.Scan(&fr.ID, &fr.SenderID, &fr.ReceiverID, &fr.Status, &fr.CreatedAt, &fr.ExpiresAt); err != nil {
+			return nil, errs.Wrap("repository.FriendRequestRepository.DeleteExpiredRequests", err)
+		}
+		expired = append(expired, &fr)
+	}
+	return expired, errs.Wrap("repository.FriendRequestRepository.DeleteExpiredRequests", rows.Err())
+}
@@ -10,8 +10,14 @@ import (
 
 type FriendRepository interface {
 	CreateFriendship(ctx context.Context, a, b string) error
+	RemoveFriendship(ctx context.Context, a, b string) (bool, error)
 	AreFriends(ctx context.Context, a, b string) (bool, error)
 	ListFriends(ctx context.Context, userID string, limit, offset int) (model.FriendsDTO, error)
+	ListFriendIDs(ctx context.Context, userID string) ([]string, error)
+	HaveMutualFriend(ctx context.Context, a, b string) (bool, error)
+	CountFriends(ctx context.Context, userID string) (int, error)
+	ListMutualFriends(ctx context.Context, a, b string, limit, offset int) ([]*model.UserSummaryDTO, error)
+	SuggestFriends(ctx context.Context, userID string, limit int) (model.FriendSuggestionsDTO, error)
 }
 
 type FriendRepositoryImpl struct {
@@ -33,6 +39,30 @@ func (r *FriendRepositoryImpl) CreateFriendship(ctx context.Context, a, b string
 	return errs.Wrap("repository.FriendRepository.CreateFriendship", err)
 }
 
+// RemoveFriendship deletes the friendship between a and b in both
+// directions. It reports false when they were not friends.
+func (r *FriendRepositoryImpl) RemoveFriendship(ctx context.Context, a, b string) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, errs.Wrap("repository.FriendRepository.RemoveFriendship", err)
+	}
+	defer tx.Rollback(ctx)
+
+	cmd, err := tx.Exec(ctx, `
+		DELETE FROM friends
+		WHERE (user_id=$1 AND friend_id=$2)
+		   OR (user_id=$2 AND friend_id=$1)
+	`, a, b)
+	if err != nil {
+		return false, errs.Wrap("repository.FriendRepository.RemoveFriendship", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	return true, errs.Wrap("repository.FriendRepository.RemoveFriendship", tx.Commit(ctx))
+}
+
 func (r *FriendRepositoryImpl) AreFriends(ctx context.Context, a, b string) (bool, error) {
 	var exists bool
 	err := r.db.QueryRow(ctx, `
@@ -45,6 +75,20 @@ func (r *FriendRepositoryImpl) AreFriends(ctx context.Context, a, b string) (boo
 	return exists, errs.Wrap("repository.FriendRepository.AreFriends", err)
 }
 
+// HaveMutualFriend reports whether a and b share at least one friend.
+func (r *FriendRepositoryImpl) HaveMutualFriend(ctx context.Context, a, b string) (bool, error) {
+	var exists bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM friends f1
+			JOIN friends f2 ON f2.user_id = f1.friend_id
+			WHERE f1.user_id=$1 AND f2.friend_id=$2
+		)
+	`, a, b).Scan(&exists)
+
+	return exists, errs.Wrap("repository.FriendRepository.HaveMutualFriend", err)
+}
+
 func (r *FriendRepositoryImpl) ListFriends(ctx context.Context, userID string, limit, offset int) (model.FriendsDTO, error) {
 	if limit <= 0 {
 		limit = 20
@@ -81,3 +125,128 @@ func (r *FriendRepositoryImpl) ListFriends(ctx context.Context, userID string, l
 
 	return friends, errs.Wrap("repository.FriendRepository.ListFriends", rows.Err())
 }
+
+// ListFriendIDs returns the IDs of all friends of userID, e.g. to fan out
+// realtime events.
+func (r *FriendRepositoryImpl) ListFriendIDs(ctx context.Context, userID string) ([]string, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT friend_id
+		FROM friends
+		WHERE user_id=$1
+	`, userID)
+	if err != nil {
+		return nil, errs.Wrap("repository.FriendRepository.ListFriendIDs", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, errs.Wrap("repository.FriendRepository.ListFriendIDs", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, errs.Wrap("repository.FriendRepository.ListFriendIDs", rows.Err())
+}
+
+func (r *FriendRepositoryImpl) CountFriends(ctx context.Context, userID string) (int, error) {
+	var n int
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*) FROM friends WHERE user_id=$1
+	`, userID).Scan(&n)
+
+	return n, errs.Wrap("repository.FriendRepository.CountFriends", err)
+}
+
+// ListMutualFriends returns a page of the friends a and b have in common,
+// ordered by handle.
+func (r *FriendRepositoryImpl) ListMutualFriends(ctx context.Context, a, b string, limit, offset int) ([]*model.UserSummaryDTO, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	rows, err := r.db.Query(ctx, `
+		SELECT u.id, u.username, u.display_name, u.avatar_url
+		FROM friends f1
+		JOIN friends f2 ON f2.user_id = $2 AND f2.friend_id = f1.friend_id
+		JOIN users u ON u.id = f1.friend_id
+		WHERE f1.user_id = $1
+		  AND u.deleted_at IS NULL
+		ORDER BY u.username
+		LIMIT $3 OFFSET $4
+	`, a, b, limit, offset)
+	if err != nil {
+		return nil, errs.Wrap("repository.FriendRepository.ListMutualFriends", err)
+	}
+	defer rows.Close()
+
+	users := []*model.UserSummaryDTO{}
+	for rows.Next() {
+		var u model.UserSummaryDTO
+		if err := rows.Scan(&u.ID, &u.Username, &u.DisplayName, &u.AvatarURL); err != nil {
+			return nil, errs.Wrap("repository.FriendRepository.ListMutualFriends", err)
+		}
+		users = append(users, &u)
+	}
+
+	return users, errs.Wrap("repository.FriendRepository.ListMutualFriends", rows.Err())
+}
+
+// SuggestFriends ranks friends of userID's friends by how many friends they
+// share with userID. Existing friends, users blocked either way, users with a
+// pending request between them and users who do not want to be found are
+// left out.
+func (r *FriendRepositoryImpl) SuggestFriends(ctx context.Context, userID string, limit int) (model.FriendSuggestionsDTO, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	rows, err := r.db.Query(ctx, `
+		SELECT u.id, u.username, u.display_name, u.avatar_url,
+			   COUNT(*) AS mutual
+		FROM friends f1
+		JOIN friends f2 ON f2.user_id = f1.friend_id
+		JOIN users u ON u.id = f2.friend_id
+		WHERE f1.user_id = $1
+		  AND f2.friend_id <> $1
+		  AND u.deleted_at IS NULL
+		  AND u.role <> 'bot'
+		  AND u.discoverability <> 'nobody'
+		  AND NOT EXISTS (
+			SELECT 1 FROM friends f
+			WHERE f.user_id = $1 AND f.friend_id = f2.friend_id
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM blocks b
+			WHERE (b.blocker_id = $1 AND b.blocked_id = f2.friend_id)
+			   OR (b.blocker_id = f2.friend_id AND b.blocked_id = $1)
+		  )
+		  AND NOT EXISTS (
+			SELECT 1 FROM friend_requests fr
+			WHERE fr.status = 'pending' AND fr.expires_at > NOW()
+			  AND ((fr.sender_id = $1 AND fr.receiver_id = f2.friend_id)
+			    OR (fr.sender_id = f2.friend_id AND fr.receiver_id = $1))
+		  )
+		GROUP BY u.id, u.username, u.display_name, u.avatar_url
+		ORDER BY mutual DESC, u.username
+		LIMIT $2
+	`, userID, limit)
+	if err != nil {
+		return nil, errs.Wrap("repository.FriendRepository.SuggestFriends", err)
+	}
+	defer rows.Close()
+
+	suggestions := model.FriendSuggestionsDTO{}
+	for rows.Next() {
+		var s model.FriendSuggestionDTO
+		if err := rows.Scan(&s.ID, &s.Username, &s.DisplayName, &s.AvatarURL, &s.MutualFriends); err != nil {
+			return nil, errs.Wrap("repository.FriendRepository.SuggestFriends", err)
+		}
+		suggestions = append(suggestions, &s)
+	}
+
+	return suggestions, errs.Wrap("repository.FriendRepository.SuggestFriends", rows.Err())
+}
@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type IdentityRepository interface {
+	GetUserID(ctx context.Context, provider, subject string) (string, error)
+	CreateIdentity(ctx context.Context, identity *model.UserIdentity) error
+}
+
+type IdentityRepositoryImpl struct {
+	db *pgxpool.Pool
+}
+
+func NewIdentityRepositoryImpl(db *pgxpool.Pool) *IdentityRepositoryImpl {
+	return &IdentityRepositoryImpl{db: db}
+}
+
+// GetUserID returns the user linked to an external identity and records the
+// login, or "" if the identity is not linked yet.
+func (r *IdentityRepositoryImpl) GetUserID(ctx context.Context, provider, subject string) (string, error) {
+	var userID string
+	err := r.db.QueryRow(ctx, `
+		UPDATE user_identities
+		SET last_login_at=NOW()
+		WHERE provider=$1 AND subject=$2
+		RETURNING user_id
+	`, provider, subject).Scan(&userID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", nil
+	}
+	if err != nil {
+		return "", errs.Wrap("repository.IdentityRepository.GetUserID", err)
+	}
+	return userID, nil
+}
+
+func (r *IdentityRepositoryImpl) CreateIdentity(ctx context.Context, identity *model.UserIdentity) error {
+	if identity.ID == "" {
+		identity.ID = uuid.NewString()
+	}
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO user_identities (id, user_id, provider, subject, email)
+		VALUES ($1, $2, $3, $4, $5)
+	`, identity.ID, identity.UserID, identity.Provider, identity.Subject, identity.Email)
+	if utils.IsUniqueViolationOn(err, "user_identities_provider_subject_key") {
+		return errs.Wrap("repository.IdentityRepository.CreateIdentity", errs.ErrConflict)
+	}
+	return errs.Wrap("repository.IdentityRepository.CreateIdentity", err)
+}
@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// InviteRepository stores sign-up invite codes. Redeeming one happens with
+// the account creation in UserRepository.CreateInvitedUser.
+type InviteRepository interface {
+	CreateInvite(ctx context.Context, invite *model.Invite) error
+	ListInvites(ctx context.Context, createdBy string, limit, offset int) ([]*model.Invite, error)
+	RevokeInvite(ctx context.Context, id, createdBy string) error
+	CountActiveInvites(ctx context.Context, createdBy string, now time.Time) (int, error)
+}
+
+type InviteRepositoryImpl struct {
+	db *pgxpool.Pool
+}
+
+func NewInviteRepositoryImpl(db *pgxpool.Pool) *InviteRepositoryImpl {
+	return &InviteRepositoryImpl{db: db}
+}
+
+func (r *InviteRepositoryImpl) CreateInvite(ctx context.Context, invite *model.Invite) error {
+	err := r.db.QueryRow(ctx, `
+		INSERT INTO invite_codes (id, code_prefix, code_hash, created_by, email, max_uses, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING created_at
+	`, invite.ID, invite.Prefix, invite.CodeHash, invite.CreatedBy, invite.Email, invite.MaxUses, invite.ExpiresAt).Scan(&invite.CreatedAt)
+	return errs.Wrap("repository.InviteRepository.CreateInvite", err)
+}
+
+// ListInvites returns the unrevoked invites created by createdBy, or by
+// anyone if createdBy is empty, newest first.
+func (r *InviteRepositoryImpl) ListInvites(ctx context.Context, createdBy string, limit, offset int) ([]*model.Invite, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, code_prefix, COALESCE(created_by::text, ''), email, max_uses, uses, expires_at, created_at
+		FROM invite_codes
+		WHERE revoked_at IS NULL AND ($1 = '' OR created_by::text = $1)
+		ORDER BY created_at DESC
+		LIMIT $2 OFFSET $3
+	`, createdBy, limit, offset)
+	if err != nil {
+		return nil, errs.Wrap("repository.InviteRepository.ListInvites", err)
+	}
+	defer rows.Close()
+
+	invites := []*model.Invite{}
+	for rows.Next() {
+		var i model.Invite
+		if err := rows.Scan(&i.ID, &i.Prefix, &i.CreatedBy, &i.Email, &i.MaxUses, &i.Uses, &i.ExpiresAt, &i.CreatedAt); err != nil {
+			return nil, errs.Wrap("repository.InviteRepository.ListInvites", err)
+		}
+		invites = append(invites, &i)
+	}
+	return invites, errs.Wrap("repository.InviteRepository.ListInvites", rows.Err())
+}
+
+// RevokeInvite revokes an invite of createdBy, or of anyone if createdBy is
+// empty. Accounts that already used it are not affected.
+func (r *InviteRepositoryImpl) RevokeInvite(ctx context.Context, id, createdBy string) error {
+	cmd, err := r.db.Exec(ctx, `
+		UPDATE invite_codes
+		SET revoked_at=NOW()
+		WHERE id=$1 AND revoked_at IS NULL AND ($2 = '' OR created_by::text = $2)
+	`, id, createdBy)
+	if err != nil {
+		return errs.Wrap("repository.InviteRepository.RevokeInvite", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return errs.ErrNotFound
+	}
+	return nil
+}
+
+// CountActiveInvites counts the invites of createdBy that can still be
+// redeemed.
+func (r *InviteRepositoryImpl) CountActiveInvites(ctx context.Context, createdBy string, now time.Time) (int, error) {
+	var n int
+	err := r.db.QueryRow(ctx, `
+		SELECT COUNT(*)
+		FROM invite_codes
+		WHERE created_by=$1 AND revoked_at IS NULL AND uses < max_uses AND expires_at > $2
+	`, createdBy, now).Scan(&n)
+	return n, errs.Wrap("repository.InviteRepository.CountActiveInvites", err)
+}
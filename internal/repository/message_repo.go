@@ -12,6 +12,7 @@ type MessageRepository interface {
 	CreateMessage(ctx context.Context, msg *model.Message) error
 	GetMessagesByReceiver(ctx context.Context, receiverID string, limit, offset int) (model.Messages, error)
 	GetMessagesBetweenUsers(ctx context.Context, senderID, receiverID string, limit, offset int) (model.Messages, error)
+	GetMessagesForUser(ctx context.Context, userID string, limit, offset int) (model.Messages, error)
 }
 
 type MessageRepositoryImpl struct {
@@ -34,10 +35,11 @@ func (r *MessageRepositoryImpl) CreateMessage(ctx context.Context, msg *model.Me
 
 func (r *MessageRepositoryImpl) GetMessagesByReceiver(ctx context.Context, receiverID string, limit, offset int) (model.Messages, error) {
 	query := `
-		SELECT id, sender_id, receiver_id, body, is_group, created_at, modified_at
-		FROM messages
-		WHERE receiver_id = $1
-		ORDER BY created_at DESC
+		SELECT m.id, m.sender_id, CASE WHEN u.deleted_at IS NULL THEN u.username ELSE 'Deleted user' END, m.receiver_id, m.body, m.is_group, m.created_at, m.modified_at
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		WHERE m.receiver_id = $1
+		ORDER BY m.created_at DESC
 		LIMIT $2 OFFSET $3
 	`
 	rows, err := r.db.Query(ctx, query, receiverID, limit, offset)
@@ -49,7 +51,7 @@ func (r *MessageRepositoryImpl) GetMessagesByReceiver(ctx context.Context, recei
 	var messages model.Messages
 	for rows.Next() {
 		var msg model.Message
-		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.Body, &msg.IsGroup, &msg.CreatedAt, &msg.ModifiedAt); err != nil {
+		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.SenderName, &msg.ReceiverID, &msg.Body, &msg.IsGroup, &msg.CreatedAt, &msg.ModifiedAt); err != nil {
 			return nil, errs.Wrap("repository.MessageRepository.GetMessagesByReceiver", err)
 		}
 		messages = append(messages, &msg)
@@ -59,10 +61,11 @@ func (r *MessageRepositoryImpl) GetMessagesByReceiver(ctx context.Context, recei
 
 func (r *MessageRepositoryImpl) GetMessagesBetweenUsers(ctx context.Context, senderID, receiverID string, limit, offset int) (model.Messages, error) {
 	query := `
-		SELECT id, sender_id, receiver_id, body, is_group, created_at, modified_at
-		FROM messages
-		WHERE (sender_id = $1 AND receiver_id = $2) OR (sender_id = $2 AND receiver_id = $1)
-		ORDER BY created_at DESC
+		SELECT m.id, m.sender_id, CASE WHEN u.deleted_at IS NULL THEN u.username ELSE 'Deleted user' END, m.receiver_id, m.body, m.is_group, m.created_at, m.modified_at
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		WHERE (m.sender_id = $1 AND m.receiver_id = $2) OR (m.sender_id = $2 AND m.receiver_id = $1)
+		ORDER BY m.created_at DESC
 		LIMIT $3 OFFSET $4
 	`
 	rows, err := r.db.Query(ctx, query, senderID, receiverID, limit, offset)
@@ -74,10 +77,38 @@ func (r *MessageRepositoryImpl) GetMessagesBetweenUsers(ctx context.Context, sen
 	var messages model.Messages
 	for rows.Next() {
 		var msg model.Message
-		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.ReceiverID, &msg.Body, &msg.IsGroup, &msg.CreatedAt, &msg.ModifiedAt); err != nil {
+		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.SenderName, &msg.ReceiverID, &msg.Body, &msg.IsGroup, &msg.CreatedAt, &msg.ModifiedAt); err != nil {
 			return nil, errs.Wrap("repository.MessageRepository.GetMessagesBetweenUsers", err)
 		}
 		messages = append(messages, &msg)
 	}
 	return messages, errs.Wrap("repository.MessageRepository.GetMessagesBetweenUsers", rows.Err())
 }
+
+// GetMessagesForUser pages through every message userID sent or received,
+// oldest first.
+func (r *MessageRepositoryImpl) GetMessagesForUser(ctx context.Context, userID string, limit, offset int) (model.Messages, error) {
+	query := `
+		SELECT m.id, m.sender_id, CASE WHEN u.deleted_at IS NULL THEN u.username ELSE 'Deleted user' END, m.receiver_id, m.body, m.is_group, m.created_at, m.modified_at
+		FROM messages m
+		JOIN users u ON u.id = m.sender_id
+		WHERE m.sender_id = $1 OR m.receiver_id = $1
+		ORDER BY m.created_at, m.id
+		LIMIT $2 OFFSET $3
+	`
+	rows, err := r.db.Query(ctx, query, userID, limit, offset)
+	if err != nil {
+		return nil, errs.Wrap("repository.MessageRepository.GetMessagesForUser", err)
+	}
+	defer rows.Close()
+
+	var messages model.Messages
+	for rows.Next() {
+		var msg model.Message
+		if err := rows.Scan(&msg.ID, &msg.SenderID, &msg.SenderName, &msg.ReceiverID, &msg.Body, &msg.IsGroup, &msg.CreatedAt, &msg.ModifiedAt); err != nil {
+			return nil, errs.Wrap("repository.MessageRepository.GetMessagesForUser", err)
+		}
+		messages = append(messages, &msg)
+	}
+	return messages, errs.Wrap("repository.MessageRepository.GetMessagesForUser", rows.Err())
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"context"
+	"errors"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type MFARepository interface {
+	GetMFA(ctx context.Context, userID string) (*model.UserMFA, error)
+	SaveSecret(ctx context.Context, userID, secretEnc string) error
+	Enable(ctx context.Context, userID string, step int64, recoveryHashes []string) error
+	Disable(ctx context.Context, userID string) error
+	UseStep(ctx context.Context, userID string, step int64) (bool, error)
+	UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error)
+	ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error
+}
+
+type MFARepositoryImpl struct {
+	db *pgxpool.Pool
+}
+
+func NewMFARepositoryImpl(db *pgxpool.Pool) *MFARepositoryImpl {
+	return &MFARepositoryImpl{db: db}
+}
+
+func (r *MFARepositoryImpl) GetMFA(ctx context.Context, userID string) (*model.UserMFA, error) {
+	var m model.UserMFA
+	err := r.db.QueryRow(ctx, `
+		SELECT user_id, secret_enc, enabled_at, last_used_step, created_at
+		FROM user_mfa
+		WHERE user_id=$1
+	`, userID).Scan(&m.UserID, &m.SecretEnc, &m.EnabledAt, &m.LastUsedStep, &m.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errs.Wrap("repository.MFARepository.GetMFA", err)
+	}
+	return &m, nil
+}
+
+// SaveSecret stores a pending (not yet confirmed) secret. An enabled
+// enrollment is never overwritten; the caller has to disable it first.
+func (r *MFARepositoryImpl) SaveSecret(ctx context.Context, userID, secretEnc string) error {
+	cmd, err := r.db.Exec(ctx, `
+		INSERT INTO user_mfa (user_id, secret_enc)
+		VALUES ($1, $2)
+		ON CONFLICT (user_id) DO UPDATE
+		SET secret_enc=EXCLUDED.secret_enc, last_used_step=0, created_at=NOW()
+		WHERE user_mfa.enabled_at IS NULL
+	`, userID, secretEnc)
+	if err != nil {
+		return errs.Wrap("repository.MFARepository.SaveSecret", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return errs.ErrConflict
+	}
+	return nil
+}
+
+// Enable turns the pending enrollment on and stores the first set of
+// recovery codes in the same transaction.
+func (r *MFARepositoryImpl) Enable(ctx context.Context, userID string, step int64, recoveryHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return errs.Wrap("repository.MFARepository.Enable", err)
+	}
+	defer tx.Rollback(ctx)
+
+	cmd, err := tx.Exec(ctx, `
+		UPDATE user_mfa
+		SET enabled_at=NOW(), last_used_step=$2
+		WHERE user_id=$1 AND enabled_at IS NULL
+	`, userID, step)
+	if err != nil {
+		return errs.Wrap("repository.MFARepository.Enable", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return errs.ErrConflict
+	}
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, recoveryHashes); err != nil {
+		return errs.Wrap("repository.MFARepository.Enable", err)
+	}
+
+	return errs.Wrap("repository.MFARepository.Enable", tx.Commit(ctx))
+}
+
+func (r *MFARepositoryImpl) Disable(ctx context.Context, userID string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return errs.Wrap("repository.MFARepository.Disable", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id=$1`, userID); err != nil {
+		return errs.Wrap("repository.MFARepository.Disable", err)
+	}
+	if _, err := tx.Exec(ctx, `DELETE FROM user_mfa WHERE user_id=$1`, userID); err != nil {
+		return errs.Wrap("repository.MFARepository.Disable", err)
+	}
+
+	return errs.Wrap("repository.MFARepository.Disable", tx.Commit(ctx))
+}
+
+// UseStep records step as the last accepted TOTP step. It reports false when
+// a code of that step (or a later one) was already used, which stops replays.
+func (r *MFARepositoryImpl) UseStep(ctx context.Context, userID string, step int64) (bool, error) {
+	cmd, err := r.db.Exec(ctx, `
+		UPDATE user_mfa
+		SET last_used_step=$2
+		WHERE user_id=$1 AND enabled_at IS NOT NULL AND last_used_step < $2
+	`, userID, step)
+	if err != nil {
+		return false, errs.Wrap("repository.MFARepository.UseStep", err)
+	}
+	return cmd.RowsAffected() == 1, nil
+}
+
+// UseRecoveryCode marks a matching unused recovery code as used.
+func (r *MFARepositoryImpl) UseRecoveryCode(ctx context.Context, userID, codeHash string) (bool, error) {
+	cmd, err := r.db.Exec(ctx, `
+		UPDATE mfa_recovery_codes
+		SET used_at=NOW()
+		WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL
+	`, userID, codeHash)
+	if err != nil {
+		return false, errs.Wrap("repository.MFARepository.UseRecoveryCode", err)
+	}
+	return cmd.RowsAffected() == 1, nil
+}
+
+func (r *MFARepositoryImpl) ReplaceRecoveryCodes(ctx context.Context, userID string, codeHashes []string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return errs.Wrap("repository.MFARepository.ReplaceRecoveryCodes", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := replaceRecoveryCodes(ctx, tx, userID, codeHashes); err != nil {
+		return errs.Wrap("repository.MFARepository.ReplaceRecoveryCodes", err)
+	}
+
+	return errs.Wrap("repository.MFARepository.ReplaceRecoveryCodes", tx.Commit(ctx))
+}
+
+func replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, userID string, codeHashes []string) error {
+	if _, err := tx.Exec(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id=$1`, userID); err != nil {
+		return err
+	}
+
+	batch := &pgx.Batch{}
+	for _, hash := range codeHashes {
+		batch.Queue(`
+			INSERT INTO mfa_recovery_codes (id, user_id, code_hash)
+			VALUES ($1, $2, $3)
+		`, uuid.NewString(), userID, hash)
+	}
+	return tx.SendBatch(ctx, batch).Close()
+}
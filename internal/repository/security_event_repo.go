@@ -0,0 +1,33 @@
+package repository
+
+import (
+	"context"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type SecurityEventRepository interface {
+	Record(ctx context.Context, event *model.SecurityEvent) error
+}
+
+type SecurityEventRepositoryImpl struct {
+	db *pgxpool.Pool
+}
+
+func NewSecurityEventRepositoryImpl(db *pgxpool.Pool) *SecurityEventRepositoryImpl {
+	return &SecurityEventRepositoryImpl{db: db}
+}
+
+func (r *SecurityEventRepositoryImpl) Record(ctx context.Context, event *model.SecurityEvent) error {
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	_, err := r.db.Exec(ctx, `
+		INSERT INTO security_events (id, user_id, event_type, subject, ip, user_agent)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, event.ID, event.UserID, string(event.Type), event.Subject, event.IP, event.UserAgent)
+	return errs.Wrap("repository.SecurityEventRepository.Record", err)
+}
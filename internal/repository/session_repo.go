@@ -0,0 +1,235 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type SessionRepository interface {
+	CreateSession(ctx context.Context, session *model.Session, token *model.RefreshToken) error
+	RotateRefreshToken(ctx context.Context, tokenHash string, next *model.RefreshToken) (*model.Session, error)
+	RevokeSession(ctx context.Context, sessionID, userID string) error
+	RevokeUserSessions(ctx context.Context, userID, exceptSessionID string) ([]string, error)
+	ListSessions(ctx context.Context, userID string) ([]model.Session, error)
+	IsKnownDevice(ctx context.Context, userID, userAgent string) (bool, error)
+}
+
+type SessionRepositoryImpl struct {
+	db *pgxpool.Pool
+}
+
+func NewSessionRepositoryImpl(db *pgxpool.Pool) *SessionRepositoryImpl {
+	return &SessionRepositoryImpl{db: db}
+}
+
+func (r *SessionRepositoryImpl) CreateSession(ctx context.Context, session *model.Session, token *model.RefreshToken) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return errs.Wrap("repository.SessionRepository.CreateSession", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO sessions (id, user_id, created_at, last_seen_at, expires_at, device_name, user_agent, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, session.ID, session.UserID, session.CreatedAt, session.LastSeenAt, session.ExpiresAt,
+		session.DeviceName, session.UserAgent, session.IP)
+	if err != nil {
+		return errs.Wrap("repository.SessionRepository.CreateSession", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO refresh_tokens (id, session_id, token_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, token.ID, token.SessionID, token.TokenHash, token.CreatedAt, token.ExpiresAt)
+	if err != nil {
+		return errs.Wrap("repository.SessionRepository.CreateSession", err)
+	}
+
+	return errs.Wrap("repository.SessionRepository.CreateSession", tx.Commit(ctx))
+}
+
+// RotateRefreshToken marks the presented token as used and stores its successor
+// in the same family. Presenting a token that was already used revokes the
+// whole family and returns errs.ErrRefreshTokenReused.
+func (r *SessionRepositoryImpl) RotateRefreshToken(ctx context.Context, tokenHash string, next *model.RefreshToken) (*model.Session, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return nil, errs.Wrap("repository.SessionRepository.RotateRefreshToken", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var (
+		tokenID        string
+		tokenExpiresAt time.Time
+		usedAt         *time.Time
+		session        model.Session
+	)
+
+	// Lock token and session rows so concurrent refreshes cannot both win
+	err = tx.QueryRow(ctx, `
+		SELECT rt.id, rt.expires_at, rt.used_at,
+			   s.id, s.user_id, s.created_at, s.last_seen_at, s.expires_at, s.revoked_at
+		FROM refresh_tokens rt
+		JOIN sessions s ON s.id = rt.session_id
+		WHERE rt.token_hash=$1
+		FOR UPDATE OF rt, s
+	`, tokenHash).Scan(
+		&tokenID, &tokenExpiresAt, &usedAt,
+		&session.ID, &session.UserID, &session.CreatedAt, &session.LastSeenAt, &session.ExpiresAt, &session.RevokedAt,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, errs.ErrUnauthorized
+	}
+	if err != nil {
+		return nil, errs.Wrap("repository.SessionRepository.RotateRefreshToken", err)
+	}
+
+	if session.ID != next.SessionID || session.RevokedAt.Valid {
+		return nil, errs.ErrUnauthorized
+	}
+
+	// Replay of a rotated token: revoke the family and keep the revocation
+	if usedAt != nil {
+		_, err = tx.Exec(ctx, `
+			UPDATE sessions
+			SET revoked_at=NOW()
+			WHERE id=$1 AND revoked_at IS NULL
+		`, session.ID)
+		if err != nil {
+			return nil, errs.Wrap("repository.SessionRepository.RotateRefreshToken", err)
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, errs.Wrap("repository.SessionRepository.RotateRefreshToken", err)
+		}
+		return nil, errs.ErrRefreshTokenReused
+	}
+
+	now := time.Now().UTC()
+	if now.After(tokenExpiresAt) || now.After(session.ExpiresAt) {
+		return nil, errs.ErrUnauthorized
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE refresh_tokens
+		SET used_at=$2
+		WHERE id=$1
+	`, tokenID, now)
+	if err != nil {
+		return nil, errs.Wrap("repository.SessionRepository.RotateRefreshToken", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO refresh_tokens (id, session_id, token_hash, created_at, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+	`, next.ID, next.SessionID, next.TokenHash, next.CreatedAt, next.ExpiresAt)
+	if err != nil {
+		return nil, errs.Wrap("repository.SessionRepository.RotateRefreshToken", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE sessions
+		SET last_seen_at=$2, expires_at=$3
+		WHERE id=$1
+	`, session.ID, now, next.ExpiresAt)
+	if err != nil {
+		return nil, errs.Wrap("repository.SessionRepository.RotateRefreshToken", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, errs.Wrap("repository.SessionRepository.RotateRefreshToken", err)
+	}
+
+	session.LastSeenAt = now
+	session.ExpiresAt = next.ExpiresAt
+	return &session, nil
+}
+
+// RevokeSession revokes one session of userID. It returns errs.ErrNotFound
+// if the user has no such active session.
+func (r *SessionRepositoryImpl) RevokeSession(ctx context.Context, sessionID, userID string) error {
+	cmd, err := r.db.Exec(ctx, `
+		UPDATE sessions
+		SET revoked_at=NOW()
+		WHERE id=$1 AND user_id=$2 AND revoked_at IS NULL
+	`, sessionID, userID)
+	if err != nil {
+		return errs.Wrap("repository.SessionRepository.RevokeSession", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return errs.ErrNotFound
+	}
+	return nil
+}
+
+// RevokeUserSessions revokes every active session of userID except
+// exceptSessionID (pass "" to revoke all) and returns the revoked IDs.
+func (r *SessionRepositoryImpl) RevokeUserSessions(ctx context.Context, userID, exceptSessionID string) ([]string, error) {
+	rows, err := r.db.Query(ctx, `
+		UPDATE sessions
+		SET revoked_at=NOW()
+		WHERE user_id=$1
+		  AND revoked_at IS NULL
+		  AND ($2 = '' OR id::text <> $2)
+		RETURNING id
+	`, userID, exceptSessionID)
+	if err != nil {
+		return nil, errs.Wrap("repository.SessionRepository.RevokeUserSessions", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, errs.Wrap("repository.SessionRepository.RevokeUserSessions", err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, errs.Wrap("repository.SessionRepository.RevokeUserSessions", rows.Err())
+}
+
+// ListSessions returns the active (not revoked, not expired) sessions of
+// userID, most recently used first.
+func (r *SessionRepositoryImpl) ListSessions(ctx context.Context, userID string) ([]model.Session, error) {
+	rows, err := r.db.Query(ctx, `
+		SELECT id, user_id, created_at, last_seen_at, expires_at, device_name, user_agent, ip
+		FROM sessions
+		WHERE user_id=$1 AND revoked_at IS NULL AND expires_at > NOW()
+		ORDER BY last_seen_at DESC
+	`, userID)
+	if err != nil {
+		return nil, errs.Wrap("repository.SessionRepository.ListSessions", err)
+	}
+	defer rows.Close()
+
+	sessions := []model.Session{}
+	for rows.Next() {
+		var s model.Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.DeviceName, &s.UserAgent, &s.IP); err != nil {
+			return nil, errs.Wrap("repository.SessionRepository.ListSessions", err)
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, errs.Wrap("repository.SessionRepository.ListSessions", rows.Err())
+}
+
+// IsKnownDevice reports whether userID has signed in with userAgent before.
+// A user without any earlier session has nothing to compare against, so
+// their first device counts as known.
+func (r *SessionRepositoryImpl) IsKnownDevice(ctx context.Context, userID, userAgent string) (bool, error) {
+	var known bool
+	err := r.db.QueryRow(ctx, `
+		SELECT NOT EXISTS (SELECT 1 FROM sessions WHERE user_id=$1)
+			OR EXISTS (SELECT 1 FROM sessions WHERE user_id=$1 AND user_agent=$2)
+	`, userID, userAgent).Scan(&known)
+	return known, errs.Wrap("repository.SessionRepository.IsKnownDevice", err)
+}
@@ -2,18 +2,38 @@ package repository
 
 import (
 	"context"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
 
 	"github.com/ak-repo/go-chat-system/internal/domain/model"
 	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 type UserRepository interface {
-	SearchUser(ctx context.Context, filter string, limit int) (model.UsersDTO, error)
+	SearchUser(ctx context.Context, viewerID, filter string, limit int) (model.UsersDTO, error)
 	CreateUser(ctx context.Context, user *model.User) error
+	CreateInvitedUser(ctx context.Context, user *model.User, codeHash string) error
 	GetByEmail(ctx context.Context, email string) (*model.User, error)
 	GetByID(ctx context.Context, id string) (*model.User, error)
+	GetByHandle(ctx context.Context, handle string) (*model.User, error)
+	IsHandleAvailable(ctx context.Context, handle, userID string) (bool, error)
+	ChangeHandle(ctx context.Context, userID, handle string, reserveUntil time.Time) error
+	MarkVerified(ctx context.Context, id string) error
+	UpdatePassword(ctx context.Context, id, passwordHash string) error
+	RehashPassword(ctx context.Context, id, oldHash, newHash string) error
+	UpdateProfile(ctx context.Context, id string, profile *model.Profile) error
+	UpdatePrivacy(ctx context.Context, id string, privacy *model.PrivacySettings) error
+	TouchLastSeen(ctx context.Context, id string) error
+	UpdateRole(ctx context.Context, id, role string) error
+	IsBot(ctx context.Context, userIDs ...string) (bool, error)
+	SoftDelete(ctx context.Context, id string) error
+	PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error)
 }
 
 type UserRepositoryImpl struct {
@@ -25,63 +45,245 @@ func NewUserRepositoryImpl(db *pgxpool.Pool) *UserRepositoryImpl {
 }
 
 func (r *UserRepositoryImpl) CreateUser(ctx context.Context, user *model.User) error {
+	return r.insertUser(ctx, r.db, user, "repository.UserRepository.CreateUser")
+}
+
+// CreateInvitedUser redeems the invite code with codeHash and creates user
+// in one transaction, so a failed sign-up does not use up the invite. It
+// returns errs.ErrInvalidInvite when the code is unknown, revoked, expired,
+// used up or pinned to another email.
+func (r *UserRepositoryImpl) CreateInvitedUser(ctx context.Context, user *model.User, codeHash string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return errs.Wrap("repository.UserRepository.CreateInvitedUser", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var inviteID string
+	var invitedBy sql.NullString
+	err = tx.QueryRow(ctx, `
+		UPDATE invite_codes
+		SET uses = uses + 1
+		WHERE code_hash=$1
+		  AND revoked_at IS NULL
+		  AND expires_at > NOW()
+		  AND uses < max_uses
+		  AND (email = '' OR lower(email) = lower($2))
+		RETURNING id, created_by
+	`, codeHash, user.Email).Scan(&inviteID, &invitedBy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errs.ErrInvalidInvite
+	}
+	if err != nil {
+		return errs.Wrap("repository.UserRepository.CreateInvitedUser", err)
+	}
+
+	if err := r.insertUser(ctx, tx, user, "repository.UserRepository.CreateInvitedUser"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE users SET invited_by=$2, invite_id=$3 WHERE id=$1
+	`, user.ID, invitedBy, inviteID); err != nil {
+		return errs.Wrap("repository.UserRepository.CreateInvitedUser", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return errs.Wrap("repository.UserRepository.CreateInvitedUser", err)
+	}
+	user.InvitedBy = invitedBy.String
+	return nil
+}
+
+type execer interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+}
+
+func (r *UserRepositoryImpl) insertUser(ctx context.Context, db execer, user *model.User, op string) error {
 	q := `
 		INSERT INTO users (
 			id, username, email, password_hash, role, created_at, modified_at
 		) VALUES ($1, $2, $3, $4, $5, $6, $7)
 
 	`
-	_, err := r.db.Exec(ctx, q, user.ID, user.Username, user.Email, user.PasswordHash, user.Role, user.CreatedAt, user.ModifiedAt)
+	_, err := db.Exec(ctx, q, user.ID, user.Username, user.Email, user.PasswordHash, user.Role, user.CreatedAt, user.ModifiedAt)
 	if err != nil {
-		return errs.Wrap("repository.UserRepository.CreateUser", err)
+		if utils.IsUniqueViolationOn(err, "users_username_lower_key") {
+			return errs.ErrHandleTaken
+		}
+		if utils.IsUniqueViolation(err) {
+			return errs.Wrap(op, errs.ErrConflict)
+		}
+		return errs.Wrap(op, err)
 	}
 
 	return nil
 }
 
-func (r *UserRepositoryImpl) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+// userColumns is the column list scanned by scanUser
+const userColumns = `
+	id, username, email, password_hash, role, verified_at, username_changed_at,
+	display_name, bio, avatar_url, status_text, status_emoji, timezone,
+	discoverability, email_searchable, friend_requests_from, presence_visibility, last_seen_at,
+	COALESCE(invited_by::text, '')`
 
+func scanUser(row pgx.Row) (*model.User, error) {
 	var user model.User
-	query := `
-		SELECT id, username, email, password_hash, role
-		FROM users
-		WHERE email = $1
-	`
-
-	err := r.db.QueryRow(ctx, query, email).
-		Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.Role)
-
+	err := row.Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.Role, &user.VerifiedAt, &user.UsernameChangedAt,
+		&user.DisplayName, &user.Bio, &user.AvatarURL, &user.StatusText, &user.StatusEmoji, &user.Timezone,
+		&user.Privacy.Discoverability, &user.Privacy.EmailSearchable, &user.Privacy.FriendRequests, &user.Privacy.Presence, &user.LastSeenAt,
+		&user.InvitedBy)
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			return nil, nil
 		}
-		return nil, errs.Wrap("repository.UserRepository.GetByEmail", err)
+		return nil, err
 	}
 	return &user, nil
 }
 
+func (r *UserRepositoryImpl) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE email = $1 AND deleted_at IS NULL
+	`, email)
+
+	user, err := scanUser(row)
+	return user, errs.Wrap("repository.UserRepository.GetByEmail", err)
+}
+
 func (r *UserRepositoryImpl) GetByID(ctx context.Context, id string) (*model.User, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT `+userColumns+`
+		FROM users
+		WHERE id = $1 AND deleted_at IS NULL
+	`, id)
 
-	var user model.User
-	query := `
-		SELECT id, username, email, password_hash, role
+	user, err := scanUser(row)
+	return user, errs.Wrap("repository.UserRepository.GetByID", err)
+}
+
+// GetByHandle looks a user up by handle, ignoring case.
+func (r *UserRepositoryImpl) GetByHandle(ctx context.Context, handle string) (*model.User, error) {
+	row := r.db.QueryRow(ctx, `
+		SELECT `+userColumns+`
 		FROM users
-		WHERE id = $1
-	`
+		WHERE lower(username) = lower($1) AND deleted_at IS NULL
+	`, handle)
 
-	err := r.db.QueryRow(ctx, query, id).
-		Scan(&user.ID, &user.Username, &user.Email, &user.PasswordHash, &user.Role)
+	user, err := scanUser(row)
+	return user, errs.Wrap("repository.UserRepository.GetByHandle", err)
+}
 
+// IsHandleAvailable reports whether userID (or a new user, if "") may take
+// handle: no other account uses it, deleted or not, and it is not reserved
+// for someone else after a rename.
+func (r *UserRepositoryImpl) IsHandleAvailable(ctx context.Context, handle, userID string) (bool, error) {
+	var taken bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM users
+			WHERE lower(username) = lower($1) AND id::text <> $2
+		) OR EXISTS (
+			SELECT 1 FROM reserved_handles
+			WHERE handle_lower = lower($1) AND user_id::text <> $2 AND reserved_until > NOW()
+		)
+	`, handle, userID).Scan(&taken)
 	if err != nil {
-		if err == pgx.ErrNoRows {
-			return nil, nil
+		return false, errs.Wrap("repository.UserRepository.IsHandleAvailable", err)
+	}
+	return !taken, nil
+}
+
+// ChangeHandle renames userID and reserves the previous handle for them
+// until reserveUntil. A concurrent claim of the new handle returns
+// errs.ErrHandleTaken.
+func (r *UserRepositoryImpl) ChangeHandle(ctx context.Context, userID, handle string, reserveUntil time.Time) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return errs.Wrap("repository.UserRepository.ChangeHandle", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var previous string
+	err = tx.QueryRow(ctx, `
+		SELECT username
+		FROM users
+		WHERE id=$1 AND deleted_at IS NULL
+		FOR UPDATE
+	`, userID).Scan(&previous)
+	if err == pgx.ErrNoRows {
+		return errs.ErrNotFound
+	}
+	if err != nil {
+		return errs.Wrap("repository.UserRepository.ChangeHandle", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM reserved_handles
+		WHERE handle_lower = lower($1) AND (user_id=$2 OR reserved_until <= NOW())
+	`, handle, userID)
+	if err != nil {
+		return errs.Wrap("repository.UserRepository.ChangeHandle", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE users
+		SET username=$2, username_changed_at=NOW(), modified_at=NOW()
+		WHERE id=$1
+	`, userID, handle)
+	if err != nil {
+		if utils.IsUniqueViolation(err) {
+			return errs.ErrHandleTaken
 		}
-		return nil, errs.Wrap("repository.UserRepository.GetByID", err)
+		return errs.Wrap("repository.UserRepository.ChangeHandle", err)
 	}
-	return &user, nil
+
+	// A case-only change keeps the same handle, nothing to reserve
+	if !strings.EqualFold(previous, handle) {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO reserved_handles (handle_lower, user_id, reserved_until)
+			VALUES (lower($1), $2, $3)
+			ON CONFLICT (handle_lower) DO UPDATE
+			SET user_id=EXCLUDED.user_id, reserved_until=EXCLUDED.reserved_until
+		`, previous, userID, reserveUntil)
+		if err != nil {
+			return errs.Wrap("repository.UserRepository.ChangeHandle", err)
+		}
+	}
+
+	return errs.Wrap("repository.UserRepository.ChangeHandle", tx.Commit(ctx))
+}
+
+func (r *UserRepositoryImpl) MarkVerified(ctx context.Context, id string) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE users
+		SET verified_at=NOW(), modified_at=NOW()
+		WHERE id=$1 AND verified_at IS NULL
+	`, id)
+	return errs.Wrap("repository.UserRepository.MarkVerified", err)
+}
+
+func (r *UserRepositoryImpl) UpdatePassword(ctx context.Context, id, passwordHash string) error {
+	cmd, err := r.db.Exec(ctx, `
+		UPDATE users
+		SET password_hash=$2, modified_at=NOW()
+		WHERE id=$1 AND deleted_at IS NULL
+	`, id, passwordHash)
+	if err != nil {
+		return errs.Wrap("repository.UserRepository.UpdatePassword", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return errs.ErrNotFound
+	}
+	return nil
 }
 
-func (r *UserRepositoryImpl) SearchUser(ctx context.Context, filter string, limit int) (model.UsersDTO, error) {
+// SearchUser finds users by handle, or by full email address for users who
+// allow it, among those whose discoverability setting admits viewerID.
+// Emails are only returned to a searcher who already typed them, and users
+// the searcher blocked are marked.
+func (r *UserRepositoryImpl) SearchUser(ctx context.Context, viewerID, filter string, limit int) (model.UsersDTO, error) {
 
 	if limit <= 0 {
 		limit = 20
@@ -93,7 +295,28 @@ func (r *UserRepositoryImpl) SearchUser(ctx context.Context, filter string, limi
 	}
 
 	var resp model.UsersDTO
-	rows, err := r.db.Query(ctx, "SELECT id, username, email FROM users WHERE username ILIKE $1 OR email ILIKE $1 LIMIT $2", "%"+filter+"%", limit)
+	rows, err := r.db.Query(ctx, `
+		SELECT u.id, u.username,
+			   CASE WHEN u.email_searchable AND lower(u.email) = lower($2) THEN u.email ELSE '' END,
+			   EXISTS (SELECT 1 FROM blocks b WHERE b.blocker_id = $1 AND b.blocked_id = u.id)
+		FROM users u
+		WHERE u.deleted_at IS NULL
+		  AND u.id <> $1
+		  AND (u.username ILIKE $3 OR (u.email_searchable AND lower(u.email) = lower($2)))
+		  AND (
+			u.discoverability = 'everyone'
+			OR (u.discoverability = 'friends_of_friends' AND (
+				EXISTS (SELECT 1 FROM friends f WHERE f.user_id = $1 AND f.friend_id = u.id)
+				OR EXISTS (
+					SELECT 1 FROM friends f1
+					JOIN friends f2 ON f2.user_id = f1.friend_id
+					WHERE f1.user_id = $1 AND f2.friend_id = u.id
+				)
+			))
+		  )
+		ORDER BY u.username
+		LIMIT $4
+	`, viewerID, filter, "%"+filter+"%", limit)
 	if err != nil {
 		return nil, errs.Wrap("repository.UserRepository.SearchUser", err)
 	}
@@ -101,7 +324,7 @@ func (r *UserRepositoryImpl) SearchUser(ctx context.Context, filter string, limi
 
 	for rows.Next() {
 		var user model.UserDTO
-		if err := rows.Scan(&user.ID, &user.Username, &user.Email); err != nil {
+		if err := rows.Scan(&user.ID, &user.Username, &user.Email, &user.Blocked); err != nil {
 			return nil, errs.Wrap("repository.UserRepository.SearchUser", err)
 		}
 		resp = append(resp, &user)
@@ -109,3 +332,193 @@ func (r *UserRepositoryImpl) SearchUser(ctx context.Context, filter string, limi
 
 	return resp, errs.Wrap("repository.UserRepository.SearchUser", rows.Err())
 }
+
+// RehashPassword replaces the stored hash of the same password with one
+// made by the current hashing settings. It does nothing if the password was
+// changed in the meantime.
+func (r *UserRepositoryImpl) RehashPassword(ctx context.Context, id, oldHash, newHash string) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE users
+		SET password_hash=$3
+		WHERE id=$1 AND password_hash=$2 AND deleted_at IS NULL
+	`, id, oldHash, newHash)
+	return errs.Wrap("repository.UserRepository.RehashPassword", err)
+}
+
+func (r *UserRepositoryImpl) UpdateProfile(ctx context.Context, id string, profile *model.Profile) error {
+	cmd, err := r.db.Exec(ctx, `
+		UPDATE users
+		SET display_name=$2, bio=$3, avatar_url=$4, status_text=$5, status_emoji=$6, timezone=$7,
+			modified_at=NOW()
+		WHERE id=$1 AND deleted_at IS NULL
+	`, id, profile.DisplayName, profile.Bio, profile.AvatarURL, profile.StatusText, profile.StatusEmoji, profile.Timezone)
+	if err != nil {
+		return errs.Wrap("repository.UserRepository.UpdateProfile", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return errs.ErrNotFound
+	}
+	return nil
+}
+
+func (r *UserRepositoryImpl) UpdatePrivacy(ctx context.Context, id string, privacy *model.PrivacySettings) error {
+	cmd, err := r.db.Exec(ctx, `
+		UPDATE users
+		SET discoverability=$2, email_searchable=$3, friend_requests_from=$4, presence_visibility=$5,
+			modified_at=NOW()
+		WHERE id=$1 AND deleted_at IS NULL
+	`, id, string(privacy.Discoverability), privacy.EmailSearchable, string(privacy.FriendRequests), string(privacy.Presence))
+	if err != nil {
+		return errs.Wrap("repository.UserRepository.UpdatePrivacy", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return errs.ErrNotFound
+	}
+	return nil
+}
+
+// TouchLastSeen records that the user was just connected.
+func (r *UserRepositoryImpl) TouchLastSeen(ctx context.Context, id string) error {
+	_, err := r.db.Exec(ctx, `
+		UPDATE users
+		SET last_seen_at=NOW()
+		WHERE id=$1
+	`, id)
+	return errs.Wrap("repository.UserRepository.TouchLastSeen", err)
+}
+
+func (r *UserRepositoryImpl) UpdateRole(ctx context.Context, id, role string) error {
+	cmd, err := r.db.Exec(ctx, `
+		UPDATE users
+		SET role=$2, modified_at=NOW()
+		WHERE id=$1 AND deleted_at IS NULL AND role <> 'bot'
+	`, id, role)
+	if err != nil {
+		return errs.Wrap("repository.UserRepository.UpdateRole", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return errs.ErrNotFound
+	}
+	return nil
+}
+
+// IsBot reports whether any of userIDs is a bot account.
+func (r *UserRepositoryImpl) IsBot(ctx context.Context, userIDs ...string) (bool, error) {
+	var isBot bool
+	err := r.db.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM users
+			WHERE id = ANY($1::uuid[]) AND role='bot' AND deleted_at IS NULL
+		)
+	`, userIDs).Scan(&isBot)
+	if err != nil {
+		return false, errs.Wrap("repository.UserRepository.IsBot", err)
+	}
+	return isBot, nil
+}
+
+// SoftDelete marks the account deleted and, in the same transaction, drops
+// its friendships and pending friend requests in both directions.
+func (r *UserRepositoryImpl) SoftDelete(ctx context.Context, id string) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return errs.Wrap("repository.UserRepository.SoftDelete", err)
+	}
+	defer tx.Rollback(ctx)
+
+	cmd, err := tx.Exec(ctx, `
+		UPDATE users
+		SET deleted_at=NOW(), modified_at=NOW()
+		WHERE id=$1 AND deleted_at IS NULL
+	`, id)
+	if err != nil {
+		return errs.Wrap("repository.UserRepository.SoftDelete", err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return errs.ErrNotFound
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM friends
+		WHERE user_id=$1 OR friend_id=$1
+	`, id)
+	if err != nil {
+		return errs.Wrap("repository.UserRepository.SoftDelete", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM friend_requests
+		WHERE (sender_id=$1 OR receiver_id=$1) AND status='pending'
+	`, id)
+	if err != nil {
+		return errs.Wrap("repository.UserRepository.SoftDelete", err)
+	}
+
+	return errs.Wrap("repository.UserRepository.SoftDelete", tx.Commit(ctx))
+}
+
+// PurgeDeleted anonymizes accounts soft-deleted before deletedBefore. The user
+// row stays so message history keeps its foreign keys; personal data, auth
+// state and blocks are removed. Returns the number of purged accounts.
+func (r *UserRepositoryImpl) PurgeDeleted(ctx context.Context, deletedBefore time.Time) (int64, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return 0, errs.Wrap("repository.UserRepository.PurgeDeleted", err)
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		UPDATE users
+		SET username='deleted-' || id::text,
+			email='deleted-' || id::text || '@deleted.invalid',
+			password_hash='',
+			display_name='', bio='', avatar_url='', status_text='', status_emoji='', timezone='',
+			verified_at=NULL, last_seen_at=NULL,
+			purged_at=NOW(),
+			modified_at=NOW()
+		WHERE deleted_at < $1 AND purged_at IS NULL
+		RETURNING id
+	`, deletedBefore)
+	if err != nil {
+		return 0, errs.Wrap("repository.UserRepository.PurgeDeleted", err)
+	}
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, errs.Wrap("repository.UserRepository.PurgeDeleted", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, errs.Wrap("repository.UserRepository.PurgeDeleted", err)
+	}
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	for _, q := range []string{
+		`DELETE FROM sessions WHERE user_id = ANY($1::uuid[])`,
+		`DELETE FROM verification_codes WHERE user_id = ANY($1::uuid[])`,
+		`DELETE FROM user_mfa WHERE user_id = ANY($1::uuid[])`,
+		`DELETE FROM mfa_recovery_codes WHERE user_id = ANY($1::uuid[])`,
+		`DELETE FROM security_events WHERE user_id = ANY($1::uuid[])`,
+		`DELETE FROM user_identities WHERE user_id = ANY($1::uuid[])`,
+		`DELETE FROM blocks WHERE blocker_id = ANY($1::uuid[]) OR blocked_id = ANY($1::uuid[])`,
+		`DELETE FROM friend_requests WHERE sender_id = ANY($1::uuid[]) OR receiver_id = ANY($1::uuid[])`,
+		// Archives are removed by the export sweeper once they have expired
+		`UPDATE data_exports SET expires_at=NOW(), download_token_hash=NULL WHERE user_id = ANY($1::uuid[]) AND status='ready'`,
+		`UPDATE data_exports SET status='failed' WHERE user_id = ANY($1::uuid[]) AND status IN ('pending', 'running')`,
+	} {
+		if _, err := tx.Exec(ctx, q, ids); err != nil {
+			return 0, errs.Wrap("repository.UserRepository.PurgeDeleted", err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, errs.Wrap("repository.UserRepository.PurgeDeleted", err)
+	}
+	return int64(len(ids)), nil
+}
@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type VerificationRepository interface {
+	CreateCode(ctx context.Context, code *model.VerificationCode) error
+	ConsumeCode(ctx context.Context, userID string, purpose model.VerificationPurpose, codeHash string, maxAttempts int) (bool, error)
+}
+
+type VerificationRepositoryImpl struct {
+	db *pgxpool.Pool
+}
+
+func NewVerificationRepositoryImpl(db *pgxpool.Pool) *VerificationRepositoryImpl {
+	return &VerificationRepositoryImpl{db: db}
+}
+
+// CreateCode stores a new code and invalidates any earlier unused code
+// for the same user and purpose, so only the latest email works.
+func (r *VerificationRepositoryImpl) CreateCode(ctx context.Context, code *model.VerificationCode) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return errs.Wrap("repository.VerificationRepository.CreateCode", err)
+	}
+	defer tx.Rollback(ctx)
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM verification_codes
+		WHERE user_id=$1 AND purpose=$2 AND used_at IS NULL
+	`, code.UserID, code.Purpose)
+	if err != nil {
+		return errs.Wrap("repository.VerificationRepository.CreateCode", err)
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO verification_codes (id, user_id, purpose, code_hash, expires_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, code.ID, code.UserID, code.Purpose, code.CodeHash, code.ExpiresAt, code.CreatedAt)
+	if err != nil {
+		return errs.Wrap("repository.VerificationRepository.CreateCode", err)
+	}
+
+	return errs.Wrap("repository.VerificationRepository.CreateCode", tx.Commit(ctx))
+}
+
+// ConsumeCode checks codeHash against the active code of userID and marks it
+// used on a match. Wrong guesses count towards maxAttempts, after which the
+// code stops working even if the right value is presented.
+func (r *VerificationRepositoryImpl) ConsumeCode(ctx context.Context, userID string, purpose model.VerificationPurpose, codeHash string, maxAttempts int) (bool, error) {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return false, errs.Wrap("repository.VerificationRepository.ConsumeCode", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var code model.VerificationCode
+	err = tx.QueryRow(ctx, `
+		SELECT id, code_hash, attempts, expires_at
+		FROM verification_codes
+		WHERE user_id=$1 AND purpose=$2 AND used_at IS NULL
+		ORDER BY created_at DESC
+		LIMIT 1
+		FOR UPDATE
+	`, userID, purpose).Scan(&code.ID, &code.CodeHash, &code.Attempts, &code.ExpiresAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, errs.Wrap("repository.VerificationRepository.ConsumeCode", err)
+	}
+
+	if code.Attempts >= maxAttempts || time.Now().After(code.ExpiresAt) {
+		return false, nil
+	}
+
+	if subtle.ConstantTimeCompare([]byte(code.CodeHash), []byte(codeHash)) != 1 {
+		_, err = tx.Exec(ctx, `
+			UPDATE verification_codes
+			SET attempts = attempts + 1
+			WHERE id=$1
+		`, code.ID)
+		if err != nil {
+			return false, errs.Wrap("repository.VerificationRepository.ConsumeCode", err)
+		}
+		return false, errs.Wrap("repository.VerificationRepository.ConsumeCode", tx.Commit(ctx))
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE verification_codes
+		SET used_at=NOW()
+		WHERE id=$1
+	`, code.ID)
+	if err != nil {
+		return false, errs.Wrap("repository.VerificationRepository.ConsumeCode", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return false, errs.Wrap("repository.VerificationRepository.ConsumeCode", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,73 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/repository"
+	"github.com/ak-repo/go-chat-system/internal/shared/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultDeletionGracePeriod = 30 * 24 * time.Hour
+	defaultPurgeInterval       = time.Hour
+)
+
+// AccountPurger periodically anonymizes accounts whose deletion grace
+// period has passed.
+type AccountPurger struct {
+	userRepo    repository.UserRepository
+	gracePeriod time.Duration
+	interval    time.Duration
+	quit        chan struct{}
+}
+
+func NewAccountPurger(userRepo repository.UserRepository, gracePeriod, interval time.Duration) *AccountPurger {
+	if gracePeriod <= 0 {
+		gracePeriod = defaultDeletionGracePeriod
+	}
+	if interval <= 0 {
+		interval = defaultPurgeInterval
+	}
+	return &AccountPurger{
+		userRepo:    userRepo,
+		gracePeriod: gracePeriod,
+		interval:    interval,
+		quit:        make(chan struct{}),
+	}
+}
+
+func (p *AccountPurger) Run() {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.PurgeOnce()
+
+		select {
+		case <-p.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *AccountPurger) Stop() {
+	close(p.quit)
+}
+
+// PurgeOnce runs a single purge pass.
+func (p *AccountPurger) PurgeOnce() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	n, err := p.userRepo.PurgeDeleted(ctx, time.Now().Add(-p.gracePeriod))
+	if err != nil {
+		logger.L().Error("account purge failed", zap.Error(err))
+		return
+	}
+	if n > 0 {
+		logger.L().Info("purged deleted accounts", zap.Int64("count", n))
+	}
+}
@@ -1,26 +1,88 @@
 package service
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
 	"github.com/ak-repo/go-chat-system/internal/repository"
 	"github.com/ak-repo/go-chat-system/internal/shared/errs"
 	"github.com/ak-repo/go-chat-system/internal/shared/utils"
 	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/google/uuid"
 )
 
+const maxBlockReasonLength = 500
+
 type BlockService interface {
+	ListBlocks(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
 	UnblockUser(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
 	BlockUser(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
 }
 
 type BlockServiceImpl struct {
-	repo repository.BlockRepository
+	repo      repository.BlockRepository
+	cache     repository.FriendCache
+	publisher EventPublisher
+}
+
+func BlockServiceInit(repo repository.BlockRepository, cache repository.FriendCache, publisher EventPublisher) *BlockServiceImpl {
+	return &BlockServiceImpl{repo: repo, cache: cache, publisher: publisher}
 }
 
-func BlockServiceInit(repo repository.BlockRepository) *BlockServiceImpl {
-	return &BlockServiceImpl{repo: repo}
+// publish pushes a relationship change to the live connections of userIDs.
+func (s *BlockServiceImpl) publish(event, senderID string, payload any, userIDs ...string) {
+	if s.publisher != nil {
+		s.publisher.Publish(event, senderID, payload, userIDs...)
+	}
+}
+
+// GET -> users the caller blocked, newest first. Pass next_cursor of a page
+// as ?cursor= to get the next one; it is empty on the last page.
+func (s *BlockServiceImpl) ListBlocks(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+
+	var after *model.BlockCursor
+	if cursor := r.URL.Query().Get("cursor"); cursor != "" {
+		var ok bool
+		if after, ok = decodeBlockCursor(cursor); !ok {
+			return http.StatusBadRequest, nil, errs.ErrValidation
+		}
+	}
+
+	// One extra row tells whether another page follows
+	blocks, err := s.repo.ListBlocks(r.Context(), userID, after, limit+1)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.BlockService.ListBlocks", err)
+	}
+
+	nextCursor := ""
+	if len(blocks) > limit {
+		blocks = blocks[:limit]
+		last := blocks[limit-1]
+		nextCursor = encodeBlockCursor(&model.BlockCursor{CreatedAt: last.CreatedAt, BlockedID: last.BlockedID})
+	}
+
+	responseData := map[string]any{
+		"blocks":      blocks,
+		"next_cursor": nextCursor,
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
 }
 
 // POST
@@ -28,11 +90,13 @@ func (s *BlockServiceImpl) BlockUser(w http.ResponseWriter, r *http.Request) (in
 
 	var body struct {
 		Target string `json:"target"`
+		Reason string `json:"reason"` // optional, only ever shown to the blocker
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		return http.StatusBadRequest, nil, errs.Wrap("service.BlockService.BlockUser", err)
 	}
+	body.Reason = strings.TrimSpace(body.Reason)
 
 	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
 	if !ok || userID == "" {
@@ -42,14 +106,29 @@ func (s *BlockServiceImpl) BlockUser(w http.ResponseWriter, r *http.Request) (in
 		return http.StatusBadRequest, nil, errs.ErrBadRequest
 	}
 
+	if utf8.RuneCountInString(body.Reason) > maxBlockReasonLength {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+
 	if userID == body.Target {
 		return http.StatusConflict, nil, errs.ErrSelfAction
 	}
 
-	if err := s.repo.BlockUser(r.Context(), userID, body.Target); err != nil {
+	unfriended, err := s.repo.BlockUser(r.Context(), userID, body.Target, body.Reason)
+	if err != nil {
 		return http.StatusInternalServerError, nil, errs.Wrap("service.BlockService.BlockUser", err)
 	}
 
+	invalidateSuggestions(r.Context(), s.cache, userID, body.Target)
+
+	// The blocked user is not told about the block itself, only that the
+	// friendship ended, exactly as if they had been unfriended
+	s.publish("user_blocked", userID, map[string]string{"user_id": body.Target}, userID)
+	if unfriended {
+		s.publish("friend_removed", userID, map[string]string{"user_id": userID}, body.Target)
+		s.publish("friend_removed", userID, map[string]string{"user_id": body.Target}, userID)
+	}
+
 	return http.StatusOK, nil, nil
 
 }
@@ -74,5 +153,33 @@ func (s *BlockServiceImpl) UnblockUser(w http.ResponseWriter, r *http.Request) (
 	if err := s.repo.UnblockUser(r.Context(), userID, body.Target); err != nil {
 		return http.StatusInternalServerError, nil, errs.Wrap("service.BlockService.UnblockUser", err)
 	}
+
+	invalidateSuggestions(r.Context(), s.cache, userID, body.Target)
+	s.publish("user_unblocked", userID, map[string]string{"user_id": body.Target}, userID)
 	return http.StatusOK, nil, nil
 }
+
+// encodeBlockCursor makes an opaque page token out of the last block shown.
+func encodeBlockCursor(c *model.BlockCursor) string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.BlockedID
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeBlockCursor(cursor string) (*model.BlockCursor, bool) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, false
+	}
+	ts, id, found := strings.Cut(string(raw), "|")
+	if !found {
+		return nil, false
+	}
+	createdAt, err := time.Parse(time.RFC3339Nano, ts)
+	if err != nil {
+		return nil, false
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return nil, false
+	}
+	return &model.BlockCursor{CreatedAt: createdAt, BlockedID: id}, true
+}
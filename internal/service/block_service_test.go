@@ -0,0 +1,83 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/google/uuid"
+)
+
+func TestBlockUserPublishesRelationshipChanges(t *testing.T) {
+	for _, friends := range []bool{false, true} {
+		publisher := &fakePublisher{}
+		service := BlockServiceInit(fakeBlockRepo{unfriended: friends}, nil, publisher)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/blocks", bytes.NewBufferString(`{"target":"user-2"}`))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+		if status, _, err := service.BlockUser(httptest.NewRecorder(), req); err != nil || status != http.StatusOK {
+			t.Fatalf("expected block, got %d %v", status, err)
+		}
+
+		got := fmt.Sprint(publisher.sent)
+		want := "[{user_blocked map[user_id:user-2] [user-1]}]"
+		if friends {
+			want = "[{user_blocked map[user_id:user-2] [user-1]} {friend_removed map[user_id:user-1] [user-2]} {friend_removed map[user_id:user-2] [user-1]}]"
+		}
+		if got != want {
+			t.Fatalf("friends=%v: expected %s, got %s", friends, want, got)
+		}
+	}
+}
+
+func TestListBlocksPagesWithCursor(t *testing.T) {
+	now := time.Now().UTC()
+	var blocks model.BlocksDTO
+	for i := 0; i < 3; i++ {
+		blocks = append(blocks, &model.BlockDTO{BlockedID: uuid.NewString(), BlockedName: fmt.Sprint("user", i), CreatedAt: now.Add(-time.Duration(i) * time.Hour)})
+	}
+	service := BlockServiceInit(fakeBlockRepo{blocks: blocks}, nil, nil)
+
+	list := func(query string) (int, map[string]any) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/blocks?"+query, nil)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+		status, resp, _ := service.ListBlocks(httptest.NewRecorder(), req)
+		if resp == nil {
+			return status, nil
+		}
+		return status, resp.Data.(map[string]any)
+	}
+
+	status, data := list("limit=2")
+	if status != http.StatusOK || len(data["blocks"].(model.BlocksDTO)) != 2 || data["next_cursor"] == "" {
+		t.Fatalf("expected a first page with a cursor, got %d %#v", status, data)
+	}
+
+	status, data = list("limit=2&cursor=" + data["next_cursor"].(string))
+	page := data["blocks"].(model.BlocksDTO)
+	if status != http.StatusOK || len(page) != 1 || page[0].BlockedName != "user2" || data["next_cursor"] != "" {
+		t.Fatalf("expected the last block and no cursor, got %d %#v", status, data)
+	}
+
+	if status, _ := list("cursor=bogus"); status != http.StatusBadRequest {
+		t.Fatalf("expected an invalid cursor to be rejected, got %d", status)
+	}
+}
+
+func TestBlockUserLimitsReasonLength(t *testing.T) {
+	service := BlockServiceInit(fakeBlockRepo{}, nil, nil)
+
+	body := fmt.Sprintf(`{"target":"user-2","reason":%q}`, strings.Repeat("x", maxBlockReasonLength+1))
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/blocks", bytes.NewBufferString(body))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+	if status, _, _ := service.BlockUser(httptest.NewRecorder(), req); status != http.StatusBadRequest {
+		t.Fatalf("expected an overlong reason to be rejected, got %d", status)
+	}
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/repository"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/logger"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	apiKeyPrefix        = "bot_"
+	apiKeyPrefixShown   = 12 // "bot_" plus 8 characters, to tell keys apart
+	maxAPIKeyNameLength = 100
+)
+
+// BotService manages bot accounts and their API keys (admin only).
+type BotService interface {
+	CreateBot(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	ListKeys(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	CreateKey(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	RevokeKey(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+}
+
+type BotServiceImpl struct {
+	userRepo     repository.UserRepository
+	apiKeyRepo   repository.APIKeyRepository
+	disconnector SessionDisconnector
+}
+
+func NewBotServiceImpl(userRepo repository.UserRepository, apiKeyRepo repository.APIKeyRepository, disconnector SessionDisconnector) *BotServiceImpl {
+	return &BotServiceImpl{userRepo: userRepo, apiKeyRepo: apiKeyRepo, disconnector: disconnector}
+}
+
+// apiKeySessionID stands in for the session of WebSocket connections opened
+// with a bot API key, so revoking the key can drop them.
+func apiKeySessionID(keyID string) string {
+	return "apikey:" + keyID
+}
+
+// POST -> creates a bot account. Bots have no password and no reachable
+// email; they authenticate with API keys only.
+func (s *BotServiceImpl) CreateBot(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	var req struct {
+		Username    string `json:"username"`
+		DisplayName string `json:"display_name"`
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.BotService.CreateBot", err)
+	}
+
+	if !utils.ValidateHandle(req.Username) {
+		return http.StatusBadRequest, nil, errs.ErrInvalidHandle
+	}
+	req.DisplayName = strings.TrimSpace(req.DisplayName)
+	if !utils.MaxLength(req.DisplayName, maxDisplayNameLength) {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	now := time.Now().UTC()
+	id := uuid.New().String()
+	bot := &model.User{
+		ID:         id,
+		Username:   req.Username,
+		Email:      id + "@bots.invalid",
+		Role:       string(model.RoleBot),
+		CreatedAt:  now,
+		ModifiedAt: now,
+	}
+
+	if err := s.userRepo.CreateUser(ctx, bot); err != nil {
+		if errs.Is(err, errs.ErrHandleTaken) {
+			return http.StatusConflict, nil, errs.ErrHandleTaken
+		}
+		return http.StatusInternalServerError, nil, errs.Wrap("service.BotService.CreateBot", err)
+	}
+	if req.DisplayName != "" {
+		bot.DisplayName = req.DisplayName
+		if err := s.userRepo.UpdateProfile(ctx, bot.ID, &bot.Profile); err != nil {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.BotService.CreateBot", err)
+		}
+	}
+
+	responseData := map[string]any{
+		"bot": toProfileDTO(bot),
+	}
+	return http.StatusCreated, utils.SuccessResponse(responseData), nil
+}
+
+// GET -> active keys of a bot (without the keys themselves)
+func (s *BotServiceImpl) ListKeys(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	botID, status, err := s.botFromURL(ctx, r)
+	if err != nil {
+		return status, nil, errs.Wrap("service.BotService.ListKeys", err)
+	}
+
+	keys, err := s.apiKeyRepo.ListKeys(ctx, botID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.BotService.ListKeys", err)
+	}
+
+	responseData := map[string]any{
+		"keys": keys,
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// POST -> new API key for a bot. The key is only ever returned here.
+func (s *BotServiceImpl) CreateKey(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || adminID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	var req struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.BotService.CreateKey", err)
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if !utils.Required(req.Name) || !utils.MaxLength(req.Name, maxAPIKeyNameLength) || len(req.Scopes) == 0 {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+	for _, scope := range req.Scopes {
+		if !model.ValidBotScope(scope) {
+			return http.StatusBadRequest, nil, errs.ErrValidation
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	botID, status, err := s.botFromURL(ctx, r)
+	if err != nil {
+		return status, nil, errs.Wrap("service.BotService.CreateKey", err)
+	}
+
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.BotService.CreateKey", err)
+	}
+	key := apiKeyPrefix + secret
+
+	apiKey := &model.APIKey{
+		ID:        uuid.New().String(),
+		BotID:     botID,
+		Name:      req.Name,
+		Prefix:    key[:apiKeyPrefixShown],
+		KeyHash:   utils.HashToken(key),
+		Scopes:    req.Scopes,
+		CreatedBy: adminID,
+	}
+	if err := s.apiKeyRepo.CreateKey(ctx, apiKey); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.BotService.CreateKey", err)
+	}
+
+	logger.L().Info("api key created",
+		zap.String("admin_id", adminID),
+		zap.String("bot_id", botID),
+		zap.String("key_id", apiKey.ID),
+		zap.Strings("scopes", apiKey.Scopes),
+	)
+
+	responseData := map[string]any{
+		"key":     key,
+		"api_key": apiKey,
+	}
+	return http.StatusCreated, utils.SuccessResponse(responseData), nil
+}
+
+// DELETE -> revokes a key; requests with it fail right away and its
+// WebSocket connections are closed
+func (s *BotServiceImpl) RevokeKey(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	keyID := chi.URLParam(r, "keyID")
+	if _, err := uuid.Parse(keyID); err != nil {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	botID, status, err := s.botFromURL(ctx, r)
+	if err != nil {
+		return status, nil, errs.Wrap("service.BotService.RevokeKey", err)
+	}
+
+	if err := s.apiKeyRepo.RevokeKey(ctx, botID, keyID); err != nil {
+		if errs.Is(err, errs.ErrNotFound) {
+			return http.StatusNotFound, nil, errs.ErrNotFound
+		}
+		return http.StatusInternalServerError, nil, errs.Wrap("service.BotService.RevokeKey", err)
+	}
+	if s.disconnector != nil {
+		s.disconnector.DisconnectSessions(apiKeySessionID(keyID))
+	}
+	return http.StatusOK, nil, nil
+}
+
+// botFromURL resolves the {id} URL parameter to an existing bot.
+func (s *BotServiceImpl) botFromURL(ctx context.Context, r *http.Request) (string, int, error) {
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		return "", http.StatusNotFound, errs.ErrNotFound
+	}
+
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return "", http.StatusInternalServerError, err
+	}
+	if user == nil || user.Role != string(model.RoleBot) {
+		return "", http.StatusNotFound, errs.ErrNotFound
+	}
+	return user.ID, http.StatusOK, nil
+}
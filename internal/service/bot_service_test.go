@@ -0,0 +1,114 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/go-chi/chi"
+)
+
+type fakeAPIKeyRepo struct {
+	created *model.APIKey
+}
+
+func (f *fakeAPIKeyRepo) CreateKey(_ context.Context, key *model.APIKey) error {
+	f.created = key
+	return nil
+}
+
+func (f *fakeAPIKeyRepo) ListKeys(context.Context, string) ([]*model.APIKey, error) { return nil, nil }
+
+func (f *fakeAPIKeyRepo) RevokeKey(context.Context, string, string) error { return nil }
+
+func (f *fakeAPIKeyRepo) Authenticate(context.Context, string) (*model.APIKey, error) {
+	return nil, nil
+}
+
+type fakeDisconnector struct {
+	sessionIDs []string
+}
+
+func (f *fakeDisconnector) DisconnectSessions(sessionIDs ...string) {
+	f.sessionIDs = append(f.sessionIDs, sessionIDs...)
+}
+
+func TestCreateKeyReturnsKeyOnceAndStoresHash(t *testing.T) {
+	const botID = "0b6a1c52-8f0e-4c8e-9a43-6f2d1e7b9c10"
+	users := &fakeUserRepo{user: &model.User{ID: botID, Role: string(model.RoleBot)}}
+	keys := &fakeAPIKeyRepo{}
+	service := NewBotServiceImpl(users, keys, nil)
+
+	createKey := func(body string) (int, *utils.APIResponse) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/bots/"+botID+"/keys", bytes.NewBufferString(body))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", botID)
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		ctx = context.WithValue(ctx, middleware.UserIDKey, "admin-1")
+		status, resp, _ := service.CreateKey(httptest.NewRecorder(), req.WithContext(ctx))
+		return status, resp
+	}
+
+	for _, body := range []string{
+		`{"name":"ci","scopes":[]}`,
+		`{"name":"ci","scopes":["users:manage_roles"]}`,
+		`{"name":"","scopes":["messages:read"]}`,
+	} {
+		if status, _ := createKey(body); status != http.StatusBadRequest {
+			t.Fatalf("expected %s to be rejected, got %d", body, status)
+		}
+	}
+
+	status, resp := createKey(`{"name":"ci","scopes":["messages:read","messages:write"]}`)
+	if status != http.StatusCreated {
+		t.Fatalf("expected key, got %d", status)
+	}
+	key, _ := resp.Data.(map[string]any)["key"].(string)
+	if !strings.HasPrefix(key, "bot_") || keys.created.KeyHash != utils.HashToken(key) || keys.created.Prefix != key[:12] {
+		t.Fatalf("expected hashed key with prefix, got %q %+v", key, keys.created)
+	}
+
+	// Humans cannot be given API keys
+	users.user.Role = string(model.RoleUser)
+	if status, _ := createKey(`{"name":"ci","scopes":["messages:read"]}`); status != http.StatusNotFound {
+		t.Fatalf("expected non-bot to be rejected, got %d", status)
+	}
+}
+
+func TestRevokeKeyClosesSocketsOpenedWithTheKey(t *testing.T) {
+	const botID = "0b6a1c52-8f0e-4c8e-9a43-6f2d1e7b9c10"
+	const keyID = "7c9e6679-7425-40de-944b-e07fc1f90ae7"
+	users := &fakeUserRepo{user: &model.User{ID: botID, Role: string(model.RoleBot)}}
+	disconnector := &fakeDisconnector{}
+	bots := NewBotServiceImpl(users, &fakeAPIKeyRepo{}, disconnector)
+
+	// A socket ticket issued to the key is bound to it
+	store := &fakeAuthStore{}
+	userService := NewUserServiceImpl(UserServiceDeps{UserRepo: users, AuthStore: store})
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/ws/ticket", nil)
+	ctx := context.WithValue(req.Context(), middleware.UserIDKey, botID)
+	ctx = context.WithValue(ctx, middleware.APIKeyIDKey, keyID)
+	_, resp, err := userService.CreateWSTicket(httptest.NewRecorder(), req.WithContext(ctx))
+	if err != nil {
+		t.Fatalf("expected ticket, got %v", err)
+	}
+	ticket, _ := resp.Data.(map[string]any)["ticket"].(string)
+	_, sessionID, _ := store.ConsumeWSTicket(context.Background(), utils.HashToken(ticket))
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/admin/bots/"+botID+"/keys/"+keyID, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", botID)
+	rctx.URLParams.Add("keyID", keyID)
+	if status, _, err := bots.RevokeKey(httptest.NewRecorder(), req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))); status != http.StatusOK {
+		t.Fatalf("expected revocation, got %d %v", status, err)
+	}
+	if len(disconnector.sessionIDs) != 1 || disconnector.sessionIDs[0] != sessionID {
+		t.Fatalf("expected the key's sockets (%q) to be closed, got %v", sessionID, disconnector.sessionIDs)
+	}
+}
@@ -0,0 +1,554 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/mailer"
+	"github.com/ak-repo/go-chat-system/internal/repository"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultExportDir          = "./tmp/exports"
+	defaultExportRetention    = 7 * 24 * time.Hour
+	defaultExportPollInterval = 10 * time.Second
+
+	// exportStaleAfter hands a running export to another worker when the
+	// one that claimed it stopped without finishing
+	exportStaleAfter = 30 * time.Minute
+	exportTimeout    = 10 * time.Minute
+	exportPageSize   = 500
+)
+
+// DataExporter builds the personal data export archives users ask for and
+// deletes them again after the retention period.
+type DataExporter struct {
+	exportRepo    repository.ExportRepository
+	userRepo      repository.UserRepository
+	friendRepo    repository.FriendRepository
+	friendReqRepo repository.FriendRequestRepository
+	blockRepo     repository.BlockRepository
+	messageRepo   repository.MessageRepository
+	mailer        mailer.Mailer
+	publisher     EventPublisher
+
+	dir       string
+	retention time.Duration
+	interval  time.Duration
+	wake      chan struct{}
+	quit      chan struct{}
+}
+
+func NewDataExporter(exportRepo repository.ExportRepository,
+	userRepo repository.UserRepository,
+	friendRepo repository.FriendRepository,
+	friendReqRepo repository.FriendRequestRepository,
+	blockRepo repository.BlockRepository,
+	messageRepo repository.MessageRepository,
+	mail mailer.Mailer,
+	publisher EventPublisher,
+	dir string, retention, interval time.Duration) *DataExporter {
+	if dir == "" {
+		dir = defaultExportDir
+	}
+	if retention <= 0 {
+		retention = defaultExportRetention
+	}
+	if interval <= 0 {
+		interval = defaultExportPollInterval
+	}
+	return &DataExporter{
+		exportRepo:    exportRepo,
+		userRepo:      userRepo,
+		friendRepo:    friendRepo,
+		friendReqRepo: friendReqRepo,
+		blockRepo:     blockRepo,
+		messageRepo:   messageRepo,
+		mailer:        mail,
+		publisher:     publisher,
+		dir:           dir,
+		retention:     retention,
+		interval:      interval,
+		wake:          make(chan struct{}, 1),
+		quit:          make(chan struct{}),
+	}
+}
+
+func (e *DataExporter) Run() {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		e.ExpireOnce()
+		for e.RunOnce() {
+		}
+
+		select {
+		case <-e.quit:
+			return
+		case <-ticker.C:
+		case <-e.wake:
+		}
+	}
+}
+
+func (e *DataExporter) Stop() {
+	close(e.quit)
+}
+
+// Wake makes the exporter look for queued exports now instead of on the
+// next tick.
+func (e *DataExporter) Wake() {
+	select {
+	case e.wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunOnce builds the oldest queued export. It reports whether there was one.
+func (e *DataExporter) RunOnce() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout)
+	defer cancel()
+
+	export, err := e.exportRepo.ClaimExport(ctx, time.Now().Add(-exportStaleAfter))
+	if err != nil {
+		logger.L().Error("failed to claim data export", zap.Error(err))
+		return false
+	}
+	if export == nil {
+		return false
+	}
+
+	path, size, err := e.build(ctx, export)
+	if err != nil {
+		logger.L().Error("data export failed", zap.String("export_id", export.ID), zap.Error(err))
+		if err := e.exportRepo.FailExport(ctx, export.ID); err != nil {
+			logger.L().Error("failed to mark data export as failed", zap.String("export_id", export.ID), zap.Error(err))
+		}
+		return true
+	}
+
+	expiresAt := time.Now().Add(e.retention)
+	if err := e.exportRepo.CompleteExport(ctx, export.ID, path, size, expiresAt); err != nil {
+		logger.L().Error("failed to complete data export", zap.String("export_id", export.ID), zap.Error(err))
+		os.Remove(path)
+		return true
+	}
+
+	logger.L().Info("data export ready", zap.String("export_id", export.ID), zap.String("user_id", export.UserID))
+	e.notifyReady(ctx, export, expiresAt)
+	return true
+}
+
+// ExpireOnce deletes the archives whose retention period has passed.
+func (e *DataExporter) ExpireOnce() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	paths, err := e.exportRepo.ExpireExports(ctx, time.Now())
+	if err != nil {
+		logger.L().Error("data export cleanup failed", zap.Error(err))
+		return
+	}
+	for _, path := range paths {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			logger.L().Warn("failed to delete expired data export", zap.String("path", path), zap.Error(err))
+		}
+	}
+}
+
+// build writes the archive of export to a file in the export directory and
+// returns its path and size.
+func (e *DataExporter) build(ctx context.Context, export *model.DataExport) (string, int64, error) {
+	if err := os.MkdirAll(e.dir, 0o700); err != nil {
+		return "", 0, errs.Wrap("service.DataExporter.build", err)
+	}
+
+	path := filepath.Join(e.dir, export.ID+".zip")
+	tmp, err := os.CreateTemp(e.dir, export.ID+"-*.tmp")
+	if err != nil {
+		return "", 0, errs.Wrap("service.DataExporter.build", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := e.writeArchive(ctx, tmp, export.UserID); err != nil {
+		tmp.Close()
+		return "", 0, errs.Wrap("service.DataExporter.build", err)
+	}
+
+	info, err := tmp.Stat()
+	if err != nil {
+		tmp.Close()
+		return "", 0, errs.Wrap("service.DataExporter.build", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", 0, errs.Wrap("service.DataExporter.build", err)
+	}
+	// Only complete archives get the final name
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", 0, errs.Wrap("service.DataExporter.build", err)
+	}
+	return path, info.Size(), nil
+}
+
+// exportAccount is the account part of an export: everything the user
+// entered or we recorded about them, minus secrets.
+type exportAccount struct {
+	ID         string                `json:"id"`
+	Username   string                `json:"username"`
+	Email      string                `json:"email"`
+	Role       string                `json:"role"`
+	VerifiedAt *time.Time            `json:"verified_at,omitempty"`
+	CreatedAt  time.Time             `json:"created_at"`
+	LastSeenAt *time.Time            `json:"last_seen_at,omitempty"`
+	Profile    model.Profile         `json:"profile"`
+	Privacy    model.PrivacySettings `json:"privacy"`
+}
+
+// exportFriend and exportFriendRequest name the other user by handle only.
+// Their email addresses are not the exporting user's data.
+type exportFriend struct {
+	UserID    string    `json:"user_id"`
+	Username  string    `json:"username"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportFriendRequest struct {
+	ID        string                    `json:"id"`
+	UserID    string                    `json:"user_id"` // sender or receiver
+	Username  string                    `json:"username"`
+	Status    model.FriendRequestStatus `json:"status"`
+	CreatedAt time.Time                 `json:"created_at"`
+}
+
+// exportData is everything but the messages, which are streamed.
+type exportData struct {
+	GeneratedAt      time.Time
+	Account          exportAccount
+	Friends          []exportFriend
+	ReceivedRequests []exportFriendRequest
+	SentRequests     []exportFriendRequest
+	Blocks           model.BlocksDTO
+	MessageCount     int
+}
+
+// writeArchive writes the zip for userID to w: one JSON file per area plus
+// index.html and messages.txt for reading.
+func (e *DataExporter) writeArchive(ctx context.Context, w io.Writer, userID string) error {
+	data, err := e.collect(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	for _, entry := range []struct {
+		name string
+		v    any
+	}{
+		{"account.json", data.Account},
+		{"friends.json", data.Friends},
+		{"friend_requests.json", map[string]any{"received": data.ReceivedRequests, "sent": data.SentRequests}},
+		{"blocks.json", data.Blocks},
+	} {
+		if err := writeJSONEntry(zw, entry.name, entry.v); err != nil {
+			return err
+		}
+	}
+
+	// Messages are paged through twice instead of being held in memory
+	if data.MessageCount, err = e.writeMessagesJSON(ctx, zw, userID); err != nil {
+		return err
+	}
+	if err := e.writeMessagesText(ctx, zw, userID, data.handles()); err != nil {
+		return err
+	}
+
+	f, err := zw.Create("index.html")
+	if err != nil {
+		return err
+	}
+	if err := exportIndexTemplate.Execute(f, data); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// handles maps the IDs of the users in the export to their handles.
+func (d *exportData) handles() map[string]string {
+	handles := map[string]string{d.Account.ID: d.Account.Username}
+	for _, f := range d.Friends {
+		handles[f.UserID] = f.Username
+	}
+	for _, r := range d.ReceivedRequests {
+		handles[r.UserID] = r.Username
+	}
+	for _, r := range d.SentRequests {
+		handles[r.UserID] = r.Username
+	}
+	for _, b := range d.Blocks {
+		handles[b.BlockedID] = b.BlockedName
+	}
+	return handles
+}
+
+func (e *DataExporter) collect(ctx context.Context, userID string) (*exportData, error) {
+	user, err := e.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user == nil {
+		return nil, errs.ErrNotFound
+	}
+
+	data := &exportData{
+		GeneratedAt: time.Now().UTC(),
+		Account: exportAccount{
+			ID:         user.ID,
+			Username:   user.Username,
+			Email:      user.Email,
+			Role:       user.Role,
+			VerifiedAt: nullTimePtr(user.VerifiedAt),
+			CreatedAt:  user.CreatedAt,
+			LastSeenAt: nullTimePtr(user.LastSeenAt),
+			Profile:    user.Profile,
+			Privacy:    user.Privacy,
+		},
+		Friends:          []exportFriend{},
+		ReceivedRequests: []exportFriendRequest{},
+		SentRequests:     []exportFriendRequest{},
+	}
+
+	for offset := 0; ; offset += exportPageSize {
+		page, err := e.friendRepo.ListFriends(ctx, userID, exportPageSize, offset)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range page {
+			data.Friends = append(data.Friends, exportFriend{UserID: f.FriendID, Username: f.FriendName, CreatedAt: f.CreatedAt})
+		}
+		if len(page) < exportPageSize {
+			break
+		}
+	}
+
+	received, err := e.friendReqRepo.GetAllRequests(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range received {
+		data.ReceivedRequests = append(data.ReceivedRequests, exportFriendRequest{
+			ID: r.ID, UserID: r.SenderID, Username: r.FriendName, Status: r.Status, CreatedAt: r.CreatedAt,
+		})
+	}
+	sent, err := e.friendReqRepo.GetSentRequests(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range sent {
+		data.SentRequests = append(data.SentRequests, exportFriendRequest{
+			ID: r.ID, UserID: r.ReceiverID, Username: r.FriendName, Status: r.Status, CreatedAt: r.CreatedAt,
+		})
+	}
+
+	data.Blocks = model.BlocksDTO{}
+	var after *model.BlockCursor
+	for {
+		page, err := e.blockRepo.ListBlocks(ctx, userID, after, exportPageSize)
+		if err != nil {
+			return nil, err
+		}
+		data.Blocks = append(data.Blocks, page...)
+		if len(page) < exportPageSize {
+			break
+		}
+		last := page[len(page)-1]
+		after = &model.BlockCursor{CreatedAt: last.CreatedAt, BlockedID: last.BlockedID}
+	}
+	return data, nil
+}
+
+// eachMessage calls fn for every message userID sent or received, oldest
+// first.
+func (e *DataExporter) eachMessage(ctx context.Context, userID string, fn func(*model.Message) error) error {
+	for offset := 0; ; offset += exportPageSize {
+		page, err := e.messageRepo.GetMessagesForUser(ctx, userID, exportPageSize, offset)
+		if err != nil {
+			return err
+		}
+		for _, msg := range page {
+			if err := fn(msg); err != nil {
+				return err
+			}
+		}
+		if len(page) < exportPageSize {
+			return nil
+		}
+	}
+}
+
+func (e *DataExporter) writeMessagesJSON(ctx context.Context, zw *zip.Writer, userID string) (int, error) {
+	f, err := zw.Create("messages.json")
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	if _, err := io.WriteString(f, "[\n"); err != nil {
+		return 0, err
+	}
+	err = e.eachMessage(ctx, userID, func(msg *model.Message) error {
+		b, err := json.Marshal(msg)
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			if _, err := io.WriteString(f, ",\n"); err != nil {
+				return err
+			}
+		}
+		count++
+		_, err = f.Write(b)
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	_, err = io.WriteString(f, "\n]\n")
+	return count, err
+}
+
+// writeMessagesText writes a transcript. Receivers are named by handles, a
+// map of the user IDs the export knows handles for.
+func (e *DataExporter) writeMessagesText(ctx context.Context, zw *zip.Writer, userID string, handles map[string]string) error {
+	f, err := zw.Create("messages.txt")
+	if err != nil {
+		return err
+	}
+	return e.eachMessage(ctx, userID, func(msg *model.Message) error {
+		direction := "from " + msg.SenderName
+		if msg.SenderID == userID {
+			receiver, ok := handles[msg.ReceiverID]
+			if !ok {
+				receiver = msg.ReceiverID
+			}
+			direction = "to " + receiver
+		}
+		_, err := fmt.Fprintf(f, "[%s] %s: %s\n", msg.CreatedAt.UTC().Format(time.RFC3339), direction, msg.Body)
+		return err
+	})
+}
+
+func writeJSONEntry(zw *zip.Writer, name string, v any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// notifyReady tells the user their archive can be downloaded. Failures
+// only cost the notification; the export shows as ready either way.
+func (e *DataExporter) notifyReady(ctx context.Context, export *model.DataExport, expiresAt time.Time) {
+	if e.publisher != nil {
+		e.publisher.Publish("data_export_ready", export.UserID, map[string]string{"export_id": export.ID}, export.UserID)
+	}
+	if e.mailer == nil {
+		return
+	}
+
+	user, err := e.userRepo.GetByID(ctx, export.UserID)
+	if err != nil || user == nil {
+		return
+	}
+	body := fmt.Sprintf("Hi %s,\n\nThe copy of your data you asked for is ready. "+
+		"Download it from your account settings before %s.\n",
+		user.Username, expiresAt.UTC().Format("2 Jan 2006 15:04 MST"))
+	msg := mailer.Message{To: user.Email, Subject: "Your data export is ready", Body: body}
+	if err := e.mailer.Send(ctx, msg); err != nil {
+		logger.L().Warn("failed to send data export email", zap.String("user_id", user.ID), zap.Error(err))
+	}
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
+
+var exportIndexTemplate = template.Must(template.New("index").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Your data – {{.Account.Username}}</title>
+<style>
+body { font-family: sans-serif; max-width: 60rem; margin: 2rem auto; padding: 0 1rem; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2rem; }
+th, td { border: 1px solid #ccc; padding: .3rem .5rem; text-align: left; }
+</style>
+</head>
+<body>
+<h1>Your data</h1>
+<p>Exported {{.GeneratedAt.Format "2 Jan 2006 15:04 MST"}}. The JSON files in this archive hold the same data in machine-readable form.</p>
+
+<h2>Account</h2>
+<table>
+<tr><th>ID</th><td>{{.Account.ID}}</td></tr>
+<tr><th>Handle</th><td>{{.Account.Username}}</td></tr>
+<tr><th>Email</th><td>{{.Account.Email}}</td></tr>
+<tr><th>Role</th><td>{{.Account.Role}}</td></tr>
+<tr><th>Created</th><td>{{.Account.CreatedAt.Format "2006-01-02 15:04"}}</td></tr>
+<tr><th>Display name</th><td>{{.Account.Profile.DisplayName}}</td></tr>
+<tr><th>Bio</th><td>{{.Account.Profile.Bio}}</td></tr>
+<tr><th>Avatar URL</th><td>{{.Account.Profile.AvatarURL}}</td></tr>
+<tr><th>Status</th><td>{{.Account.Profile.StatusEmoji}} {{.Account.Profile.StatusText}}</td></tr>
+<tr><th>Timezone</th><td>{{.Account.Profile.Timezone}}</td></tr>
+<tr><th>Discoverable by</th><td>{{.Account.Privacy.Discoverability}}</td></tr>
+<tr><th>Email searchable</th><td>{{.Account.Privacy.EmailSearchable}}</td></tr>
+<tr><th>Friend requests from</th><td>{{.Account.Privacy.FriendRequests}}</td></tr>
+<tr><th>Online status visible to</th><td>{{.Account.Privacy.Presence}}</td></tr>
+</table>
+
+<h2>Friends ({{len .Friends}})</h2>
+<table>
+<tr><th>Handle</th><th>Since</th></tr>
+{{range .Friends}}<tr><td>{{.Username}}</td><td>{{.CreatedAt.Format "2006-01-02"}}</td></tr>
+{{end}}</table>
+
+<h2>Friend requests received ({{len .ReceivedRequests}})</h2>
+<table>
+<tr><th>From</th><th>Status</th><th>Sent</th></tr>
+{{range .ReceivedRequests}}<tr><td>{{.Username}}</td><td>{{.Status}}</td><td>{{.CreatedAt.Format "2006-01-02"}}</td></tr>
+{{end}}</table>
+
+<h2>Friend requests sent ({{len .SentRequests}})</h2>
+<table>
+<tr><th>To</th><th>Status</th><th>Sent</th></tr>
+{{range .SentRequests}}<tr><td>{{.Username}}</td><td>{{.Status}}</td><td>{{.CreatedAt.Format "2006-01-02"}}</td></tr>
+{{end}}</table>
+
+<h2>Blocked users ({{len .Blocks}})</h2>
+<table>
+<tr><th>Handle</th><th>Blocked</th><th>Reason</th></tr>
+{{range .Blocks}}<tr><td>{{.BlockedName}}</td><td>{{.CreatedAt.Format "2006-01-02"}}</td><td>{{.Reason}}</td></tr>
+{{end}}</table>
+
+<h2>Messages ({{.MessageCount}})</h2>
+<p>All messages you sent and received are in <a href="messages.txt">messages.txt</a> and messages.json.</p>
+</body>
+</html>
+`))
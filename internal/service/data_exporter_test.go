@@ -0,0 +1,222 @@
+package service
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/go-chi/chi"
+)
+
+// fakeExportRepo keeps exports in memory, one active export per user like
+// the unique index.
+type fakeExportRepo struct {
+	exports   map[string]*model.DataExport
+	tokenHash string
+}
+
+func (f *fakeExportRepo) CreateExport(_ context.Context, export *model.DataExport) error {
+	for _, e := range f.exports {
+		if e.UserID == export.UserID && (e.Status == model.ExportPending || e.Status == model.ExportRunning) {
+			return errs.ErrConflict
+		}
+	}
+	if f.exports == nil {
+		f.exports = map[string]*model.DataExport{}
+	}
+	export.CreatedAt = time.Now()
+	f.exports[export.ID] = export
+	return nil
+}
+
+func (f *fakeExportRepo) GetExport(_ context.Context, id, userID string) (*model.DataExport, error) {
+	if e, ok := f.exports[id]; ok && e.UserID == userID {
+		return e, nil
+	}
+	return nil, nil
+}
+
+func (f *fakeExportRepo) LatestExport(_ context.Context, userID string) (*model.DataExport, error) {
+	var latest *model.DataExport
+	for _, e := range f.exports {
+		if e.UserID == userID && e.Status != model.ExportFailed && (latest == nil || e.CreatedAt.After(latest.CreatedAt)) {
+			latest = e
+		}
+	}
+	return latest, nil
+}
+
+func (f *fakeExportRepo) ClaimExport(context.Context, time.Time) (*model.DataExport, error) {
+	for _, e := range f.exports {
+		if e.Status == model.ExportPending {
+			e.Status = model.ExportRunning
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeExportRepo) CompleteExport(_ context.Context, id, filePath string, size int64, expiresAt time.Time) error {
+	e := f.exports[id]
+	e.Status, e.FilePath, e.SizeBytes = model.ExportReady, filePath, size
+	e.CompletedAt.Time, e.CompletedAt.Valid = time.Now(), true
+	e.ExpiresAt.Time, e.ExpiresAt.Valid = expiresAt, true
+	return nil
+}
+
+func (f *fakeExportRepo) FailExport(_ context.Context, id string) error {
+	f.exports[id].Status = model.ExportFailed
+	return nil
+}
+
+func (f *fakeExportRepo) SetDownloadToken(_ context.Context, _ string, tokenHash string, _ time.Time) error {
+	f.tokenHash = tokenHash
+	return nil
+}
+
+func (f *fakeExportRepo) GetByDownloadToken(_ context.Context, tokenHash string) (*model.DataExport, error) {
+	if tokenHash != f.tokenHash {
+		return nil, nil
+	}
+	for _, e := range f.exports {
+		if e.Status == model.ExportReady {
+			return e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (f *fakeExportRepo) ExpireExports(context.Context, time.Time) ([]string, error) {
+	return nil, nil
+}
+
+func TestDataExportArchiveAndDownload(t *testing.T) {
+	now := time.Now().UTC()
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Username: "alice", Email: "a@example.com", Role: "user",
+		Profile: model.Profile{DisplayName: "Alice <3"}}}
+	blocks := fakeBlockRepo{blocks: model.BlocksDTO{{BlockedID: "user-3", BlockedName: "mallory", CreatedAt: now}}}
+	messages := &fakeMessageRepo{}
+	for i := 0; i < exportPageSize+1; i++ {
+		messages.messages = append(messages.messages, &model.Message{ID: "m", SenderID: "user-1", ReceiverID: "user-3", Body: "hi", CreatedAt: now})
+	}
+	messages.messages[0] = &model.Message{ID: "m0", SenderID: "user-2", SenderName: "bob", ReceiverID: "user-1", Body: "hello alice", CreatedAt: now}
+
+	exports := &fakeExportRepo{}
+	publisher := &fakePublisher{}
+	friends := fakeFriendRepo{friends: model.FriendsDTO{{UserID: "user-1", FriendID: "user-2", FriendName: "bob", FriendEmail: "bob@example.com", CreatedAt: now}}}
+	requests := &fakeFriendRequestRepo{received: model.FriendRequestsDTO{{ID: "req-1", SenderID: "user-4", ReceiverID: "user-1", FriendName: "carol", FriendEmail: "carol@example.com", Status: model.FriendPending, CreatedAt: now}}}
+	exporter := NewDataExporter(exports, users, friends, requests, blocks, messages, nil, publisher,
+		t.TempDir(), time.Hour, time.Minute)
+	service := NewExportServiceImpl(exports, exporter, time.Minute, time.Hour)
+
+	call := func(fn func(http.ResponseWriter, *http.Request) (int, *utils.APIResponse, error), method, id string) (int, *model.DataExportDTO, error) {
+		req := httptest.NewRequest(method, "/api/v1/users/me/export/"+id, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		ctx = context.WithValue(ctx, middleware.UserIDKey, "user-1")
+		status, resp, err := fn(httptest.NewRecorder(), req.WithContext(ctx))
+		if resp == nil {
+			return status, nil, err
+		}
+		return status, resp.Data.(map[string]any)["export"].(*model.DataExportDTO), err
+	}
+
+	status, export, err := call(service.RequestExport, http.MethodPost, "")
+	if err != nil || status != http.StatusAccepted || export.Status != model.ExportPending {
+		t.Fatalf("expected queued export, got %d %v %#v", status, err, export)
+	}
+	if status, _, err := call(service.RequestExport, http.MethodPost, ""); status != http.StatusConflict || !errors.Is(err, errs.ErrExportInProgress) {
+		t.Fatalf("expected a second export to be refused, got %d %v", status, err)
+	}
+
+	if !exporter.RunOnce() {
+		t.Fatalf("expected the queued export to be built")
+	}
+	if publisher.event != "data_export_ready" {
+		t.Fatalf("expected a ready event, got %q", publisher.event)
+	}
+
+	_, ready, err := call(service.GetExport, http.MethodGet, export.ID)
+	if err != nil || ready.Status != model.ExportReady || !strings.HasPrefix(ready.DownloadURL, exportDownloadPath) {
+		t.Fatalf("expected a ready export with a link, got %v %#v", err, ready)
+	}
+
+	// Download through the link without any other credentials
+	token := strings.TrimPrefix(ready.DownloadURL, exportDownloadPath)
+	req := httptest.NewRequest(http.MethodGet, ready.DownloadURL, nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("token", token)
+	rec := httptest.NewRecorder()
+	service.DownloadExport(rec, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("expected the archive, got %d %q", rec.Code, rec.Body.String())
+	}
+
+	zr, err := zip.NewReader(strings.NewReader(rec.Body.String()), int64(rec.Body.Len()))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	files := map[string]string{}
+	for _, f := range zr.File {
+		rc, _ := f.Open()
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(b)
+	}
+
+	var account exportAccount
+	if err := json.Unmarshal([]byte(files["account.json"]), &account); err != nil || account.Email != "a@example.com" {
+		t.Fatalf("unexpected account.json %q", files["account.json"])
+	}
+	var msgs model.Messages
+	if err := json.Unmarshal([]byte(files["messages.json"]), &msgs); err != nil || len(msgs) != exportPageSize+1 {
+		t.Fatalf("expected every message across pages in messages.json, got %d (%v)", len(msgs), err)
+	}
+	if !strings.Contains(files["messages.txt"], "from bob: hello alice") || !strings.Contains(files["messages.txt"], "to mallory: hi") {
+		t.Fatalf("unexpected transcript %q", files["messages.txt"][:200])
+	}
+	if !strings.Contains(files["blocks.json"], "mallory") || files["friend_requests.json"] == "" {
+		t.Fatalf("expected blocks and friend requests in the archive")
+	}
+	if !strings.Contains(files["friends.json"], "bob") || !strings.Contains(files["friend_requests.json"], "carol") {
+		t.Fatalf("expected friends and requests by handle, got %q %q", files["friends.json"], files["friend_requests.json"])
+	}
+	for name, content := range files {
+		if strings.Contains(content, "bob@example.com") || strings.Contains(content, "carol@example.com") {
+			t.Fatalf("expected no email of other users in %s", name)
+		}
+	}
+	if !strings.Contains(files["index.html"], "Alice &lt;3") {
+		t.Fatalf("expected an escaped readable rendering, got %q", files["index.html"])
+	}
+
+	// The next archive only after the cooldown, unless the last one failed
+	if status, _, err := call(service.RequestExport, http.MethodPost, ""); status != http.StatusTooManyRequests || !errors.Is(err, errs.ErrExportTooSoon) {
+		t.Fatalf("expected a new export within the cooldown to be refused, got %d %v", status, err)
+	}
+	exports.exports[export.ID].Status = model.ExportFailed
+	if status, _, err := call(service.RequestExport, http.MethodPost, ""); status != http.StatusAccepted {
+		t.Fatalf("expected a retry after a failed export, got %d %v", status, err)
+	}
+
+	// A wrong token leads nowhere
+	rctx.URLParams = chi.RouteParams{}
+	rctx.URLParams.Add("token", "other")
+	rec = httptest.NewRecorder()
+	service.DownloadExport(rec, req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx)))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("expected unknown link to be rejected, got %d", rec.Code)
+	}
+}
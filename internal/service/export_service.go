@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/repository"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/logger"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultExportLinkTTL  = time.Hour
+	defaultExportCooldown = 24 * time.Hour
+	exportDownloadPath    = "/api/v1/exports/"
+)
+
+// ExportQueue runs queued data exports in the background.
+type ExportQueue interface {
+	Wake()
+}
+
+// ExportService lets users download a copy of everything stored about them.
+type ExportService interface {
+	RequestExport(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	GetExport(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	// DownloadExport streams the archive itself, so it is a plain handler
+	DownloadExport(w http.ResponseWriter, r *http.Request)
+}
+
+type ExportServiceImpl struct {
+	exportRepo repository.ExportRepository
+	queue      ExportQueue
+	linkTTL    time.Duration
+	cooldown   time.Duration // archives are big, so users get one per cooldown
+}
+
+func NewExportServiceImpl(exportRepo repository.ExportRepository, queue ExportQueue, linkTTL, cooldown time.Duration) *ExportServiceImpl {
+	if linkTTL <= 0 {
+		linkTTL = defaultExportLinkTTL
+	}
+	if cooldown <= 0 {
+		cooldown = defaultExportCooldown
+	}
+	return &ExportServiceImpl{exportRepo: exportRepo, queue: queue, linkTTL: linkTTL, cooldown: cooldown}
+}
+
+// POST -> queues an export of the caller's data, at most one per cooldown
+func (s *ExportServiceImpl) RequestExport(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Failed exports do not count, so they can be retried right away
+	latest, err := s.exportRepo.LatestExport(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.ExportService.RequestExport", err)
+	}
+	if latest != nil {
+		if latest.Status == model.ExportPending || latest.Status == model.ExportRunning {
+			return http.StatusConflict, nil, errs.ErrExportInProgress
+		}
+		if wait := time.Until(latest.CreatedAt.Add(s.cooldown)); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return http.StatusTooManyRequests, nil, errs.ErrExportTooSoon
+		}
+	}
+
+	export := &model.DataExport{
+		ID:     uuid.NewString(),
+		UserID: userID,
+		Status: model.ExportPending,
+	}
+	if err := s.exportRepo.CreateExport(ctx, export); err != nil {
+		if errs.Is(err, errs.ErrConflict) {
+			return http.StatusConflict, nil, errs.ErrExportInProgress
+		}
+		return http.StatusInternalServerError, nil, errs.Wrap("service.ExportService.RequestExport", err)
+	}
+	if s.queue != nil {
+		s.queue.Wake()
+	}
+
+	logger.L().Info("data export requested", zap.String("user_id", userID), zap.String("export_id", export.ID))
+
+	dto := toExportDTO(export)
+	responseData := map[string]any{
+		"export": &dto,
+	}
+	return http.StatusAccepted, utils.SuccessResponse(responseData), nil
+}
+
+// GET -> status of one of the caller's exports. Ready exports come with a
+// fresh download link; earlier links stop working.
+func (s *ExportServiceImpl) GetExport(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	export, err := s.exportRepo.GetExport(ctx, id, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.ExportService.GetExport", err)
+	}
+	if export == nil {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+
+	dto := toExportDTO(export)
+	if export.Status == model.ExportReady {
+		token, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.ExportService.GetExport", err)
+		}
+		linkExpiresAt := time.Now().UTC().Add(s.linkTTL)
+		if export.ExpiresAt.Valid && export.ExpiresAt.Time.Before(linkExpiresAt) {
+			linkExpiresAt = export.ExpiresAt.Time
+		}
+		if err := s.exportRepo.SetDownloadToken(ctx, export.ID, utils.HashToken(token), linkExpiresAt); err != nil {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.ExportService.GetExport", err)
+		}
+		dto.DownloadURL = exportDownloadPath + token
+		dto.LinkExpiresAt = &linkExpiresAt
+	}
+
+	responseData := map[string]any{
+		"export": &dto,
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// GET -> the archive behind a download link. The link is the credential, so
+// it works from a plain browser download.
+func (s *ExportServiceImpl) DownloadExport(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	if token == "" {
+		utils.ErrorResponse(w, "resource not found", nil, http.StatusNotFound)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	export, err := s.exportRepo.GetByDownloadToken(ctx, utils.HashToken(token))
+	if err != nil {
+		logger.L().Error("failed to load data export", zap.Error(err))
+		utils.ErrorResponse(w, "internal server error", nil, http.StatusInternalServerError)
+		return
+	}
+	if export == nil {
+		utils.ErrorResponse(w, "download link is invalid or has expired", nil, http.StatusNotFound)
+		return
+	}
+
+	f, err := os.Open(export.FilePath)
+	if err != nil {
+		logger.L().Error("failed to open data export", zap.String("export_id", export.ID), zap.Error(err))
+		utils.ErrorResponse(w, "download link is invalid or has expired", nil, http.StatusNotFound)
+		return
+	}
+	defer f.Close()
+
+	name := fmt.Sprintf("data-export-%s.zip", export.CreatedAt.UTC().Format("2006-01-02"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Header().Set("Cache-Control", "no-store")
+	http.ServeContent(w, r, name, export.CompletedAt.Time, f)
+}
+
+func toExportDTO(export *model.DataExport) model.DataExportDTO {
+	dto := model.DataExportDTO{
+		ID:        export.ID,
+		Status:    export.Status,
+		SizeBytes: export.SizeBytes,
+		CreatedAt: export.CreatedAt,
+	}
+	if export.CompletedAt.Valid {
+		dto.CompletedAt = &export.CompletedAt.Time
+	}
+	if export.ExpiresAt.Valid {
+		dto.ExpiresAt = &export.ExpiresAt.Time
+	}
+	return dto
+}
@@ -3,10 +3,13 @@ package service
 import (
 	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
 	"github.com/ak-repo/go-chat-system/internal/repository"
 	"github.com/ak-repo/go-chat-system/internal/shared/errs"
 	"github.com/ak-repo/go-chat-system/internal/shared/utils"
@@ -23,16 +26,59 @@ type FriendRequestService interface {
 	GetPendingRequest(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
 }
 
+const (
+	defaultFriendRequestTTL     = 30 * 24 * time.Hour
+	defaultRejectionCooldown    = 7 * 24 * time.Hour
+	defaultDailyFriendRequests  = 50
+	friendRequestQuotaWindow    = 24 * time.Hour
+	friendRequestQuotaKeyPrefix = "rate:friendreq:"
+)
+
 type FriendRequestServiceImpl struct {
 	repo       repository.FriendRequestRepository
 	friendRepo repository.FriendRepository
 	blockRepo  repository.BlockRepository
+	userRepo   repository.UserRepository
+	authStore  repository.AuthStore // daily request quota
+	cache      repository.FriendCache
+	publisher  EventPublisher
 }
 
 func FriendRequestServiceInit(repo repository.FriendRequestRepository,
 	friendRepo repository.FriendRepository,
-	blockRepo repository.BlockRepository) *FriendRequestServiceImpl {
-	return &FriendRequestServiceImpl{repo: repo, friendRepo: friendRepo, blockRepo: blockRepo}
+	blockRepo repository.BlockRepository,
+	userRepo repository.UserRepository,
+	authStore repository.AuthStore,
+	cache repository.FriendCache,
+	publisher EventPublisher) *FriendRequestServiceImpl {
+	return &FriendRequestServiceImpl{
+		repo:       repo,
+		friendRepo: friendRepo,
+		blockRepo:  blockRepo,
+		userRepo:   userRepo,
+		authStore:  authStore,
+		cache:      cache,
+		publisher:  publisher,
+	}
+}
+
+// friendRequestEvent is the payload of the friend request events other than
+// friend_request_received, which carries the whole request.
+type friendRequestEvent struct {
+	RequestID  string `json:"request_id"`
+	SenderID   string `json:"sender_id"`
+	ReceiverID string `json:"receiver_id"`
+}
+
+func newFriendRequestEvent(req *model.FriendRequest) friendRequestEvent {
+	return friendRequestEvent{RequestID: req.ID, SenderID: req.SenderID, ReceiverID: req.ReceiverID}
+}
+
+// publish pushes a relationship change to the live connections of userIDs.
+func (s *FriendRequestServiceImpl) publish(event, senderID string, payload any, userIDs ...string) {
+	if s.publisher != nil {
+		s.publisher.Publish(event, senderID, payload, userIDs...)
+	}
 }
 
 // POST
@@ -59,6 +105,18 @@ func (s *FriendRequestServiceImpl) CreateRequest(w http.ResponseWriter, r *http.
 		return http.StatusBadRequest, nil, errs.ErrSelfAction
 	}
 
+	// Unverified accounts cannot reach out to other users yet
+	sender, err := s.userRepo.GetByID(r.Context(), userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.FriendRequestService.CreateRequest", err)
+	}
+	if sender == nil {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+	if !sender.VerifiedAt.Valid {
+		return http.StatusForbidden, nil, errs.ErrEmailNotVerified
+	}
+
 	// Already friends → reject
 	areFriend, err := s.friendRepo.AreFriends(r.Context(), userID, body.To)
 	if err != nil {
@@ -95,17 +153,81 @@ func (s *FriendRequestServiceImpl) CreateRequest(w http.ResponseWriter, r *http.
 		return http.StatusForbidden, nil, errs.ErrBlockedRelationship
 	}
 
+	// The receiver decides who may send them requests
+	receiver, err := s.userRepo.GetByID(r.Context(), body.To)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.FriendRequestService.CreateRequest", err)
+	}
+	if receiver == nil {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+	switch receiver.Privacy.FriendRequests {
+	case model.AudienceNobody:
+		return http.StatusForbidden, nil, errs.ErrRequestsNotAllowed
+	case model.AudienceFriendsOfFriends:
+		mutual, err := s.friendRepo.HaveMutualFriend(r.Context(), userID, body.To)
+		if err != nil {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.FriendRequestService.CreateRequest", err)
+		}
+		if !mutual {
+			return http.StatusForbidden, nil, errs.ErrRequestsNotAllowed
+		}
+	}
+
+	// Someone who said no is not asked again right away
+	rejectedAt, err := s.repo.LastRejectedAt(r.Context(), userID, body.To)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.FriendRequestService.CreateRequest", err)
+	}
+	if !rejectedAt.IsZero() {
+		if wait := time.Until(rejectedAt.Add(rejectionCooldown())); wait > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return http.StatusTooManyRequests, nil, errs.ErrRequestCooldown
+		}
+	}
+
+	// Counted after the checks above, so requests they refuse do not use
+	// up the quota. Duplicates only show up at the insert and still count;
+	// counting after it would let parallel requests overshoot the limit.
+	allowed, err := s.authStore.Allow(r.Context(), friendRequestQuotaKeyPrefix+userID, dailyFriendRequests(), friendRequestQuotaWindow)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.FriendRequestService.CreateRequest", err)
+	}
+	if !allowed {
+		return http.StatusTooManyRequests, nil, errs.ErrRequestLimit
+	}
+
+	now := time.Now()
 	friendReq := &model.FriendRequest{
 		ID:         uuid.NewString(),
 		SenderID:   userID,
 		ReceiverID: body.To,
 		Status:     model.FriendPending,
-		CreatedAt:  time.Now(),
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(friendRequestTTL()),
 	}
 	if err := s.repo.CreateRequest(r.Context(), friendReq); err != nil {
+		if errs.Is(err, errs.ErrConflict) {
+			return http.StatusConflict, nil, errs.ErrConflict
+		}
 		return http.StatusInternalServerError, nil, errs.Wrap("service.FriendRequestService.CreateRequest", err)
 	}
 
+	invalidateSuggestions(r.Context(), s.cache, friendReq.SenderID, friendReq.ReceiverID)
+
+	// Shaped like the entries of GET /friend-requests
+	s.publish("friend_request_received", userID, map[string]any{
+		"request": &model.FriendRequestDTO{
+			ID:          friendReq.ID,
+			SenderID:    friendReq.SenderID,
+			ReceiverID:  friendReq.ReceiverID,
+			FriendName:  sender.Username,
+			FriendEmail: sender.Email,
+			Status:      friendReq.Status,
+			CreatedAt:   friendReq.CreatedAt,
+		},
+	}, friendReq.ReceiverID)
+
 	return http.StatusCreated, nil, nil
 }
 
@@ -129,10 +251,18 @@ func (s *FriendRequestServiceImpl) AcceptRequest(w http.ResponseWriter, r *http.
 		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
 	}
 
-	if err := s.repo.AcceptRequest(r.Context(), body.RequestID, userID); err != nil {
+	accepted, err := s.repo.AcceptRequest(r.Context(), body.RequestID, userID)
+	if err != nil {
+		if errs.Is(err, errs.ErrRequestNotFound) {
+			return http.StatusNotFound, nil, errs.ErrRequestNotFound
+		}
 		return http.StatusInternalServerError, nil, errs.Wrap("service.FriendRequestService.AcceptRequest", err)
 	}
 
+	// Both sides gain a friend
+	invalidateSuggestions(r.Context(), s.cache, accepted.SenderID, accepted.ReceiverID)
+	s.publish("friend_request_accepted", userID, newFriendRequestEvent(accepted), accepted.SenderID, accepted.ReceiverID)
+
 	return http.StatusOK, nil, nil
 }
 
@@ -208,10 +338,19 @@ func (s *FriendRequestServiceImpl) RejectRequest(w http.ResponseWriter, r *http.
 		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
 	}
 
-	if err := s.repo.RejectRequest(r.Context(), body.RequestID, userID); err != nil {
+	rejected, err := s.repo.RejectRequest(r.Context(), body.RequestID, userID)
+	if err != nil {
+		if errs.Is(err, errs.ErrRequestNotFound) {
+			return http.StatusNotFound, nil, errs.ErrRequestNotFound
+		}
 		return http.StatusInternalServerError, nil, errs.Wrap("service.FriendRequestService.RejectRequest", err)
 	}
 
+	// Only the receiver's other devices hear about it; senders are not told
+	// they were turned down
+	invalidateSuggestions(r.Context(), s.cache, rejected.SenderID, rejected.ReceiverID)
+	s.publish("friend_request_rejected", userID, newFriendRequestEvent(rejected), rejected.ReceiverID)
+
 	return http.StatusOK, nil, nil
 }
 
@@ -233,9 +372,40 @@ func (s *FriendRequestServiceImpl) CancelRequest(w http.ResponseWriter, r *http.
 		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
 	}
 
-	if err := s.repo.CancelRequest(r.Context(), body.RequestID, userID); err != nil {
+	cancelled, err := s.repo.CancelRequest(r.Context(), body.RequestID, userID)
+	if err != nil {
+		if errs.Is(err, errs.ErrRequestNotFound) {
+			return http.StatusNotFound, nil, errs.ErrRequestNotFound
+		}
 		return http.StatusInternalServerError, nil, errs.Wrap("service.FriendRequestService.CancelRequest", err)
 	}
 
+	invalidateSuggestions(r.Context(), s.cache, cancelled.SenderID, cancelled.ReceiverID)
+	s.publish("friend_request_cancelled", userID, newFriendRequestEvent(cancelled), cancelled.SenderID, cancelled.ReceiverID)
+
 	return http.StatusOK, nil, nil
 }
+
+// friendRequestTTL is how long a request stays pending.
+func friendRequestTTL() time.Duration {
+	if ttl := config.Config.FriendRequests.ExpireAfter; ttl > 0 {
+		return ttl
+	}
+	return defaultFriendRequestTTL
+}
+
+// rejectionCooldown is how long a rejected sender waits before asking the
+// same user again.
+func rejectionCooldown() time.Duration {
+	if d := config.Config.FriendRequests.RejectionCooldown; d > 0 {
+		return d
+	}
+	return defaultRejectionCooldown
+}
+
+func dailyFriendRequests() int {
+	if n := config.Config.FriendRequests.DailyLimit; n > 0 {
+		return n
+	}
+	return defaultDailyFriendRequests
+}
@@ -3,11 +3,18 @@ package service
 import (
 	"bytes"
 	"context"
+	"database/sql"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"testing"
+	"time"
 
 	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
 	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
 )
 
@@ -16,9 +23,14 @@ type fakeFriendRequestRepo struct {
 	acceptedReceiver  string
 	rejectedRequestID string
 	rejectedReceiver  string
+	created           *model.FriendRequest
+	lastRejectedAt    time.Time
+	expired           []*model.FriendRequest
+	received          model.FriendRequestsDTO
 }
 
-func (f *fakeFriendRequestRepo) CreateRequest(context.Context, *model.FriendRequest) error {
+func (f *fakeFriendRequestRepo) CreateRequest(_ context.Context, req *model.FriendRequest) error {
+	f.created = req
 	return nil
 }
 
@@ -27,28 +39,43 @@ func (f *fakeFriendRequestRepo) GetPendingRequest(context.Context, string, strin
 }
 
 func (f *fakeFriendRequestRepo) GetAllRequests(context.Context, string) (model.FriendRequestsDTO, error) {
+	return f.received, nil
+}
+
+func (f *fakeFriendRequestRepo) GetSentRequests(context.Context, string) (model.FriendRequestsDTO, error) {
 	return nil, nil
 }
 
-func (f *fakeFriendRequestRepo) AcceptRequest(_ context.Context, requestID, receiverID string) error {
+func (f *fakeFriendRequestRepo) AcceptRequest(_ context.Context, requestID, receiverID string) (*model.FriendRequest, error) {
 	f.acceptedRequestID = requestID
 	f.acceptedReceiver = receiverID
-	return nil
+	return &model.FriendRequest{ID: requestID, SenderID: "sender-1", ReceiverID: receiverID, Status: model.FriendAccepted}, nil
 }
 
-func (f *fakeFriendRequestRepo) RejectRequest(_ context.Context, requestID, receiverID string) error {
+func (f *fakeFriendRequestRepo) RejectRequest(_ context.Context, requestID, receiverID string) (*model.FriendRequest, error) {
 	f.rejectedRequestID = requestID
 	f.rejectedReceiver = receiverID
-	return nil
+	return &model.FriendRequest{ID: requestID, SenderID: "sender-1", ReceiverID: receiverID, Status: model.FriendRejected}, nil
 }
 
-func (f *fakeFriendRequestRepo) CancelRequest(context.Context, string, string) error {
-	return nil
+func (f *fakeFriendRequestRepo) LastRejectedAt(context.Context, string, string) (time.Time, error) {
+	return f.lastRejectedAt, nil
+}
+
+func (f *fakeFriendRequestRepo) DeleteExpiredRequests(_ context.Context, _ time.Time, limit int) ([]*model.FriendRequest, error) {
+	n := min(limit, len(f.expired))
+	batch := f.expired[:n]
+	f.expired = f.expired[n:]
+	return batch, nil
+}
+
+func (f *fakeFriendRequestRepo) CancelRequest(_ context.Context, requestID, senderID string) (*model.FriendRequest, error) {
+	return &model.FriendRequest{ID: requestID, SenderID: senderID, ReceiverID: "receiver-1", Status: model.FriendPending}, nil
 }
 
 func TestAcceptRequestUsesAuthenticatedReceiverID(t *testing.T) {
 	repo := &fakeFriendRequestRepo{}
-	service := FriendRequestServiceInit(repo, nil, nil)
+	service := FriendRequestServiceInit(repo, nil, nil, nil, nil, nil, nil)
 	req := httptest.NewRequest(http.MethodPost, "/api/v1/friend-requests/accept", bytes.NewBufferString(`{"request_id":"req-1","received_id":"attacker-controlled"}`))
 	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "receiver-1"))
 
@@ -69,7 +96,7 @@ func TestAcceptRequestUsesAuthenticatedReceiverID(t *testing.T) {
 
 func TestRejectRequestUsesAuthenticatedReceiverID(t *testing.T) {
 	repo := &fakeFriendRequestRepo{}
-	service := FriendRequestServiceInit(repo, nil, nil)
+	service := FriendRequestServiceInit(repo, nil, nil, nil, nil, nil, nil)
 	req := httptest.NewRequest(http.MethodPost, "/api/v1/friend-requests/reject", bytes.NewBufferString(`{"request_id":"req-1","receiver_id":"attacker-controlled"}`))
 	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "receiver-1"))
 
@@ -87,3 +114,158 @@ func TestRejectRequestUsesAuthenticatedReceiverID(t *testing.T) {
 		t.Fatalf("expected authenticated receiver id, got %q", repo.rejectedReceiver)
 	}
 }
+
+func TestCreateRequestRequiresVerifiedEmail(t *testing.T) {
+	repo := &fakeFriendRequestRepo{}
+	users := &fakeUserRepo{user: &model.User{ID: "sender-1"}}
+	service := FriendRequestServiceInit(repo, fakeFriendRepo{}, fakeBlockRepo{}, users, &fakeAuthStore{}, nil, nil)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/friend-requests", bytes.NewBufferString(`{"to":"receiver-1"}`))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "sender-1"))
+
+	status, _, err := service.CreateRequest(httptest.NewRecorder(), req)
+	if status != http.StatusForbidden {
+		t.Fatalf("expected status %d, got %d", http.StatusForbidden, status)
+	}
+	if !errors.Is(err, errs.ErrEmailNotVerified) {
+		t.Fatalf("expected email not verified error, got %v", err)
+	}
+}
+
+func TestCreateRequestRespectsReceiverPrivacy(t *testing.T) {
+	tests := []struct {
+		name    string
+		from    model.Audience
+		friends fakeFriendRepo
+		want    int
+	}{
+		{name: "nobody", from: model.AudienceNobody, want: http.StatusForbidden},
+		{name: "friends of friends without mutual friend", from: model.AudienceFriendsOfFriends, want: http.StatusForbidden},
+		{name: "friends of friends with mutual friend", from: model.AudienceFriendsOfFriends, friends: fakeFriendRepo{mutual: true}, want: http.StatusCreated},
+		{name: "everyone", from: model.AudienceEveryone, want: http.StatusCreated},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// The fake returns the same user as sender and receiver
+			users := &fakeUserRepo{user: &model.User{
+				ID:         "receiver-1",
+				VerifiedAt: sql.NullTime{Time: time.Now(), Valid: true},
+				Privacy:    model.PrivacySettings{FriendRequests: tt.from},
+			}}
+			service := FriendRequestServiceInit(&fakeFriendRequestRepo{}, tt.friends, fakeBlockRepo{}, users, &fakeAuthStore{}, nil, nil)
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/friend-requests", bytes.NewBufferString(`{"to":"receiver-1"}`))
+			req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "sender-1"))
+
+			status, _, err := service.CreateRequest(httptest.NewRecorder(), req)
+			if status != tt.want {
+				t.Fatalf("expected status %d, got %d (%v)", tt.want, status, err)
+			}
+			if tt.want == http.StatusForbidden && !errors.Is(err, errs.ErrRequestsNotAllowed) {
+				t.Fatalf("expected requests not allowed error, got %v", err)
+			}
+		})
+	}
+}
+
+func TestFriendRequestChangesArePublished(t *testing.T) {
+	// The fake returns the same user as sender and receiver
+	users := &fakeUserRepo{user: &model.User{ID: "receiver-1", Username: "alice", VerifiedAt: sql.NullTime{Time: time.Now(), Valid: true}}}
+	publisher := &fakePublisher{}
+	service := FriendRequestServiceInit(&fakeFriendRequestRepo{}, fakeFriendRepo{}, fakeBlockRepo{}, users, &fakeAuthStore{}, nil, publisher)
+
+	call := func(fn func(http.ResponseWriter, *http.Request) (int, *utils.APIResponse, error), userID, body string) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/friend-requests", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, userID))
+		if _, _, err := fn(httptest.NewRecorder(), req); err != nil {
+			t.Fatalf("unexpected error %v", err)
+		}
+	}
+	call(service.CreateRequest, "sender-1", `{"to":"receiver-1"}`)
+	call(service.AcceptRequest, "receiver-1", `{"request_id":"req-1"}`)
+	call(service.RejectRequest, "receiver-1", `{"request_id":"req-2"}`)
+	call(service.CancelRequest, "sender-1", `{"request_id":"req-3"}`)
+
+	want := []struct {
+		event   string
+		userIDs string
+	}{
+		{"friend_request_received", "[receiver-1]"},
+		{"friend_request_accepted", "[sender-1 receiver-1]"},
+		{"friend_request_rejected", "[receiver-1]"},
+		{"friend_request_cancelled", "[sender-1 receiver-1]"},
+	}
+	if len(publisher.sent) != len(want) {
+		t.Fatalf("expected %d events, got %#v", len(want), publisher.sent)
+	}
+	for i, w := range want {
+		got := publisher.sent[i]
+		if got.event != w.event || fmt.Sprint(got.userIDs) != w.userIDs {
+			t.Fatalf("event %d: expected %s to %s, got %s to %v", i, w.event, w.userIDs, got.event, got.userIDs)
+		}
+	}
+
+	received := publisher.sent[0].payload.(map[string]any)["request"].(*model.FriendRequestDTO)
+	if received.SenderID != "sender-1" || received.FriendName != "alice" || received.Status != model.FriendPending {
+		t.Fatalf("unexpected received payload %#v", received)
+	}
+	if accepted := publisher.sent[1].payload.(friendRequestEvent); accepted.RequestID != "req-1" {
+		t.Fatalf("unexpected accepted payload %#v", accepted)
+	}
+}
+
+func TestCreateRequestEnforcesCooldownAndDailyLimit(t *testing.T) {
+	oldConfig := config.Config
+	t.Cleanup(func() { config.Config = oldConfig })
+	config.Config.FriendRequests = config.FriendRequestConfig{ExpireAfter: time.Hour, RejectionCooldown: 24 * time.Hour, DailyLimit: 2}
+
+	users := &fakeUserRepo{user: &model.User{ID: "receiver-1", VerifiedAt: sql.NullTime{Time: time.Now(), Valid: true}}}
+	create := func(repo *fakeFriendRequestRepo, store *fakeAuthStore) (int, http.Header, error) {
+		service := FriendRequestServiceInit(repo, fakeFriendRepo{}, fakeBlockRepo{}, users, store, nil, nil)
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/friend-requests", bytes.NewBufferString(`{"to":"receiver-1"}`))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "sender-1"))
+		rec := httptest.NewRecorder()
+		status, _, err := service.CreateRequest(rec, req)
+		return status, rec.Header(), err
+	}
+
+	store := &fakeAuthStore{}
+	rejected := &fakeFriendRequestRepo{lastRejectedAt: time.Now().Add(-time.Hour)}
+	status, header, err := create(rejected, store)
+	if status != http.StatusTooManyRequests || !errors.Is(err, errs.ErrRequestCooldown) || header.Get("Retry-After") == "" {
+		t.Fatalf("expected the rejection cooldown, got %d %v %q", status, err, header.Get("Retry-After"))
+	}
+	if len(store.counters) != 0 {
+		t.Fatalf("expected a refused request not to count against the quota")
+	}
+
+	if status, _, err := create(&fakeFriendRequestRepo{lastRejectedAt: time.Now().Add(-25 * time.Hour)}, store); status != http.StatusCreated {
+		t.Fatalf("expected a request after the cooldown, got %d %v", status, err)
+	}
+	repo := &fakeFriendRequestRepo{}
+	if status, _, err := create(repo, store); status != http.StatusCreated {
+		t.Fatalf("expected a second request, got %d %v", status, err)
+	}
+	if d := repo.created.ExpiresAt.Sub(repo.created.CreatedAt); d != time.Hour {
+		t.Fatalf("expected the configured expiry, got %v", d)
+	}
+	if status, _, err := create(&fakeFriendRequestRepo{}, store); status != http.StatusTooManyRequests || !errors.Is(err, errs.ErrRequestLimit) {
+		t.Fatalf("expected the daily limit, got %d %v", status, err)
+	}
+}
+
+func TestSweeperRemovesExpiredRequestsInBatches(t *testing.T) {
+	repo := &fakeFriendRequestRepo{}
+	for i := 0; i < friendRequestSweepBatch+1; i++ {
+		repo.expired = append(repo.expired, &model.FriendRequest{ID: fmt.Sprint(i), SenderID: "sender-1", ReceiverID: "receiver-1"})
+	}
+	publisher := &fakePublisher{}
+
+	NewFriendRequestSweeper(repo, publisher, time.Minute).SweepOnce()
+
+	if len(repo.expired) != 0 || len(publisher.sent) != friendRequestSweepBatch+1 {
+		t.Fatalf("expected every expired request removed and announced, %d left, %d events", len(repo.expired), len(publisher.sent))
+	}
+	if last := publisher.sent[len(publisher.sent)-1]; last.event != "friend_request_expired" || fmt.Sprint(last.userIDs) != "[sender-1 receiver-1]" {
+		t.Fatalf("unexpected event %#v", last)
+	}
+}
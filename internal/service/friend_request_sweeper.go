@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/repository"
+	"github.com/ak-repo/go-chat-system/internal/shared/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultFriendRequestSweepInterval = time.Hour
+	friendRequestSweepBatch           = 500
+)
+
+// FriendRequestSweeper periodically removes friend requests that expired
+// without an answer and tells both sides.
+type FriendRequestSweeper struct {
+	repo      repository.FriendRequestRepository
+	publisher EventPublisher
+	interval  time.Duration
+	quit      chan struct{}
+}
+
+func NewFriendRequestSweeper(repo repository.FriendRequestRepository, publisher EventPublisher, interval time.Duration) *FriendRequestSweeper {
+	if interval <= 0 {
+		interval = defaultFriendRequestSweepInterval
+	}
+	return &FriendRequestSweeper{
+		repo:      repo,
+		publisher: publisher,
+		interval:  interval,
+		quit:      make(chan struct{}),
+	}
+}
+
+func (s *FriendRequestSweeper) Run() {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		s.SweepOnce()
+
+		select {
+		case <-s.quit:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *FriendRequestSweeper) Stop() {
+	close(s.quit)
+}
+
+// SweepOnce removes every request that has expired by now, in batches.
+func (s *FriendRequestSweeper) SweepOnce() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	now := time.Now()
+	total := 0
+	for {
+		expired, err := s.repo.DeleteExpiredRequests(ctx, now, friendRequestSweepBatch)
+		if err != nil {
+			logger.L().Error("friend request sweep failed", zap.Error(err))
+			break
+		}
+		for _, req := range expired {
+			if s.publisher != nil {
+				s.publisher.Publish("friend_request_expired", "", newFriendRequestEvent(req), req.SenderID, req.ReceiverID)
+			}
+		}
+		total += len(expired)
+		if len(expired) < friendRequestSweepBatch {
+			break
+		}
+	}
+	if total > 0 {
+		logger.L().Info("removed expired friend requests", zap.Int("count", total))
+	}
+}
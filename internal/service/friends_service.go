@@ -1,26 +1,53 @@
 package service
 
 import (
+	"context"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
 	"github.com/ak-repo/go-chat-system/internal/repository"
 	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/logger"
 	"github.com/ak-repo/go-chat-system/internal/shared/utils"
 	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultSuggestionCacheTTL        = 10 * time.Minute
+	defaultSuggestionCacheMinFriends = 200
+	maxFriendSuggestions             = 100 // computed and cached at once
 )
 
 type FriendService interface {
 	ListFriends(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	RemoveFriend(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	MutualFriends(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	Suggestions(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
 }
 
 type FriendServiceImpl struct {
 	friendRepo repository.FriendRepository
 	userRepo   repository.UserRepository
+	blockRepo  repository.BlockRepository
+	cache      repository.FriendCache // suggestions of users with many friends
+	publisher  EventPublisher
 }
 
-func NewFriendServiceImpl(repo repository.FriendRepository) *FriendServiceImpl {
-	return &FriendServiceImpl{friendRepo: repo}
+func NewFriendServiceImpl(repo repository.FriendRepository, userRepo repository.UserRepository, blockRepo repository.BlockRepository, cache repository.FriendCache, publisher EventPublisher) *FriendServiceImpl {
+	return &FriendServiceImpl{friendRepo: repo, userRepo: userRepo, blockRepo: blockRepo, cache: cache, publisher: publisher}
+}
+
+// publish pushes a relationship change to the live connections of userIDs.
+func (s *FriendServiceImpl) publish(event, senderID string, payload any, userIDs ...string) {
+	if s.publisher != nil {
+		s.publisher.Publish(event, senderID, payload, userIDs...)
+	}
 }
 
 func (s *FriendServiceImpl) ListFriends(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
@@ -57,3 +84,189 @@ func (s *FriendServiceImpl) ListFriends(w http.ResponseWriter, r *http.Request)
 
 	return http.StatusOK, utils.SuccessResponse(responseData), nil
 }
+
+// DELETE -> ends the friendship with {id} for both sides. Their conversation
+// stays readable, but no new messages can be sent until they are friends
+// again, and becoming friends again takes a new friend request.
+func (s *FriendServiceImpl) RemoveFriend(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	friendID := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(friendID); err != nil {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+	if friendID == userID {
+		return http.StatusConflict, nil, errs.ErrSelfAction
+	}
+
+	removed, err := s.friendRepo.RemoveFriendship(r.Context(), userID, friendID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.FriendService.RemoveFriend", err)
+	}
+	if !removed {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+
+	invalidateSuggestions(r.Context(), s.cache, userID, friendID)
+	s.publish("friend_removed", userID, map[string]string{"user_id": userID}, friendID)
+	s.publish("friend_removed", userID, map[string]string{"user_id": friendID}, userID)
+
+	return http.StatusOK, nil, nil
+}
+
+// GET -> friends the caller and ?user_id= have in common. Users the caller
+// may not look up look the same as unknown ones.
+func (s *FriendServiceImpl) MutualFriends(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	otherID := r.URL.Query().Get("user_id")
+	if _, err := uuid.Parse(otherID); err != nil {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+	if otherID == userID {
+		return http.StatusConflict, nil, errs.ErrSelfAction
+	}
+
+	limit := 20
+	offset := 0
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	// Blocked users look the same as unknown ones
+	blocked, err := s.blockRepo.IsBlocked(r.Context(), userID, otherID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.FriendService.MutualFriends", err)
+	}
+	if blocked {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+
+	other, err := s.userRepo.GetByID(r.Context(), otherID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.FriendService.MutualFriends", err)
+	}
+	if other == nil {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+	found, err := canDiscover(r.Context(), s.friendRepo, other, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.FriendService.MutualFriends", err)
+	}
+	if !found {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+
+	mutual, err := s.friendRepo.ListMutualFriends(r.Context(), userID, otherID, limit, offset)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.FriendService.MutualFriends", err)
+	}
+
+	responseData := map[string]any{
+		"friends": mutual,
+		"limit":   limit,
+		"offset":  offset,
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// GET -> friends of friends the caller may know, most mutual friends first.
+// Suggestions of users with many friends are cached for a while, so they can
+// lag behind changes among their friends.
+func (s *FriendServiceImpl) Suggestions(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	limit := 20
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= maxFriendSuggestions {
+			limit = l
+		}
+	}
+
+	suggestions, err := s.suggestions(r.Context(), userID, limit)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.FriendService.Suggestions", err)
+	}
+	if len(suggestions) > limit {
+		suggestions = suggestions[:limit]
+	}
+
+	responseData := map[string]any{
+		"suggestions": suggestions,
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// suggestions returns at least limit suggestions if there are that many. The
+// cache is only a shortcut: when Redis fails they are computed again.
+func (s *FriendServiceImpl) suggestions(ctx context.Context, userID string, limit int) (model.FriendSuggestionsDTO, error) {
+	if s.cache != nil {
+		cached, ok, err := s.cache.GetSuggestions(ctx, userID)
+		if err != nil {
+			logger.L().Warn("failed to read cached friend suggestions", zap.String("user_id", userID), zap.Error(err))
+		}
+		if ok {
+			return cached, nil
+		}
+	}
+
+	friends, err := s.friendRepo.CountFriends(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if s.cache == nil || friends < suggestionCacheMinFriends() {
+		return s.friendRepo.SuggestFriends(ctx, userID, limit)
+	}
+
+	suggestions, err := s.friendRepo.SuggestFriends(ctx, userID, maxFriendSuggestions)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.cache.SetSuggestions(ctx, userID, suggestions, suggestionCacheTTL()); err != nil {
+		logger.L().Warn("failed to cache friend suggestions", zap.String("user_id", userID), zap.Error(err))
+	}
+	return suggestions, nil
+}
+
+// invalidateSuggestions drops cached suggestions after the relationship
+// between userIDs changed, so they do not show friends, blocked users or
+// pending requests. Changes further away wait for the cache to expire.
+func invalidateSuggestions(ctx context.Context, cache repository.FriendCache, userIDs ...string) {
+	if cache == nil {
+		return
+	}
+	if err := cache.InvalidateSuggestions(ctx, userIDs...); err != nil {
+		logger.L().Warn("failed to invalidate friend suggestions", zap.Strings("user_ids", userIDs), zap.Error(err))
+	}
+}
+
+func suggestionCacheTTL() time.Duration {
+	if ttl := config.Config.Friends.SuggestionCacheTTL; ttl > 0 {
+		return ttl
+	}
+	return defaultSuggestionCacheTTL
+}
+
+func suggestionCacheMinFriends() int {
+	if n := config.Config.Friends.SuggestionCacheMinFriends; n > 0 {
+		return n
+	}
+	return defaultSuggestionCacheMinFriends
+}
@@ -0,0 +1,171 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/go-chi/chi"
+)
+
+// fakeFriendCache keeps cached suggestions in memory.
+type fakeFriendCache struct {
+	suggestions map[string]model.FriendSuggestionsDTO
+}
+
+func (f *fakeFriendCache) GetSuggestions(_ context.Context, userID string) (model.FriendSuggestionsDTO, bool, error) {
+	s, ok := f.suggestions[userID]
+	return s, ok, nil
+}
+
+func (f *fakeFriendCache) SetSuggestions(_ context.Context, userID string, suggestions model.FriendSuggestionsDTO, _ time.Duration) error {
+	if f.suggestions == nil {
+		f.suggestions = map[string]model.FriendSuggestionsDTO{}
+	}
+	f.suggestions[userID] = suggestions
+	return nil
+}
+
+func (f *fakeFriendCache) InvalidateSuggestions(_ context.Context, userIDs ...string) error {
+	for _, id := range userIDs {
+		delete(f.suggestions, id)
+	}
+	return nil
+}
+
+func TestRemoveFriendNotifiesBothSides(t *testing.T) {
+	friendID := "2b8a9a8e-4a4e-4d39-9d1e-6f4f1f3b2c11"
+
+	remove := func(friends fakeFriendRepo, id string) (int, *fakePublisher, error) {
+		publisher := &fakePublisher{}
+		service := NewFriendServiceImpl(friends, nil, fakeBlockRepo{}, nil, publisher)
+
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/friends/"+id, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		ctx = context.WithValue(ctx, middleware.UserIDKey, "user-1")
+		status, _, err := service.RemoveFriend(httptest.NewRecorder(), req.WithContext(ctx))
+		return status, publisher, err
+	}
+
+	status, publisher, err := remove(fakeFriendRepo{areFriends: true}, friendID)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("expected friend to be removed, got %d %v", status, err)
+	}
+	want := fmt.Sprintf("[{friend_removed map[user_id:user-1] [%[1]s]} {friend_removed map[user_id:%[1]s] [user-1]}]", friendID)
+	if got := fmt.Sprint(publisher.sent); got != want {
+		t.Fatalf("expected %s, got %s", want, got)
+	}
+
+	status, publisher, err = remove(fakeFriendRepo{}, friendID)
+	if status != http.StatusNotFound || !errors.Is(err, errs.ErrNotFound) || len(publisher.sent) != 0 {
+		t.Fatalf("expected 404 without events for a non-friend, got %d %v %v", status, err, publisher.sent)
+	}
+
+	if status, _, _ := remove(fakeFriendRepo{areFriends: true}, "not-a-uuid"); status != http.StatusNotFound {
+		t.Fatalf("expected 404 for an invalid id, got %d", status)
+	}
+}
+
+func TestSuggestionsAreCachedForUsersWithManyFriends(t *testing.T) {
+	oldConfig := config.Config
+	t.Cleanup(func() { config.Config = oldConfig })
+	config.Config.Friends.SuggestionCacheMinFriends = 3
+
+	var candidates model.FriendSuggestionsDTO
+	for i := 0; i < 5; i++ {
+		candidates = append(candidates, &model.FriendSuggestionDTO{
+			UserSummaryDTO: model.UserSummaryDTO{ID: fmt.Sprint("user-", i+10)},
+			MutualFriends:  5 - i,
+		})
+	}
+
+	suggest := func(service *FriendServiceImpl) model.FriendSuggestionsDTO {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/friends/suggestions?limit=2", nil)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+		status, resp, err := service.Suggestions(httptest.NewRecorder(), req)
+		if err != nil || status != http.StatusOK {
+			t.Fatalf("expected suggestions, got %d %v", status, err)
+		}
+		return resp.Data.(map[string]any)["suggestions"].(model.FriendSuggestionsDTO)
+	}
+
+	// Few friends: computed every time
+	cache := &fakeFriendCache{}
+	light := fakeFriendRepo{friendIDs: []string{"user-2"}, suggestions: candidates}
+	if got := suggest(NewFriendServiceImpl(light, nil, fakeBlockRepo{}, cache, nil)); len(got) != 2 || got[0].ID != "user-10" {
+		t.Fatalf("expected the two best suggestions, got %v", got)
+	}
+	if len(cache.suggestions) != 0 {
+		t.Fatalf("expected nothing cached for a light user")
+	}
+
+	// Many friends: the whole ranking is cached and served from there
+	heavy := fakeFriendRepo{friendIDs: []string{"user-2", "user-3", "user-4"}, suggestions: candidates}
+	suggest(NewFriendServiceImpl(heavy, nil, fakeBlockRepo{}, cache, nil))
+	if len(cache.suggestions["user-1"]) != len(candidates) {
+		t.Fatalf("expected all suggestions cached, got %v", cache.suggestions)
+	}
+	cached := NewFriendServiceImpl(fakeFriendRepo{areFriends: true}, nil, fakeBlockRepo{}, cache, nil)
+	if got := suggest(cached); len(got) != 2 || got[1].ID != "user-11" {
+		t.Fatalf("expected cached suggestions, got %v", got)
+	}
+
+	// Unfriending drops the cached suggestions of both sides
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/friends/user-2", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", "2b8a9a8e-4a4e-4d39-9d1e-6f4f1f3b2c11")
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	ctx = context.WithValue(ctx, middleware.UserIDKey, "user-1")
+	if status, _, err := cached.RemoveFriend(httptest.NewRecorder(), req.WithContext(ctx)); err != nil || status != http.StatusOK {
+		t.Fatalf("expected friend to be removed, got %d %v", status, err)
+	}
+	if _, ok := cache.suggestions["user-1"]; ok {
+		t.Fatalf("expected cached suggestions to be invalidated")
+	}
+}
+
+func TestMutualFriendsHidesBlockedAndUndiscoverableUsers(t *testing.T) {
+	otherID := "2b8a9a8e-4a4e-4d39-9d1e-6f4f1f3b2c11"
+	everyone := &model.User{ID: otherID, Privacy: model.PrivacySettings{Discoverability: model.AudienceEveryone}}
+	nobody := &model.User{ID: otherID, Privacy: model.PrivacySettings{Discoverability: model.AudienceNobody}}
+
+	mutual := func(friends fakeFriendRepo, blocks fakeBlockRepo, other *model.User, otherID string) int {
+		service := NewFriendServiceImpl(friends, &fakeUserRepo{user: other}, blocks, nil, nil)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/friends/mutual?user_id="+otherID, nil)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+		status, _, _ := service.MutualFriends(httptest.NewRecorder(), req)
+		return status
+	}
+
+	if status := mutual(fakeFriendRepo{}, fakeBlockRepo{}, everyone, otherID); status != http.StatusOK {
+		t.Fatalf("expected mutual friends, got %d", status)
+	}
+	if status := mutual(fakeFriendRepo{}, fakeBlockRepo{blocked: true}, everyone, otherID); status != http.StatusNotFound {
+		t.Fatalf("expected a blocked user to look unknown, got %d", status)
+	}
+	if status := mutual(fakeFriendRepo{}, fakeBlockRepo{}, everyone, "nope"); status != http.StatusBadRequest {
+		t.Fatalf("expected an invalid user_id to be rejected, got %d", status)
+	}
+	if status := mutual(fakeFriendRepo{}, fakeBlockRepo{}, nil, otherID); status != http.StatusNotFound {
+		t.Fatalf("expected an unknown user to be reported, got %d", status)
+	}
+
+	// Users who cannot be looked up do not reveal their friends either,
+	// except to their own friends
+	if status := mutual(fakeFriendRepo{mutual: true}, fakeBlockRepo{}, nobody, otherID); status != http.StatusNotFound {
+		t.Fatalf("expected an undiscoverable user to look unknown, got %d", status)
+	}
+	if status := mutual(fakeFriendRepo{areFriends: true}, fakeBlockRepo{}, nobody, otherID); status != http.StatusOK {
+		t.Fatalf("expected a friend to see mutual friends, got %d", status)
+	}
+}
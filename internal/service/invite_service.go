@@ -0,0 +1,304 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+	"github.com/ak-repo/go-chat-system/internal/repository"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/logger"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	inviteCodePrefix        = "inv_"
+	inviteCodePrefixShown   = 12 // "inv_" plus 8 characters, to tell codes apart
+	defaultInviteTTL        = 7 * 24 * time.Hour
+	defaultMaxUserInviteUse = 5
+	maxAdminInviteUses      = 10000
+	maxActiveUserInvites    = 10
+)
+
+// InviteService manages sign-up invite codes. Users create codes for people
+// they know (if registration.user_invites is on); admins for anyone.
+type InviteService interface {
+	CreateInvite(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	ListInvites(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	RevokeInvite(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+
+	AdminCreateInvite(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	AdminListInvites(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	AdminRevokeInvite(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+}
+
+type InviteServiceImpl struct {
+	inviteRepo repository.InviteRepository
+	userRepo   repository.UserRepository
+}
+
+func NewInviteServiceImpl(inviteRepo repository.InviteRepository, userRepo repository.UserRepository) *InviteServiceImpl {
+	return &InviteServiceImpl{inviteRepo: inviteRepo, userRepo: userRepo}
+}
+
+type inviteRequest struct {
+	MaxUses   int        `json:"max_uses"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	Email     string     `json:"email"`
+}
+
+// POST -> new invite code of the caller. The code is only ever returned here.
+func (s *InviteServiceImpl) CreateInvite(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+	if !config.Config.Registration.UserInvites {
+		return http.StatusForbidden, nil, errs.ErrForbidden
+	}
+
+	req, err := decodeInviteRequest(w, r)
+	if err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.InviteService.CreateInvite", err)
+	}
+
+	maxUses := config.Config.Registration.MaxUserInviteUses
+	if maxUses <= 0 {
+		maxUses = defaultMaxUserInviteUse
+	}
+	if req.MaxUses > maxUses || (req.ExpiresAt != nil && req.ExpiresAt.After(time.Now().Add(inviteTTL()))) {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.InviteService.CreateInvite", err)
+	}
+	if user == nil {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+	if !user.VerifiedAt.Valid {
+		return http.StatusForbidden, nil, errs.ErrEmailNotVerified
+	}
+
+	active, err := s.inviteRepo.CountActiveInvites(ctx, userID, time.Now().UTC())
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.InviteService.CreateInvite", err)
+	}
+	if active >= maxActiveUserInvites {
+		return http.StatusConflict, nil, errs.ErrTooManyInvites
+	}
+
+	responseData, err := s.createInvite(ctx, userID, req)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.InviteService.CreateInvite", err)
+	}
+	return http.StatusCreated, utils.SuccessResponse(responseData), nil
+}
+
+// GET -> the caller's invite codes that were not revoked
+func (s *InviteServiceImpl) ListInvites(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+	return s.listInvites(r, userID)
+}
+
+// DELETE -> revokes one of the caller's invite codes
+func (s *InviteServiceImpl) RevokeInvite(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+	return s.revokeInvite(r, userID)
+}
+
+// POST -> new invite code without the limits regular users have
+func (s *InviteServiceImpl) AdminCreateInvite(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || adminID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	req, err := decodeInviteRequest(w, r)
+	if err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.InviteService.AdminCreateInvite", err)
+	}
+	if req.MaxUses > maxAdminInviteUses {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	responseData, err := s.createInvite(ctx, adminID, req)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.InviteService.AdminCreateInvite", err)
+	}
+	return http.StatusCreated, utils.SuccessResponse(responseData), nil
+}
+
+// GET -> all invite codes, or those of ?created_by=
+func (s *InviteServiceImpl) AdminListInvites(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	createdBy := r.URL.Query().Get("created_by")
+	if createdBy != "" {
+		if _, err := uuid.Parse(createdBy); err != nil {
+			return http.StatusBadRequest, nil, errs.ErrValidation
+		}
+	}
+	return s.listInvites(r, createdBy)
+}
+
+// DELETE -> revokes any invite code
+func (s *InviteServiceImpl) AdminRevokeInvite(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	return s.revokeInvite(r, "")
+}
+
+func decodeInviteRequest(w http.ResponseWriter, r *http.Request) (*inviteRequest, error) {
+	var req inviteRequest
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return nil, err
+	}
+
+	req.Email = strings.TrimSpace(req.Email)
+	if req.MaxUses == 0 {
+		req.MaxUses = 1
+	}
+	if req.MaxUses < 0 ||
+		(req.Email != "" && !utils.ValidateEmail(req.Email)) ||
+		(req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now())) {
+		return nil, errs.ErrValidation
+	}
+	return &req, nil
+}
+
+// createInvite stores a new code and builds the response with the code and,
+// if the web app URL is configured, a sign-up link.
+func (s *InviteServiceImpl) createInvite(ctx context.Context, createdBy string, req *inviteRequest) (map[string]any, error) {
+	secret, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, err
+	}
+	code := inviteCodePrefix + secret
+
+	expiresAt := time.Now().UTC().Add(inviteTTL())
+	if req.ExpiresAt != nil {
+		expiresAt = req.ExpiresAt.UTC()
+	}
+
+	invite := &model.Invite{
+		ID:        uuid.New().String(),
+		Prefix:    code[:inviteCodePrefixShown],
+		CodeHash:  utils.HashToken(code),
+		CreatedBy: createdBy,
+		Email:     req.Email,
+		MaxUses:   req.MaxUses,
+		ExpiresAt: expiresAt,
+	}
+	if err := s.inviteRepo.CreateInvite(ctx, invite); err != nil {
+		return nil, err
+	}
+
+	logger.L().Info("invite code created",
+		zap.String("user_id", createdBy),
+		zap.String("invite_id", invite.ID),
+		zap.Int("max_uses", invite.MaxUses),
+	)
+
+	responseData := map[string]any{
+		"code":   code,
+		"invite": invite,
+	}
+	if appURL := config.Config.Mail.AppURL; appURL != "" {
+		responseData["url"] = fmt.Sprintf("%s/register?invite=%s", strings.TrimRight(appURL, "/"), url.QueryEscape(code))
+	}
+	return responseData, nil
+}
+
+func (s *InviteServiceImpl) listInvites(r *http.Request, createdBy string) (int, *utils.APIResponse, error) {
+	limit := 50
+	offset := 0
+
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if l, err := strconv.Atoi(limitStr); err == nil && l > 0 && l <= 100 {
+			limit = l
+		}
+	}
+	if offsetStr := r.URL.Query().Get("offset"); offsetStr != "" {
+		if o, err := strconv.Atoi(offsetStr); err == nil && o >= 0 {
+			offset = o
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	invites, err := s.inviteRepo.ListInvites(ctx, createdBy, limit, offset)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.InviteService.ListInvites", err)
+	}
+
+	responseData := map[string]any{
+		"invites": invites,
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+func (s *InviteServiceImpl) revokeInvite(r *http.Request, createdBy string) (int, *utils.APIResponse, error) {
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := s.inviteRepo.RevokeInvite(ctx, id, createdBy); err != nil {
+		if errs.Is(err, errs.ErrNotFound) {
+			return http.StatusNotFound, nil, errs.ErrNotFound
+		}
+		return http.StatusInternalServerError, nil, errs.Wrap("service.InviteService.RevokeInvite", err)
+	}
+	return http.StatusOK, nil, nil
+}
+
+// inviteTTL is the default lifetime of new codes and the longest one users
+// may pick.
+func inviteTTL() time.Duration {
+	if ttl := config.Config.Registration.InviteTTL; ttl > 0 {
+		return ttl
+	}
+	return defaultInviteTTL
+}
+
+// registrationMode is the configured mode. Unknown values close sign-ups
+// rather than silently opening them.
+func registrationMode() string {
+	switch mode := config.Config.Registration.Mode; mode {
+	case "":
+		return model.RegistrationOpen
+	case model.RegistrationOpen, model.RegistrationInviteOnly, model.RegistrationClosed:
+		return mode
+	default:
+		return model.RegistrationClosed
+	}
+}
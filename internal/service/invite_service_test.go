@@ -0,0 +1,125 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+)
+
+type fakeInviteRepo struct {
+	created *model.Invite
+	active  int
+}
+
+func (f *fakeInviteRepo) CreateInvite(_ context.Context, invite *model.Invite) error {
+	f.created = invite
+	return nil
+}
+
+func (f *fakeInviteRepo) ListInvites(context.Context, string, int, int) ([]*model.Invite, error) {
+	return nil, nil
+}
+
+func (f *fakeInviteRepo) RevokeInvite(context.Context, string, string) error { return nil }
+
+func (f *fakeInviteRepo) CountActiveInvites(context.Context, string, time.Time) (int, error) {
+	return f.active, nil
+}
+
+func TestRegisterFollowsRegistrationMode(t *testing.T) {
+	useTestJWTConfig(t)
+
+	inviteHash := utils.HashToken("inv_good")
+	register := func(mode, body string) (*fakeUserRepo, int, error) {
+		config.Config.Registration.Mode = mode
+		users := &fakeUserRepo{invites: map[string]string{inviteHash: "inviter-1"}}
+		service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: &fakeSessionRepo{}, VerificationRepo: &fakeVerificationRepo{}, AuthStore: &fakeAuthStore{}, Mailer: &fakeMailer{}, Publisher: &fakePublisher{}})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/register", bytes.NewBufferString(body))
+		status, _, err := service.Register(httptest.NewRecorder(), req)
+		return users, status, err
+	}
+	plain := `{"username":"alice","email":"a@example.com","password":"password-1"}`
+	invited := `{"username":"alice","email":"a@example.com","password":"password-1","invite_code":"inv_good"}`
+
+	if _, status, err := register(model.RegistrationClosed, invited); status != http.StatusForbidden || !errors.Is(err, errs.ErrRegistrationClosed) {
+		t.Fatalf("expected closed registration, got %d %v", status, err)
+	}
+	if _, status, err := register("bogus", plain); status != http.StatusForbidden || !errors.Is(err, errs.ErrRegistrationClosed) {
+		t.Fatalf("expected an unknown mode to close registration, got %d %v", status, err)
+	}
+	if _, status, err := register(model.RegistrationInviteOnly, plain); status != http.StatusForbidden || !errors.Is(err, errs.ErrInviteRequired) {
+		t.Fatalf("expected an invite to be required, got %d %v", status, err)
+	}
+	bad := `{"username":"alice","email":"a@example.com","password":"password-1","invite_code":"inv_bad"}`
+	if users, status, err := register(model.RegistrationInviteOnly, bad); status != http.StatusForbidden || !errors.Is(err, errs.ErrInvalidInvite) || users.created != nil {
+		t.Fatalf("expected an unknown invite to be rejected, got %d %v", status, err)
+	}
+
+	users, status, err := register(model.RegistrationInviteOnly, invited)
+	if status != http.StatusCreated || err != nil || users.created == nil || users.created.InvitedBy != "inviter-1" {
+		t.Fatalf("expected an invited account, got %d %v %#v", status, err, users.created)
+	}
+	if users, status, err := register(model.RegistrationOpen, plain); status != http.StatusCreated || err != nil || users.created.InvitedBy != "" {
+		t.Fatalf("expected open registration without invite, got %d %v", status, err)
+	}
+}
+
+func TestCreateInviteEnforcesUserLimits(t *testing.T) {
+	oldConfig := config.Config
+	t.Cleanup(func() { config.Config = oldConfig })
+	config.Config.Registration = config.RegistrationConfig{UserInvites: true, MaxUserInviteUses: 3, InviteTTL: 24 * time.Hour}
+
+	verified := &model.User{ID: "user-1"}
+	verified.VerifiedAt.Valid = true
+
+	create := func(user *model.User, invites *fakeInviteRepo, body string) (int, map[string]any, error) {
+		service := NewInviteServiceImpl(invites, &fakeUserRepo{user: user})
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/invites", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+		status, resp, err := service.CreateInvite(httptest.NewRecorder(), req)
+		if resp == nil {
+			return status, nil, err
+		}
+		return status, resp.Data.(map[string]any), err
+	}
+
+	tooLate := time.Now().Add(48 * time.Hour).Format(time.RFC3339)
+	for _, body := range []string{`{"max_uses":4}`, `{"max_uses":-1}`, `{"email":"nope"}`, `{"expires_at":"` + tooLate + `"}`} {
+		if status, _, err := create(verified, &fakeInviteRepo{}, body); status != http.StatusBadRequest || !errors.Is(err, errs.ErrValidation) {
+			t.Fatalf("expected %s to be rejected, got %d %v", body, status, err)
+		}
+	}
+	if status, _, err := create(&model.User{ID: "user-1"}, &fakeInviteRepo{}, `{}`); status != http.StatusForbidden || !errors.Is(err, errs.ErrEmailNotVerified) {
+		t.Fatalf("expected unverified users to be refused, got %d %v", status, err)
+	}
+	if status, _, err := create(verified, &fakeInviteRepo{active: maxActiveUserInvites}, `{}`); status != http.StatusConflict || !errors.Is(err, errs.ErrTooManyInvites) {
+		t.Fatalf("expected the active invite cap, got %d %v", status, err)
+	}
+
+	invites := &fakeInviteRepo{}
+	status, data, err := create(verified, invites, `{"max_uses":3,"email":"b@example.com"}`)
+	if status != http.StatusCreated || err != nil {
+		t.Fatalf("expected an invite, got %d %v", status, err)
+	}
+	code, _ := data["code"].(string)
+	stored := invites.created
+	if stored.CodeHash != utils.HashToken(code) || stored.Prefix != code[:inviteCodePrefixShown] || stored.CreatedBy != "user-1" ||
+		stored.MaxUses != 3 || stored.Email != "b@example.com" || stored.ExpiresAt.After(time.Now().Add(24*time.Hour)) {
+		t.Fatalf("unexpected stored invite %#v", stored)
+	}
+
+	config.Config.Registration.UserInvites = false
+	if status, _, err := create(verified, &fakeInviteRepo{}, `{}`); status != http.StatusForbidden || !errors.Is(err, errs.ErrForbidden) {
+		t.Fatalf("expected user invites to be switchable off, got %d %v", status, err)
+	}
+}
@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/logger"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultLockoutFreeAttempts = 3
+	defaultLockoutMaxAttempts  = 10
+	defaultLockoutWindow       = 15 * time.Minute
+	defaultLockoutDuration     = 15 * time.Minute
+
+	loginDelayBase = time.Second
+)
+
+// dummyPasswordHashes holds a hash per supported algorithm, made with the
+// configured parameters, for checkPassword to compare against.
+var dummyPasswordHashes = sync.OnceValue(func() map[string]string {
+	hashes := map[string]string{}
+	for _, algorithm := range []string{utils.PasswordArgon2id, utils.PasswordBcrypt} {
+		hashes[algorithm], _ = utils.HashPasswordWith(algorithm, "not-a-real-password")
+	}
+	return hashes
+})
+
+// checkPassword compares a login password with the stored hash, and with a
+// dummy of every other supported algorithm. Each login so costs one
+// comparison per algorithm, and the response takes as long for unknown
+// emails, password-less accounts and legacy hashes as for any other.
+func checkPassword(hash, password string) bool {
+	algorithm := utils.PasswordAlgorithm(hash)
+	for other, dummy := range dummyPasswordHashes() {
+		if other != algorithm {
+			utils.ComparePassword(dummy, password)
+		}
+	}
+	return algorithm != "" && utils.ComparePassword(hash, password)
+}
+
+// loginAccountKey is the throttling key of a login address. It is hashed so
+// Redis never holds the addresses themselves.
+func loginAccountKey(email string) string {
+	return utils.HashToken(utils.NormalizeEmail(email))
+}
+
+func lockoutPolicy() config.LockoutConfig {
+	policy := config.Config.Lockout
+	if policy.FreeAttempts <= 0 {
+		policy.FreeAttempts = defaultLockoutFreeAttempts
+	}
+	if policy.MaxAttempts <= policy.FreeAttempts {
+		policy.MaxAttempts = max(defaultLockoutMaxAttempts, policy.FreeAttempts+1)
+	}
+	if policy.Window <= 0 {
+		policy.Window = defaultLockoutWindow
+	}
+	if policy.Duration <= 0 {
+		policy.Duration = defaultLockoutDuration
+	}
+	return policy
+}
+
+// loginDelay is how long an account is blocked after its nth failure: nothing
+// for the free attempts, then 1s, 2s, 4s, ... and the full lockout at the max.
+func loginDelay(policy config.LockoutConfig, failures int64) time.Duration {
+	if failures >= int64(policy.MaxAttempts) {
+		return policy.Duration
+	}
+	extra := failures - int64(policy.FreeAttempts)
+	if extra <= 0 {
+		return 0
+	}
+	return min(loginDelayBase<<(extra-1), policy.Duration)
+}
+
+// accountLocked answers 429 while the account of email is locked out.
+// Handlers that check a password or second factor of a logged in user call
+// it first and count wrong answers with loginFailed, so a stolen session
+// guesses no faster than Login allows.
+func (s *UserServiceImpl) accountLocked(ctx context.Context, w http.ResponseWriter, email string) (int, error) {
+	wait, err := s.authStore.LoginBlockedFor(ctx, loginAccountKey(email))
+	if err != nil {
+		return http.StatusInternalServerError, errs.Wrap("service.UserService.accountLocked", err)
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return http.StatusTooManyRequests, errs.ErrTooManyAttempts
+	}
+	return http.StatusOK, nil
+}
+
+// loginFailed counts a failed login and blocks the account for the resulting
+// delay. Reaching the lockout is recorded as a security event.
+func (s *UserServiceImpl) loginFailed(ctx context.Context, r *http.Request, account, email string, user *model.User) error {
+	policy := lockoutPolicy()
+
+	failures, err := s.authStore.RecordLoginFailure(ctx, account, policy.Window)
+	if err != nil {
+		return errs.Wrap("service.UserService.loginFailed", err)
+	}
+
+	delay := loginDelay(policy, failures)
+	if delay == 0 {
+		return nil
+	}
+	if err := s.authStore.BlockLogin(ctx, account, delay); err != nil {
+		return errs.Wrap("service.UserService.loginFailed", err)
+	}
+	if failures != int64(policy.MaxAttempts) {
+		return nil
+	}
+
+	event := &model.SecurityEvent{
+		Type:      model.SecurityEventLoginLockout,
+		Subject:   utils.NormalizeEmail(email),
+		IP:        middleware.ClientIP(r),
+		UserAgent: r.UserAgent(),
+	}
+	if user != nil {
+		event.UserID = sql.NullString{String: user.ID, Valid: true}
+	}
+	if err := s.securityRepo.Record(ctx, event); err != nil {
+		return errs.Wrap("service.UserService.loginFailed", err)
+	}
+	logger.L().Warn("login locked out",
+		zap.String("account", account),
+		zap.String("ip", event.IP),
+		zap.Int64("failures", failures),
+	)
+	return nil
+}
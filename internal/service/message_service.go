@@ -25,10 +25,11 @@ type MessageServiceImpl struct {
 	messageRepo repository.MessageRepository
 	friendRepo  repository.FriendRepository
 	blockRepo   repository.BlockRepository
+	userRepo    repository.UserRepository
 }
 
-func NewMessageServiceImpl(messageRepo repository.MessageRepository, friendRepo repository.FriendRepository, blockRepo repository.BlockRepository) *MessageServiceImpl {
-	return &MessageServiceImpl{messageRepo: messageRepo, friendRepo: friendRepo, blockRepo: blockRepo}
+func NewMessageServiceImpl(messageRepo repository.MessageRepository, friendRepo repository.FriendRepository, blockRepo repository.BlockRepository, userRepo repository.UserRepository) *MessageServiceImpl {
+	return &MessageServiceImpl{messageRepo: messageRepo, friendRepo: friendRepo, blockRepo: blockRepo, userRepo: userRepo}
 }
 
 func (s *MessageServiceImpl) CreateMessage(ctx context.Context, senderID, receiverID, body string, isGroup bool) (*model.Message, error) {
@@ -38,24 +39,11 @@ func (s *MessageServiceImpl) CreateMessage(ctx context.Context, senderID, receiv
 	}
 
 	if !isGroup {
-		if s.friendRepo == nil || s.blockRepo == nil {
+		if s.friendRepo == nil || s.blockRepo == nil || s.userRepo == nil {
 			return nil, errs.ErrInternal
 		}
-
-		blocked, err := s.blockRepo.IsBlocked(ctx, senderID, receiverID)
-		if err != nil {
-			return nil, errs.Wrap("service.MessageService.CreateMessage", err)
-		}
-		if blocked {
-			return nil, errs.ErrBlockedRelationship
-		}
-
-		areFriends, err := s.friendRepo.AreFriends(ctx, senderID, receiverID)
-		if err != nil {
-			return nil, errs.Wrap("service.MessageService.CreateMessage", err)
-		}
-		if !areFriends {
-			return nil, errs.ErrForbidden
+		if err := s.checkCanMessage(ctx, senderID, receiverID); err != nil {
+			return nil, err
 		}
 	}
 
@@ -76,6 +64,36 @@ func (s *MessageServiceImpl) CreateMessage(ctx context.Context, senderID, receiv
 	return msg, nil
 }
 
+// checkCanMessage tells whether senderID may send a direct message to
+// receiverID: neither has blocked the other and they are friends, unless one
+// of them is a bot.
+func (s *MessageServiceImpl) checkCanMessage(ctx context.Context, senderID, receiverID string) error {
+	blocked, err := s.blockRepo.IsBlocked(ctx, senderID, receiverID)
+	if err != nil {
+		return errs.Wrap("service.MessageService.checkCanMessage", err)
+	}
+	if blocked {
+		return errs.ErrBlockedRelationship
+	}
+
+	areFriends, err := s.friendRepo.AreFriends(ctx, senderID, receiverID)
+	if err != nil {
+		return errs.Wrap("service.MessageService.checkCanMessage", err)
+	}
+	if !areFriends {
+		// Bots talk to anyone who has not blocked them, and people can
+		// answer them without becoming friends
+		withBot, err := s.userRepo.IsBot(ctx, senderID, receiverID)
+		if err != nil {
+			return errs.Wrap("service.MessageService.checkCanMessage", err)
+		}
+		if !withBot {
+			return errs.ErrForbidden
+		}
+	}
+	return nil
+}
+
 func (s *MessageServiceImpl) GetConversation(ctx context.Context, userID, otherUserID string, limit, offset int) (model.Messages, error) {
 	if limit <= 0 {
 		limit = 50
@@ -129,5 +147,15 @@ func (s *MessageServiceImpl) GetMessages(w http.ResponseWriter, r *http.Request)
 		"limit":    limit,
 		"offset":   offset,
 	}
+
+	// History with former friends stays readable, but clients should not
+	// offer to reply
+	if s.friendRepo != nil && s.blockRepo != nil && s.userRepo != nil {
+		err := s.checkCanMessage(r.Context(), userID, otherUserID)
+		if err != nil && !errs.Is(err, errs.ErrForbidden) && !errs.Is(err, errs.ErrBlockedRelationship) {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.MessageService.GetMessages", err)
+		}
+		responseData["read_only"] = err != nil
+	}
 	return http.StatusOK, utils.SuccessResponse(responseData), nil
 }
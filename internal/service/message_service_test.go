@@ -33,27 +33,69 @@ func (f *fakeMessageRepo) GetMessagesBetweenUsers(context.Context, string, strin
 	return f.messages, f.err
 }
 
+func (f *fakeMessageRepo) GetMessagesForUser(_ context.Context, _ string, limit, offset int) (model.Messages, error) {
+	if offset >= len(f.messages) {
+		return nil, f.err
+	}
+	return f.messages[offset:min(offset+limit, len(f.messages))], f.err
+}
+
 type fakeFriendRepo struct {
-	areFriends bool
-	err        error
+	areFriends  bool
+	mutual      bool
+	err         error
+	friendIDs   []string
+	suggestions model.FriendSuggestionsDTO
+	friends     model.FriendsDTO
 }
 
 func (f fakeFriendRepo) CreateFriendship(context.Context, string, string) error { return nil }
 
+func (f fakeFriendRepo) RemoveFriendship(context.Context, string, string) (bool, error) {
+	return f.areFriends, f.err
+}
+
 func (f fakeFriendRepo) AreFriends(context.Context, string, string) (bool, error) {
 	return f.areFriends, f.err
 }
 
-func (f fakeFriendRepo) ListFriends(context.Context, string, int, int) (model.FriendsDTO, error) {
-	return nil, nil
+func (f fakeFriendRepo) HaveMutualFriend(context.Context, string, string) (bool, error) {
+	return f.mutual, f.err
+}
+
+func (f fakeFriendRepo) ListFriends(_ context.Context, _ string, _ int, offset int) (model.FriendsDTO, error) {
+	if offset > 0 {
+		return nil, nil
+	}
+	return f.friends, nil
+}
+
+func (f fakeFriendRepo) ListFriendIDs(context.Context, string) ([]string, error) {
+	return f.friendIDs, f.err
+}
+
+func (f fakeFriendRepo) CountFriends(context.Context, string) (int, error) {
+	return len(f.friendIDs), f.err
+}
+
+func (f fakeFriendRepo) ListMutualFriends(context.Context, string, string, int, int) ([]*model.UserSummaryDTO, error) {
+	return []*model.UserSummaryDTO{}, f.err
+}
+
+func (f fakeFriendRepo) SuggestFriends(_ context.Context, _ string, limit int) (model.FriendSuggestionsDTO, error) {
+	return f.suggestions[:min(limit, len(f.suggestions))], f.err
 }
 
 type fakeBlockRepo struct {
-	blocked bool
-	err     error
+	blocked    bool
+	err        error
+	blocks     model.BlocksDTO
+	unfriended bool
 }
 
-func (f fakeBlockRepo) BlockUser(context.Context, string, string) error { return nil }
+func (f fakeBlockRepo) BlockUser(context.Context, string, string, string) (bool, error) {
+	return f.unfriended, f.err
+}
 
 func (f fakeBlockRepo) UnblockUser(context.Context, string, string) error { return nil }
 
@@ -61,6 +103,20 @@ func (f fakeBlockRepo) IsBlocked(context.Context, string, string) (bool, error)
 	return f.blocked, f.err
 }
 
+// ListBlocks pages through blocks, which are kept newest first.
+func (f fakeBlockRepo) ListBlocks(_ context.Context, _ string, after *model.BlockCursor, limit int) (model.BlocksDTO, error) {
+	start := 0
+	if after != nil {
+		for i, b := range f.blocks {
+			if b.BlockedID == after.BlockedID {
+				start = i + 1
+			}
+		}
+	}
+	end := min(start+limit, len(f.blocks))
+	return f.blocks[start:end], f.err
+}
+
 func TestGetMessagesUsesMiddlewareUserIDKey(t *testing.T) {
 	repo := fakeMessageRepo{
 		messages: model.Messages{
@@ -75,7 +131,7 @@ func TestGetMessagesUsesMiddlewareUserIDKey(t *testing.T) {
 		},
 	}
 
-	service := NewMessageServiceImpl(&repo, nil, nil)
+	service := NewMessageServiceImpl(&repo, nil, nil, nil)
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/messages?user_id=user-2&limit=50&offset=0", nil)
 	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
 
@@ -104,7 +160,7 @@ func TestGetMessagesUsesMiddlewareUserIDKey(t *testing.T) {
 
 func TestGetMessagesRejectsMissingMiddlewareUserIDKey(t *testing.T) {
 	repo := fakeMessageRepo{}
-	service := NewMessageServiceImpl(&repo, nil, nil)
+	service := NewMessageServiceImpl(&repo, nil, nil, nil)
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/messages?user_id=user-2", nil)
 	req = req.WithContext(context.WithValue(req.Context(), "userID", "user-1"))
 
@@ -122,7 +178,7 @@ func TestGetMessagesRejectsMissingMiddlewareUserIDKey(t *testing.T) {
 
 func TestGetMessagesReturnsEmptySliceWhenNoMessages(t *testing.T) {
 	repo := fakeMessageRepo{messages: nil}
-	service := NewMessageServiceImpl(&repo, nil, nil)
+	service := NewMessageServiceImpl(&repo, nil, nil, nil)
 	req := httptest.NewRequest(http.MethodGet, "/api/v1/messages?user_id=user-2", nil)
 	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
 
@@ -152,7 +208,7 @@ func TestGetMessagesReturnsEmptySliceWhenNoMessages(t *testing.T) {
 
 func TestCreateMessageRequiresFriendship(t *testing.T) {
 	repo := &fakeMessageRepo{}
-	service := NewMessageServiceImpl(repo, fakeFriendRepo{areFriends: false}, fakeBlockRepo{})
+	service := NewMessageServiceImpl(repo, fakeFriendRepo{areFriends: false}, fakeBlockRepo{}, &fakeUserRepo{})
 
 	_, err := service.CreateMessage(context.Background(), "user-1", "user-2", "hello", false)
 	if !errors.Is(err, errs.ErrForbidden) {
@@ -163,9 +219,28 @@ func TestCreateMessageRequiresFriendship(t *testing.T) {
 	}
 }
 
+func TestGetMessagesMarksFormerFriendsReadOnly(t *testing.T) {
+	repo := &fakeMessageRepo{messages: model.Messages{{ID: "m1", SenderID: "user-1", ReceiverID: "user-2", Body: "hello"}}}
+
+	for _, friends := range []bool{true, false} {
+		service := NewMessageServiceImpl(repo, fakeFriendRepo{areFriends: friends}, fakeBlockRepo{}, &fakeUserRepo{})
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/messages?user_id=user-2", nil)
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+
+		status, resp, err := service.GetMessages(httptest.NewRecorder(), req)
+		if err != nil || status != http.StatusOK {
+			t.Fatalf("expected history to stay readable, got %d %v", status, err)
+		}
+		data := resp.Data.(map[string]any)
+		if len(data["messages"].(model.Messages)) != 1 || data["read_only"] != !friends {
+			t.Fatalf("friends=%v: unexpected response %#v", friends, data)
+		}
+	}
+}
+
 func TestCreateMessageRejectsBlockedRelationship(t *testing.T) {
 	repo := &fakeMessageRepo{}
-	service := NewMessageServiceImpl(repo, fakeFriendRepo{areFriends: true}, fakeBlockRepo{blocked: true})
+	service := NewMessageServiceImpl(repo, fakeFriendRepo{areFriends: true}, fakeBlockRepo{blocked: true}, &fakeUserRepo{})
 
 	_, err := service.CreateMessage(context.Background(), "user-1", "user-2", "hello", false)
 	if !errors.Is(err, errs.ErrBlockedRelationship) {
@@ -178,7 +253,7 @@ func TestCreateMessageRejectsBlockedRelationship(t *testing.T) {
 
 func TestCreateMessagePersistsForFriends(t *testing.T) {
 	repo := &fakeMessageRepo{}
-	service := NewMessageServiceImpl(repo, fakeFriendRepo{areFriends: true}, fakeBlockRepo{})
+	service := NewMessageServiceImpl(repo, fakeFriendRepo{areFriends: true}, fakeBlockRepo{}, &fakeUserRepo{})
 
 	msg, err := service.CreateMessage(context.Background(), "user-1", "user-2", " hello ", false)
 	if err != nil {
@@ -191,3 +266,20 @@ func TestCreateMessagePersistsForFriends(t *testing.T) {
 		t.Fatalf("expected trimmed body, got %q", msg.Body)
 	}
 }
+
+func TestCreateMessageAllowsBotsWithoutFriendship(t *testing.T) {
+	repo := &fakeMessageRepo{}
+	users := &fakeUserRepo{botIDs: []string{"bot-1"}}
+
+	for _, pair := range [][2]string{{"bot-1", "user-2"}, {"user-2", "bot-1"}} {
+		service := NewMessageServiceImpl(repo, fakeFriendRepo{areFriends: false}, fakeBlockRepo{}, users)
+		if _, err := service.CreateMessage(context.Background(), pair[0], pair[1], "hello", false); err != nil {
+			t.Fatalf("expected %s -> %s to be allowed, got %v", pair[0], pair[1], err)
+		}
+	}
+
+	service := NewMessageServiceImpl(repo, fakeFriendRepo{areFriends: false}, fakeBlockRepo{blocked: true}, users)
+	if _, err := service.CreateMessage(context.Background(), "bot-1", "user-2", "hello", false); !errors.Is(err, errs.ErrBlockedRelationship) {
+		t.Fatalf("expected blocks to apply to bots, got %v", err)
+	}
+}
@@ -0,0 +1,54 @@
+package service
+
+import (
+	"context"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/repository"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+)
+
+// PresenceService decides who hears about a user going online or offline,
+// following the user's presence setting.
+type PresenceService interface {
+	// PresenceAudience returns everyone=true if all connected users may see
+	// userID's presence, else the users who may (never userID itself).
+	PresenceAudience(ctx context.Context, userID string) (everyone bool, userIDs []string, err error)
+	// MarkOffline records userID's last seen time.
+	MarkOffline(ctx context.Context, userID string) error
+}
+
+type PresenceServiceImpl struct {
+	userRepo   repository.UserRepository
+	friendRepo repository.FriendRepository
+}
+
+func NewPresenceServiceImpl(userRepo repository.UserRepository, friendRepo repository.FriendRepository) *PresenceServiceImpl {
+	return &PresenceServiceImpl{userRepo: userRepo, friendRepo: friendRepo}
+}
+
+func (s *PresenceServiceImpl) PresenceAudience(ctx context.Context, userID string) (bool, []string, error) {
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return false, nil, errs.Wrap("service.PresenceService.PresenceAudience", err)
+	}
+	if user == nil {
+		return false, nil, nil
+	}
+
+	switch user.Privacy.Presence {
+	case model.AudienceEveryone:
+		return true, nil, nil
+	case model.AudienceFriends:
+		ids, err := s.friendRepo.ListFriendIDs(ctx, userID)
+		if err != nil {
+			return false, nil, errs.Wrap("service.PresenceService.PresenceAudience", err)
+		}
+		return false, ids, nil
+	}
+	return false, nil, nil
+}
+
+func (s *PresenceServiceImpl) MarkOffline(ctx context.Context, userID string) error {
+	return errs.Wrap("service.PresenceService.MarkOffline", s.userRepo.TouchLastSeen(ctx, userID))
+}
@@ -0,0 +1,339 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+	"github.com/ak-repo/go-chat-system/internal/platform/oidc"
+	"github.com/ak-repo/go-chat-system/internal/repository"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/logger"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	ssoStateTTL       = 10 * time.Minute
+	ssoStateCookie    = "oidc_state"
+	ssoCookiePath     = "/api/v1/auth/oidc"
+	maxHandleAttempts = 5
+	maxHandleLength   = 30
+)
+
+var nonHandleChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+// SSOProvider is the OpenID provider users sign in with.
+type SSOProvider interface {
+	Name() string
+	AuthCodeURL(ctx context.Context, state, nonce, codeChallenge string) (string, error)
+	Exchange(ctx context.Context, code, codeVerifier, nonce string) (*oidc.Identity, error)
+}
+
+// SSOService signs users in through an external OpenID provider, next to
+// the password login.
+type SSOService interface {
+	StartSSO(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	SSOCallback(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+}
+
+type SSOServiceImpl struct {
+	users        *UserServiceImpl // issues sessions and MFA challenges like Login
+	userRepo     repository.UserRepository
+	identityRepo repository.IdentityRepository
+	authStore    repository.AuthStore
+	provider     SSOProvider
+}
+
+func NewSSOServiceImpl(users *UserServiceImpl,
+	userRepo repository.UserRepository,
+	identityRepo repository.IdentityRepository,
+	authStore repository.AuthStore,
+	provider SSOProvider) *SSOServiceImpl {
+	return &SSOServiceImpl{
+		users:        users,
+		userRepo:     userRepo,
+		identityRepo: identityRepo,
+		authStore:    authStore,
+		provider:     provider,
+	}
+}
+
+// POST -> authorization URL to send the browser to. The PKCE verifier and
+// nonce stay on the server, keyed by the state; the browser gets the state
+// hash in a cookie so only it can finish the sign-in.
+func (s *SSOServiceImpl) StartSSO(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var secrets [3]string // state, code verifier, nonce
+	for i := range secrets {
+		token, err := utils.GenerateRandomToken(32)
+		if err != nil {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.SSOService.StartSSO", err)
+		}
+		secrets[i] = token
+	}
+	state, verifier, nonce := secrets[0], secrets[1], secrets[2]
+
+	if err := s.authStore.SetOIDCState(ctx, utils.HashToken(state), verifier, nonce, ssoStateTTL); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.SSOService.StartSSO", err)
+	}
+
+	authURL, err := s.provider.AuthCodeURL(ctx, state, nonce, oidc.CodeChallenge(verifier))
+	if err != nil {
+		return http.StatusBadGateway, nil, errs.Wrap("service.SSOService.StartSSO", err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoStateCookie,
+		Value:    utils.HashToken(state),
+		Path:     ssoCookiePath,
+		MaxAge:   int(ssoStateTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	responseData := map[string]any{
+		"authorization_url": authURL,
+		"state":             state,
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// POST -> completes the sign-in with the code and state the provider
+// redirected back with. Answers exactly like Login.
+func (s *SSOServiceImpl) SSOCallback(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	var req struct {
+		Code  string `json:"code"`
+		State string `json:"state"`
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.SSOService.SSOCallback", err)
+	}
+	if !utils.Required(req.Code) || !utils.Required(req.State) {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+
+	// A state started in another browser would sign this one in to
+	// whoever completed the provider login there
+	stateHash := utils.HashToken(req.State)
+	cookie, err := r.Cookie(ssoStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateHash)) != 1 {
+		return http.StatusUnauthorized, nil, errs.ErrSSOFailed
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     ssoStateCookie,
+		Path:     ssoCookiePath,
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	verifier, nonce, err := s.authStore.ConsumeOIDCState(ctx, stateHash)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.SSOService.SSOCallback", err)
+	}
+	if verifier == "" {
+		return http.StatusUnauthorized, nil, errs.ErrSSOFailed
+	}
+
+	identity, err := s.provider.Exchange(ctx, req.Code, verifier, nonce)
+	if err != nil {
+		logger.L().Warn("oidc exchange failed", zap.String("provider", s.provider.Name()), zap.Error(err))
+		return http.StatusUnauthorized, nil, errs.ErrSSOFailed
+	}
+
+	user, status, err := s.resolveUser(ctx, identity)
+	if err != nil {
+		return status, nil, errs.Wrap("service.SSOService.SSOCallback", err)
+	}
+
+	// Local 2FA still applies to accounts that sign in through the provider
+	mfa, err := s.users.mfaRepo.GetMFA(ctx, user.ID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.SSOService.SSOCallback", err)
+	}
+	if mfa.Enabled() {
+		responseData, err := s.users.startMFAChallenge(ctx, user)
+		if err != nil {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.SSOService.SSOCallback", err)
+		}
+		return http.StatusOK, utils.SuccessResponse(responseData), nil
+	}
+
+	responseData, err := s.users.loginResponse(ctx, r, user)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.SSOService.SSOCallback", err)
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// resolveUser finds the account for an external identity: an existing link,
+// else an account with the same verified email (which gets linked), else a
+// new account if auto-provisioning is on.
+func (s *SSOServiceImpl) resolveUser(ctx context.Context, identity *oidc.Identity) (*model.User, int, error) {
+	provider := s.provider.Name()
+
+	userID, err := s.identityRepo.GetUserID(ctx, provider, identity.Subject)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if userID != "" {
+		user, err := s.userRepo.GetByID(ctx, userID)
+		if err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+		// Linked to a deleted account
+		if user == nil {
+			return nil, http.StatusUnauthorized, errs.ErrSSONoAccount
+		}
+		return user, http.StatusOK, nil
+	}
+
+	email := strings.TrimSpace(identity.Email)
+	if email == "" || !identity.EmailVerified || !utils.ValidateEmail(email) {
+		// Without an address the provider vouches for there is nothing
+		// to match or create an account by
+		return nil, http.StatusUnauthorized, errs.ErrSSONoAccount
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+	if user != nil {
+		// Linking an unconfirmed local account would hand it to whoever
+		// registered the address first
+		if !user.VerifiedAt.Valid {
+			return nil, http.StatusConflict, errs.ErrSSOLinkRequired
+		}
+	} else {
+		// New accounts from the provider follow the registration mode;
+		// there is no invite code to check here
+		if !config.Config.OIDC.AutoProvision || registrationMode() != model.RegistrationOpen {
+			return nil, http.StatusForbidden, errs.ErrSSONoAccount
+		}
+		if user, err = s.provision(ctx, identity, email); err != nil {
+			return nil, http.StatusInternalServerError, err
+		}
+	}
+
+	link := &model.UserIdentity{
+		UserID:   user.ID,
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    email,
+	}
+	if err := s.identityRepo.CreateIdentity(ctx, link); err != nil {
+		return nil, http.StatusInternalServerError, err
+	}
+
+	logger.L().Info("external identity linked",
+		zap.String("user_id", user.ID),
+		zap.String("provider", provider),
+	)
+	return user, http.StatusOK, nil
+}
+
+// provision creates a verified, password-less account for a new identity.
+// The password can be set later through the reset flow.
+func (s *SSOServiceImpl) provision(ctx context.Context, identity *oidc.Identity, email string) (*model.User, error) {
+	now := time.Now().UTC()
+	user := &model.User{
+		ID:         uuid.New().String(),
+		Email:      email,
+		Role:       string(model.RoleUser),
+		CreatedAt:  now,
+		ModifiedAt: now,
+	}
+
+	base := handleFromIdentity(identity, email)
+	for attempt := 0; ; attempt++ {
+		if attempt == maxHandleAttempts {
+			return nil, errs.Wrap("service.SSOService.provision", errs.ErrHandleTaken)
+		}
+
+		handle := base
+		if attempt > 0 {
+			suffix, err := utils.GenerateOTP(4)
+			if err != nil {
+				return nil, errs.Wrap("service.SSOService.provision", err)
+			}
+			handle = base[:min(len(base), maxHandleLength-len(suffix)-1)] + "_" + suffix
+		}
+		available, err := s.userRepo.IsHandleAvailable(ctx, handle, "")
+		if err != nil {
+			return nil, errs.Wrap("service.SSOService.provision", err)
+		}
+		if !available || !utils.ValidateHandle(handle) {
+			continue
+		}
+
+		user.Username = handle
+		err = s.userRepo.CreateUser(ctx, user)
+		if errs.Is(err, errs.ErrHandleTaken) {
+			continue
+		}
+		if err != nil {
+			return nil, errs.Wrap("service.SSOService.provision", err)
+		}
+		break
+	}
+
+	if err := s.userRepo.MarkVerified(ctx, user.ID); err != nil {
+		return nil, errs.Wrap("service.SSOService.provision", err)
+	}
+	user.VerifiedAt.Valid = true
+	user.VerifiedAt.Time = now
+
+	if name := strings.TrimSpace(identity.Name); name != "" && utils.MaxLength(name, maxDisplayNameLength) {
+		user.DisplayName = name
+		if err := s.userRepo.UpdateProfile(ctx, user.ID, &user.Profile); err != nil {
+			return nil, errs.Wrap("service.SSOService.provision", err)
+		}
+	}
+
+	logger.L().Info("account provisioned from external identity",
+		zap.String("user_id", user.ID),
+		zap.String("provider", s.provider.Name()),
+	)
+	return user, nil
+}
+
+// handleFromIdentity derives a handle from the preferred username or the
+// email's local part.
+func handleFromIdentity(identity *oidc.Identity, email string) string {
+	name := identity.PreferredUsername
+	if at := strings.IndexByte(name, '@'); at >= 0 {
+		name = name[:at]
+	}
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+
+	handle := strings.Trim(nonHandleChars.ReplaceAllString(name, "_"), "_")
+	if len(handle) > maxHandleLength {
+		handle = handle[:maxHandleLength]
+	}
+	for len(handle) < 3 {
+		handle += "_"
+	}
+	return handle
+}
@@ -0,0 +1,219 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+	"github.com/ak-repo/go-chat-system/internal/platform/oidc"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+)
+
+type fakeIdentityRepo struct {
+	links   map[string]string // subject -> user id
+	created *model.UserIdentity
+}
+
+func (f *fakeIdentityRepo) GetUserID(_ context.Context, _, subject string) (string, error) {
+	return f.links[subject], nil
+}
+
+func (f *fakeIdentityRepo) CreateIdentity(_ context.Context, identity *model.UserIdentity) error {
+	f.created = identity
+	return nil
+}
+
+// fakeSSOProvider accepts one code and checks that it comes with the
+// verifier and nonce of the started sign-in.
+type fakeSSOProvider struct {
+	code      string
+	challenge string
+	nonce     string
+	identity  *oidc.Identity
+}
+
+func (f *fakeSSOProvider) Name() string { return "test-idp" }
+
+func (f *fakeSSOProvider) AuthCodeURL(_ context.Context, state, nonce, codeChallenge string) (string, error) {
+	f.challenge = codeChallenge
+	f.nonce = nonce
+	return "https://idp.example.com/authorize?state=" + url.QueryEscape(state), nil
+}
+
+func (f *fakeSSOProvider) Exchange(_ context.Context, code, codeVerifier, nonce string) (*oidc.Identity, error) {
+	if code != f.code || oidc.CodeChallenge(codeVerifier) != f.challenge || nonce != f.nonce {
+		return nil, errors.New("invalid grant")
+	}
+	return f.identity, nil
+}
+
+// startSSO starts a sign-in and returns its state and the cookies the
+// browser keeps for the callback.
+func startSSO(t *testing.T, service *SSOServiceImpl) (string, []*http.Cookie) {
+	t.Helper()
+
+	rec := httptest.NewRecorder()
+	_, resp, err := service.StartSSO(rec, httptest.NewRequest(http.MethodPost, "/api/v1/auth/oidc/start", nil))
+	if err != nil {
+		t.Fatalf("StartSSO failed: %v", err)
+	}
+	return resp.Data.(map[string]any)["state"].(string), rec.Result().Cookies()
+}
+
+// signInWithSSO runs the start and callback steps like the web client.
+func signInWithSSO(t *testing.T, service *SSOServiceImpl, code string) (int, map[string]any, error) {
+	t.Helper()
+
+	state, cookies := startSSO(t, service)
+
+	body := `{"code":"` + code + `","state":"` + state + `"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/oidc/callback", bytes.NewBufferString(body))
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	status, resp, err := service.SSOCallback(httptest.NewRecorder(), req)
+	if resp == nil {
+		return status, nil, err
+	}
+	return status, resp.Data.(map[string]any), err
+}
+
+func TestSSOCallbackProvisionsAndLinksNewAccount(t *testing.T) {
+	useTestJWTConfig(t)
+	config.Config.OIDC.AutoProvision = true
+
+	users := &fakeUserRepo{}
+	identities := &fakeIdentityRepo{}
+	provider := &fakeSSOProvider{code: "code-1", identity: &oidc.Identity{
+		Subject:           "sub-1",
+		Email:             "jane@example.com",
+		EmailVerified:     true,
+		Name:              "Jane Doe",
+		PreferredUsername: "jane.doe@example.com",
+	}}
+	userService := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: &fakeSessionRepo{}, MFARepo: &fakeMFARepo{}, AuthStore: &fakeAuthStore{}})
+	service := NewSSOServiceImpl(userService, users, identities, userService.authStore, provider)
+
+	status, data, err := signInWithSSO(t, service, "code-1")
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("expected sign-in, got %d %v", status, err)
+	}
+	if data["token"] == nil || data["email_verified"] != true {
+		t.Fatalf("expected a verified login response, got %#v", data)
+	}
+
+	if users.created == nil || users.created.Username != "jane_doe" || users.created.PasswordHash != "" {
+		t.Fatalf("expected password-less account with derived handle, got %#v", users.created)
+	}
+	if users.profile == nil || users.profile.DisplayName != "Jane Doe" {
+		t.Fatalf("expected display name from the identity, got %#v", users.profile)
+	}
+	if identities.created == nil || identities.created.UserID != users.created.ID || identities.created.Subject != "sub-1" {
+		t.Fatalf("expected identity linked to the new account, got %#v", identities.created)
+	}
+}
+
+func TestSSOCallbackDoesNotLinkUnverifiedAccount(t *testing.T) {
+	useTestJWTConfig(t)
+	config.Config.OIDC.AutoProvision = true
+
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Email: "jane@example.com", Role: "user"}}
+	identities := &fakeIdentityRepo{}
+	provider := &fakeSSOProvider{code: "code-1", identity: &oidc.Identity{
+		Subject: "sub-1", Email: "jane@example.com", EmailVerified: true,
+	}}
+	userService := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: &fakeSessionRepo{}, MFARepo: &fakeMFARepo{}, AuthStore: &fakeAuthStore{}})
+	service := NewSSOServiceImpl(userService, users, identities, userService.authStore, provider)
+
+	status, _, err := signInWithSSO(t, service, "code-1")
+	if status != http.StatusConflict || !errors.Is(err, errs.ErrSSOLinkRequired) {
+		t.Fatalf("expected link conflict, got %d %v", status, err)
+	}
+	if identities.created != nil {
+		t.Fatalf("expected no identity link, got %#v", identities.created)
+	}
+
+	// Once the local address is confirmed the identity links to it
+	users.user.VerifiedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	status, _, err = signInWithSSO(t, service, "code-1")
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("expected sign-in, got %d %v", status, err)
+	}
+	if identities.created == nil || identities.created.UserID != "user-1" {
+		t.Fatalf("expected identity linked to user-1, got %#v", identities.created)
+	}
+}
+
+func TestSSOCallbackRejectsReplayedState(t *testing.T) {
+	useTestJWTConfig(t)
+
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Email: "jane@example.com", Role: "user"}}
+	identities := &fakeIdentityRepo{links: map[string]string{"sub-1": "user-1"}}
+	provider := &fakeSSOProvider{code: "code-1", identity: &oidc.Identity{Subject: "sub-1"}}
+	store := &fakeAuthStore{}
+	userService := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: &fakeSessionRepo{}, MFARepo: &fakeMFARepo{}, AuthStore: store})
+	service := NewSSOServiceImpl(userService, users, identities, store, provider)
+
+	state, cookies := startSSO(t, service)
+	body := `{"code":"code-1","state":"` + state + `"}`
+
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/oidc/callback", bytes.NewBufferString(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		status, _, _ := service.SSOCallback(httptest.NewRecorder(), req)
+		if status != want {
+			t.Fatalf("callback %d: expected status %d, got %d", i+1, want, status)
+		}
+	}
+}
+
+func TestSSOCallbackRejectsStateFromAnotherBrowser(t *testing.T) {
+	useTestJWTConfig(t)
+
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Email: "jane@example.com", Role: "user"}}
+	identities := &fakeIdentityRepo{links: map[string]string{"sub-1": "user-1"}}
+	provider := &fakeSSOProvider{code: "code-1", identity: &oidc.Identity{Subject: "sub-1"}}
+	userService := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: &fakeSessionRepo{}, MFARepo: &fakeMFARepo{}, AuthStore: &fakeAuthStore{}})
+	service := NewSSOServiceImpl(userService, users, identities, userService.authStore, provider)
+
+	// The attacker starts a sign-in, and a victim's browser, which has its
+	// own sign-in cookie or none, is made to post the attacker's state
+	_, victimCookies := startSSO(t, service)
+	attackerState, attackerCookies := startSSO(t, service)
+	body := `{"code":"code-1","state":"` + attackerState + `"}`
+
+	for name, cookies := range map[string][]*http.Cookie{"no cookie": nil, "other sign-in": victimCookies} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/oidc/callback", bytes.NewBufferString(body))
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		status, _, err := service.SSOCallback(httptest.NewRecorder(), req)
+		if status != http.StatusUnauthorized || !errors.Is(err, errs.ErrSSOFailed) {
+			t.Fatalf("%s: expected sign-in to fail, got %d %v", name, status, err)
+		}
+	}
+
+	// The browser that started it can still finish, and the cookie is cleared
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/oidc/callback", bytes.NewBufferString(body))
+	for _, c := range attackerCookies {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	if status, _, err := service.SSOCallback(rec, req); err != nil || status != http.StatusOK {
+		t.Fatalf("expected sign-in from the starting browser, got %d %v", status, err)
+	}
+	cleared := rec.Result().Cookies()
+	if len(cleared) != 1 || cleared[0].Name != ssoStateCookie || cleared[0].MaxAge >= 0 {
+		t.Fatalf("expected the state cookie to be cleared, got %v", cleared)
+	}
+}
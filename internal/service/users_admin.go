@@ -0,0 +1,108 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/logger"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// GET -> full account view of any user, for staff
+func (s *UserServiceImpl) AdminGetUser(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.AdminGetUser", err)
+	}
+	if user == nil {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+
+	responseData := map[string]any{
+		"user": &model.MeDTO{
+			ProfileDTO:    toProfileDTO(user),
+			Email:         user.Email,
+			Role:          user.Role,
+			EmailVerified: user.VerifiedAt.Valid,
+		},
+	}
+	if user.InvitedBy != "" {
+		responseData["invited_by"] = user.InvitedBy
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// PUT -> changes the role of a user. The user's sessions are revoked so no
+// token with the old role stays in use.
+func (s *UserServiceImpl) AdminSetRole(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	adminID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || adminID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+	// Keeps the last admin from locking everyone out by accident
+	if id == adminID {
+		return http.StatusBadRequest, nil, errs.ErrSelfAction
+	}
+
+	var req struct {
+		Role string `json:"role"`
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.UserService.AdminSetRole", err)
+	}
+
+	if !model.ValidRole(req.Role) {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := s.userRepo.UpdateRole(ctx, id, req.Role); err != nil {
+		if errs.Is(err, errs.ErrNotFound) {
+			return http.StatusNotFound, nil, errs.ErrNotFound
+		}
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.AdminSetRole", err)
+	}
+
+	sessionIDs, err := s.sessionRepo.RevokeUserSessions(ctx, id, "")
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.AdminSetRole", err)
+	}
+	if err := s.revokeSessions(ctx, sessionIDs); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.AdminSetRole", err)
+	}
+
+	logger.L().Info("user role changed",
+		zap.String("admin_id", adminID),
+		zap.String("user_id", id),
+		zap.String("role", req.Role),
+	)
+
+	return http.StatusOK, nil, nil
+}
@@ -0,0 +1,493 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+)
+
+const (
+	mfaChallengeTTL      = 5 * time.Minute
+	mfaChallengeAttempts = 5
+	recoveryCodeCount    = 10
+)
+
+// POST -> starts TOTP enrollment. The secret stays pending until a first
+// code is confirmed, so a half-finished setup never locks the user out.
+func (s *UserServiceImpl) EnrollMFA(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	var req struct {
+		Password   string `json:"password"`
+		ReauthCode string `json:"reauth_code"` // accounts without a password
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.UserService.EnrollMFA", err)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.EnrollMFA", err)
+	}
+	if user == nil {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+	if status, err := s.reauthenticate(ctx, w, r, user, req.Password, req.ReauthCode); err != nil {
+		return status, nil, err
+	}
+
+	key, err := mfaKey()
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.EnrollMFA", err)
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.EnrollMFA", err)
+	}
+	secretEnc, err := utils.EncryptSecret(key, secret)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.EnrollMFA", err)
+	}
+
+	if err := s.mfaRepo.SaveSecret(ctx, user.ID, secretEnc); err != nil {
+		if errs.Is(err, errs.ErrConflict) {
+			return http.StatusConflict, nil, errs.ErrMFAAlreadyEnabled
+		}
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.EnrollMFA", err)
+	}
+
+	issuer := config.Config.MFA.Issuer
+	if issuer == "" {
+		issuer = "go-chat-system"
+	}
+
+	responseData := map[string]any{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPURI(issuer, user.Email, secret),
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// POST -> confirms enrollment with a first code and returns the recovery
+// codes. They are shown only this once.
+func (s *UserServiceImpl) ConfirmMFA(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.UserService.ConfirmMFA", err)
+	}
+
+	if !utils.Required(req.Code) {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ConfirmMFA", err)
+	}
+	if user == nil {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+	if status, err := s.accountLocked(ctx, w, user.Email); err != nil {
+		return status, nil, err
+	}
+
+	mfa, err := s.mfaRepo.GetMFA(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ConfirmMFA", err)
+	}
+	if mfa == nil {
+		return http.StatusBadRequest, nil, errs.ErrMFANotEnabled
+	}
+	if mfa.Enabled() {
+		return http.StatusConflict, nil, errs.ErrMFAAlreadyEnabled
+	}
+
+	secret, err := decryptMFASecret(mfa)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ConfirmMFA", err)
+	}
+	step, valid := utils.ValidateTOTP(secret, req.Code, time.Now())
+	if !valid {
+		if err := s.loginFailed(ctx, r, loginAccountKey(user.Email), user.Email, user); err != nil {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ConfirmMFA", err)
+		}
+		return http.StatusBadRequest, nil, errs.ErrInvalidCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ConfirmMFA", err)
+	}
+
+	if err := s.mfaRepo.Enable(ctx, userID, step, hashes); err != nil {
+		if errs.Is(err, errs.ErrConflict) {
+			return http.StatusConflict, nil, errs.ErrMFAAlreadyEnabled
+		}
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ConfirmMFA", err)
+	}
+
+	responseData := map[string]any{
+		"recovery_codes": codes,
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// POST -> replaces all recovery codes; needs a current TOTP code
+func (s *UserServiceImpl) RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	var req struct {
+		Code string `json:"code"`
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.UserService.RegenerateRecoveryCodes", err)
+	}
+
+	if !utils.Required(req.Code) {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.RegenerateRecoveryCodes", err)
+	}
+	if user == nil {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+	if status, err := s.accountLocked(ctx, w, user.Email); err != nil {
+		return status, nil, err
+	}
+
+	mfa, err := s.mfaRepo.GetMFA(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.RegenerateRecoveryCodes", err)
+	}
+	if !mfa.Enabled() {
+		return http.StatusBadRequest, nil, errs.ErrMFANotEnabled
+	}
+
+	valid, err := s.checkSecondFactor(ctx, mfa, req.Code, "")
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.RegenerateRecoveryCodes", err)
+	}
+	if !valid {
+		if err := s.loginFailed(ctx, r, loginAccountKey(user.Email), user.Email, user); err != nil {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.RegenerateRecoveryCodes", err)
+		}
+		return http.StatusBadRequest, nil, errs.ErrInvalidCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes()
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.RegenerateRecoveryCodes", err)
+	}
+	if err := s.mfaRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.RegenerateRecoveryCodes", err)
+	}
+
+	responseData := map[string]any{
+		"recovery_codes": codes,
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// DELETE -> turns 2FA off; needs the password (or a reauth code) and a TOTP
+// or recovery code
+func (s *UserServiceImpl) DisableMFA(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	var req struct {
+		Password     string `json:"password"`
+		ReauthCode   string `json:"reauth_code"` // accounts without a password
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.UserService.DisableMFA", err)
+	}
+
+	if !utils.Required(req.Code) && !utils.Required(req.RecoveryCode) {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.DisableMFA", err)
+	}
+	if user == nil {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+	if status, err := s.reauthenticate(ctx, w, r, user, req.Password, req.ReauthCode); err != nil {
+		return status, nil, err
+	}
+
+	mfa, err := s.mfaRepo.GetMFA(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.DisableMFA", err)
+	}
+	if !mfa.Enabled() {
+		return http.StatusBadRequest, nil, errs.ErrMFANotEnabled
+	}
+
+	valid, err := s.checkSecondFactor(ctx, mfa, req.Code, req.RecoveryCode)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.DisableMFA", err)
+	}
+	if !valid {
+		if err := s.loginFailed(ctx, r, loginAccountKey(user.Email), user.Email, user); err != nil {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.DisableMFA", err)
+		}
+		return http.StatusBadRequest, nil, errs.ErrInvalidCode
+	}
+
+	if err := s.mfaRepo.Disable(ctx, userID); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.DisableMFA", err)
+	}
+
+	return http.StatusOK, nil, nil
+}
+
+// POST -> completes a login that answered "mfa_required" and issues the
+// normal token pair.
+func (s *UserServiceImpl) VerifyMFA(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	var req struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.UserService.VerifyMFA", err)
+	}
+
+	if !utils.Required(req.MFAToken) || (!utils.Required(req.Code) && !utils.Required(req.RecoveryCode)) {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	tokenHash := utils.HashToken(req.MFAToken)
+
+	// A challenge only allows a handful of guesses
+	allowed, err := s.authStore.Allow(ctx, "rate:mfa:"+tokenHash, mfaChallengeAttempts, mfaChallengeTTL)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.VerifyMFA", err)
+	}
+	if !allowed {
+		if _, err := s.authStore.DeleteMFAChallenge(ctx, tokenHash); err != nil {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.VerifyMFA", err)
+		}
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	userID, err := s.authStore.GetMFAChallenge(ctx, tokenHash)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.VerifyMFA", err)
+	}
+	if userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.VerifyMFA", err)
+	}
+	if user == nil {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	mfa, err := s.mfaRepo.GetMFA(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.VerifyMFA", err)
+	}
+	if !mfa.Enabled() {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	// Wrong codes count against the same lockout as wrong passwords, so new
+	// challenges do not bring new guesses
+	account := loginAccountKey(user.Email)
+	wait, err := s.authStore.LoginBlockedFor(ctx, account)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.VerifyMFA", err)
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return http.StatusTooManyRequests, nil, errs.ErrTooManyAttempts
+	}
+
+	valid, err := s.checkSecondFactor(ctx, mfa, req.Code, req.RecoveryCode)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.VerifyMFA", err)
+	}
+	if !valid {
+		if err := s.loginFailed(ctx, r, account, user.Email, user); err != nil {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.VerifyMFA", err)
+		}
+		return http.StatusUnauthorized, nil, errs.ErrInvalidCode
+	}
+
+	// Only the first successful answer may turn the challenge into a session
+	won, err := s.authStore.DeleteMFAChallenge(ctx, tokenHash)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.VerifyMFA", err)
+	}
+	if !won {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	if err := s.authStore.ClearLoginFailures(ctx, account); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.VerifyMFA", err)
+	}
+	responseData, err := s.loginResponse(ctx, r, user)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.VerifyMFA", err)
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// startMFAChallenge answers the password step of a login for an account with
+// 2FA enabled. The returned token is exchanged at /auth/mfa/verify.
+func (s *UserServiceImpl) startMFAChallenge(ctx context.Context, user *model.User) (map[string]any, error) {
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return nil, errs.Wrap("service.UserService.startMFAChallenge", err)
+	}
+
+	if err := s.authStore.SetMFAChallenge(ctx, utils.HashToken(token), user.ID, mfaChallengeTTL); err != nil {
+		return nil, errs.Wrap("service.UserService.startMFAChallenge", err)
+	}
+
+	return map[string]any{
+		"mfa_required": true,
+		"mfa_token":    token,
+		"mfa_exp":      time.Now().Add(mfaChallengeTTL),
+	}, nil
+}
+
+// checkSecondFactor accepts either a TOTP code (not reused) or an unused
+// recovery code, burning whichever was presented.
+func (s *UserServiceImpl) checkSecondFactor(ctx context.Context, mfa *model.UserMFA, code, recoveryCode string) (bool, error) {
+	if code != "" {
+		secret, err := decryptMFASecret(mfa)
+		if err != nil {
+			return false, errs.Wrap("service.UserService.checkSecondFactor", err)
+		}
+		step, valid := utils.ValidateTOTP(secret, code, time.Now())
+		if !valid {
+			return false, nil
+		}
+		used, err := s.mfaRepo.UseStep(ctx, mfa.UserID, step)
+		return used, errs.Wrap("service.UserService.checkSecondFactor", err)
+	}
+
+	if recoveryCode != "" {
+		used, err := s.mfaRepo.UseRecoveryCode(ctx, mfa.UserID, utils.HashToken(normalizeRecoveryCode(recoveryCode)))
+		return used, errs.Wrap("service.UserService.checkSecondFactor", err)
+	}
+
+	return false, nil
+}
+
+// mfaKey decodes the key that encrypts TOTP secrets at rest.
+func mfaKey() ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(config.Config.MFA.EncryptionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("mfa encryption key must be 32 bytes, got %d", len(key))
+	}
+	return key, nil
+}
+
+func decryptMFASecret(mfa *model.UserMFA) (string, error) {
+	key, err := mfaKey()
+	if err != nil {
+		return "", err
+	}
+	return utils.DecryptSecret(key, mfa.SecretEnc)
+}
+
+// generateRecoveryCodes returns codes formatted for display together with
+// the hashes to store.
+func generateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		secret, err := utils.GenerateTOTPSecret()
+		if err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(secret[:10])
+		codes = append(codes, raw[:5]+"-"+raw[5:])
+		hashes = append(hashes, utils.HashToken(raw))
+	}
+	return codes, hashes, nil
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
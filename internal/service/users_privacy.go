@@ -0,0 +1,145 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/repository"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+)
+
+// GET -> the logged in user's privacy settings
+func (s *UserServiceImpl) GetPrivacy(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.GetPrivacy", err)
+	}
+	if user == nil {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	responseData := map[string]any{
+		"privacy": user.Privacy,
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// PATCH -> updates the settings present in the body
+func (s *UserServiceImpl) UpdatePrivacy(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	var req struct {
+		Discoverability *model.Audience `json:"discoverability"`
+		EmailSearchable *bool           `json:"email_searchable"`
+		FriendRequests  *model.Audience `json:"friend_requests"`
+		Presence        *model.Audience `json:"presence"`
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.UserService.UpdatePrivacy", err)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.UpdatePrivacy", err)
+	}
+	if user == nil {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	privacy := user.Privacy
+	if req.Discoverability != nil {
+		privacy.Discoverability = *req.Discoverability
+	}
+	if req.EmailSearchable != nil {
+		privacy.EmailSearchable = *req.EmailSearchable
+	}
+	if req.FriendRequests != nil {
+		privacy.FriendRequests = *req.FriendRequests
+	}
+	if req.Presence != nil {
+		privacy.Presence = *req.Presence
+	}
+	if !privacy.Valid() {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+
+	if err := s.userRepo.UpdatePrivacy(ctx, user.ID, &privacy); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.UpdatePrivacy", err)
+	}
+
+	responseData := map[string]any{
+		"privacy": privacy,
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// canDiscover reports whether viewerID may look user up by ID or handle.
+// Lookups follow the discoverability setting like search does, except that
+// the user and their friends always find them.
+func canDiscover(ctx context.Context, friendRepo repository.FriendRepository, user *model.User, viewerID string) (bool, error) {
+	if user.ID == viewerID || user.Privacy.Discoverability == model.AudienceEveryone {
+		return true, nil
+	}
+	friends, err := friendRepo.AreFriends(ctx, user.ID, viewerID)
+	if err != nil || friends {
+		return friends, err
+	}
+	if user.Privacy.Discoverability == model.AudienceFriendsOfFriends {
+		return friendRepo.HaveMutualFriend(ctx, viewerID, user.ID)
+	}
+	return false, nil
+}
+
+// profileFor is user's profile as viewerID sees it: the last seen time
+// only shows when user's presence setting allows it.
+func (s *UserServiceImpl) profileFor(ctx context.Context, user *model.User, viewerID string) (model.ProfileDTO, error) {
+	dto := toProfileDTO(user)
+	if !user.LastSeenAt.Valid {
+		return dto, nil
+	}
+	visible, err := s.canSeePresence(ctx, user, viewerID)
+	if err != nil {
+		return dto, err
+	}
+	if visible {
+		dto.LastSeenAt = &user.LastSeenAt.Time
+	}
+	return dto, nil
+}
+
+// canSeePresence reports whether viewerID may see when user was last online.
+func (s *UserServiceImpl) canSeePresence(ctx context.Context, user *model.User, viewerID string) (bool, error) {
+	if user.ID == viewerID {
+		return true, nil
+	}
+	switch user.Privacy.Presence {
+	case model.AudienceEveryone:
+		return true, nil
+	case model.AudienceFriends:
+		return s.friendRepo.AreFriends(ctx, user.ID, viewerID)
+	}
+	return false, nil
+}
@@ -0,0 +1,133 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/go-chi/chi"
+)
+
+func TestUpdatePrivacyKeepsUnsetFieldsAndValidates(t *testing.T) {
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Privacy: model.PrivacySettings{
+		Discoverability: model.AudienceEveryone,
+		FriendRequests:  model.AudienceEveryone,
+		Presence:        model.AudienceFriends,
+	}}}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users})
+
+	update := func(body string) int {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/users/me/privacy", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+		status, _, _ := service.UpdatePrivacy(httptest.NewRecorder(), req)
+		return status
+	}
+
+	// friends_of_friends is not a presence audience
+	if status := update(`{"presence":"friends_of_friends"}`); status != http.StatusBadRequest || users.privacy != nil {
+		t.Fatalf("expected invalid presence to be rejected, got %d", status)
+	}
+
+	if status := update(`{"friend_requests":"nobody","email_searchable":true}`); status != http.StatusOK {
+		t.Fatalf("expected update, got %d", status)
+	}
+	want := model.PrivacySettings{
+		Discoverability: model.AudienceEveryone,
+		EmailSearchable: true,
+		FriendRequests:  model.AudienceNobody,
+		Presence:        model.AudienceFriends,
+	}
+	if users.privacy == nil || *users.privacy != want {
+		t.Fatalf("expected %#v, got %#v", want, users.privacy)
+	}
+}
+
+func TestGetProfileShowsLastSeenOnlyToAllowedViewers(t *testing.T) {
+	lastSeen := time.Now().Add(-time.Hour)
+	id := "11111111-1111-1111-1111-111111111111"
+
+	for _, tt := range []struct {
+		presence model.Audience
+		friends  bool
+		visible  bool
+	}{
+		{presence: model.AudienceEveryone, visible: true},
+		{presence: model.AudienceFriends, friends: true, visible: true},
+		{presence: model.AudienceFriends},
+		{presence: model.AudienceNobody, friends: true},
+	} {
+		users := &fakeUserRepo{user: &model.User{
+			ID:         id,
+			Privacy:    model.PrivacySettings{Discoverability: model.AudienceEveryone, Presence: tt.presence},
+			LastSeenAt: sql.NullTime{Time: lastSeen, Valid: true},
+		}}
+		service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, FriendRepo: fakeFriendRepo{areFriends: tt.friends}})
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/users/"+id, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		ctx = context.WithValue(ctx, middleware.UserIDKey, "viewer-1")
+
+		_, resp, err := service.GetProfile(httptest.NewRecorder(), req.WithContext(ctx))
+		if err != nil {
+			t.Fatalf("GetProfile failed: %v", err)
+		}
+		dto := resp.Data.(map[string]any)["profile"].(*model.ProfileDTO)
+		if visible := dto.LastSeenAt != nil; visible != tt.visible {
+			t.Fatalf("presence %q, friends %v: expected last seen visible=%v", tt.presence, tt.friends, tt.visible)
+		}
+	}
+}
+
+func TestProfileLookupsFollowDiscoverability(t *testing.T) {
+	id := "11111111-1111-1111-1111-111111111111"
+
+	for _, tt := range []struct {
+		audience model.Audience
+		viewer   string
+		friends  bool
+		mutual   bool
+		found    bool
+	}{
+		{audience: model.AudienceEveryone, viewer: "viewer-1", found: true},
+		{audience: model.AudienceFriendsOfFriends, viewer: "viewer-1", mutual: true, found: true},
+		{audience: model.AudienceFriendsOfFriends, viewer: "viewer-1"},
+		{audience: model.AudienceNobody, viewer: "viewer-1", mutual: true},
+		{audience: model.AudienceNobody, viewer: "viewer-1", friends: true, found: true},
+		{audience: model.AudienceNobody, viewer: id, found: true},
+	} {
+		users := &fakeUserRepo{user: &model.User{ID: id, Username: "alice", Privacy: model.PrivacySettings{Discoverability: tt.audience}}}
+		service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, FriendRepo: fakeFriendRepo{areFriends: tt.friends, mutual: tt.mutual}})
+
+		lookups := map[string]func(http.ResponseWriter, *http.Request) (int, *utils.APIResponse, error){
+			"id":     service.GetProfile,
+			"handle": service.GetByHandle,
+		}
+		for param, lookup := range lookups {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/users/", nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", id)
+			rctx.URLParams.Add("handle", "alice")
+			ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+			ctx = context.WithValue(ctx, middleware.UserIDKey, tt.viewer)
+
+			status, _, err := lookup(httptest.NewRecorder(), req.WithContext(ctx))
+			if tt.found && status != http.StatusOK {
+				t.Fatalf("%s lookup, %q, friends %v, mutual %v: expected the profile, got %d %v", param, tt.audience, tt.friends, tt.mutual, status, err)
+			}
+			if !tt.found && (status != http.StatusNotFound || !errors.Is(err, errs.ErrNotFound)) {
+				t.Fatalf("%s lookup, %q, friends %v, mutual %v: expected 404, got %d %v", param, tt.audience, tt.friends, tt.mutual, status, err)
+			}
+		}
+	}
+}
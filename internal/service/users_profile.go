@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/logger"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// Profile field limits, in characters
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 500
+	maxAvatarURLLength   = 2048
+	maxStatusTextLength  = 100
+	maxStatusEmojiLength = 8
+)
+
+const (
+	defaultHandleChangeCooldown = 30 * 24 * time.Hour
+	defaultHandleReservation    = 90 * 24 * time.Hour
+)
+
+// GET -> the logged in user's own account and profile
+func (s *UserServiceImpl) GetMe(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.GetMe", err)
+	}
+	if user == nil {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	responseData := map[string]any{
+		"user": &model.MeDTO{
+			ProfileDTO:    toProfileDTO(user),
+			Email:         user.Email,
+			Role:          user.Role,
+			EmailVerified: user.VerifiedAt.Valid,
+		},
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// PATCH -> updates the fields present in the body; friends are notified live
+func (s *UserServiceImpl) UpdateMe(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	var req struct {
+		DisplayName *string `json:"display_name"`
+		Bio         *string `json:"bio"`
+		AvatarURL   *string `json:"avatar_url"`
+		StatusText  *string `json:"status_text"`
+		StatusEmoji *string `json:"status_emoji"`
+		Timezone    *string `json:"timezone"`
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.UserService.UpdateMe", err)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.UpdateMe", err)
+	}
+	if user == nil {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	profile := user.Profile
+	for _, f := range []struct {
+		src *string
+		dst *string
+	}{
+		{req.DisplayName, &profile.DisplayName},
+		{req.Bio, &profile.Bio},
+		{req.AvatarURL, &profile.AvatarURL},
+		{req.StatusText, &profile.StatusText},
+		{req.StatusEmoji, &profile.StatusEmoji},
+		{req.Timezone, &profile.Timezone},
+	} {
+		if f.src != nil {
+			*f.dst = strings.TrimSpace(*f.src)
+		}
+	}
+
+	if !validProfile(&profile) {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+
+	if err := s.userRepo.UpdateProfile(ctx, user.ID, &profile); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.UpdateMe", err)
+	}
+	user.Profile = profile
+
+	dto := toProfileDTO(user)
+	s.publishProfile(ctx, user.ID, &dto)
+
+	responseData := map[string]any{
+		"profile": &dto,
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// GET -> profile of an active user the caller may discover
+func (s *UserServiceImpl) GetProfile(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	id := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(id); err != nil {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByID(ctx, id)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.GetProfile", err)
+	}
+	if user == nil {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+
+	viewerID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	found, err := canDiscover(ctx, s.friendRepo, user, viewerID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.GetProfile", err)
+	}
+	if !found {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+
+	dto, err := s.profileFor(ctx, user, viewerID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.GetProfile", err)
+	}
+	responseData := map[string]any{
+		"profile": &dto,
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// publishProfile pushes a profile change to the user's friends and to the
+// user's own other connections. Failures only cost the live update.
+func (s *UserServiceImpl) publishProfile(ctx context.Context, userID string, profile *model.ProfileDTO) {
+	if s.publisher == nil {
+		return
+	}
+
+	friendIDs, err := s.friendRepo.ListFriendIDs(ctx, userID)
+	if err != nil {
+		logger.L().Warn("failed to load friends for profile update", zap.String("user_id", userID), zap.Error(err))
+		return
+	}
+
+	s.publisher.Publish("profile_updated", userID, profile, append(friendIDs, userID)...)
+}
+
+func validProfile(p *model.Profile) bool {
+	if !utils.MaxLength(p.DisplayName, maxDisplayNameLength) ||
+		!utils.MaxLength(p.Bio, maxBioLength) ||
+		!utils.MaxLength(p.StatusText, maxStatusTextLength) ||
+		!utils.MaxLength(p.StatusEmoji, maxStatusEmojiLength) {
+		return false
+	}
+	if p.AvatarURL != "" && (!utils.MaxLength(p.AvatarURL, maxAvatarURLLength) || !utils.ValidateHTTPURL(p.AvatarURL)) {
+		return false
+	}
+	if p.Timezone != "" && !utils.ValidateTimezone(p.Timezone) {
+		return false
+	}
+	return true
+}
+
+func toProfileDTO(user *model.User) model.ProfileDTO {
+	return model.ProfileDTO{
+		ID:       user.ID,
+		Username: user.Username,
+		Profile:  user.Profile,
+	}
+}
+
+// GET -> profile by handle, case-insensitive, if the caller may discover it
+func (s *UserServiceImpl) GetByHandle(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	handle := strings.TrimPrefix(chi.URLParam(r, "handle"), "@")
+	if !utils.ValidateHandle(handle) {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByHandle(ctx, handle)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.GetByHandle", err)
+	}
+	if user == nil {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+
+	viewerID, _ := r.Context().Value(middleware.UserIDKey).(string)
+	found, err := canDiscover(ctx, s.friendRepo, user, viewerID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.GetByHandle", err)
+	}
+	if !found {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+
+	dto, err := s.profileFor(ctx, user, viewerID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.GetByHandle", err)
+	}
+	responseData := map[string]any{
+		"profile": &dto,
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// GET -> whether a handle can be registered (or taken by the caller)
+func (s *UserServiceImpl) CheckHandle(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	handle := strings.TrimPrefix(strings.TrimSpace(r.URL.Query().Get("handle")), "@")
+	userID, _ := r.Context().Value(middleware.UserIDKey).(string)
+
+	responseData := map[string]any{
+		"handle":    handle,
+		"available": false,
+	}
+
+	if !utils.ValidateHandle(handle) {
+		responseData["reason"] = "invalid"
+		return http.StatusOK, utils.SuccessResponse(responseData), nil
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	available, err := s.userRepo.IsHandleAvailable(ctx, handle, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.CheckHandle", err)
+	}
+
+	responseData["available"] = available
+	if !available {
+		responseData["reason"] = "taken"
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// PATCH -> changes the caller's handle. Renames are rate limited by a
+// cooldown and the old handle stays reserved for the caller for a while.
+func (s *UserServiceImpl) ChangeHandle(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	var req struct {
+		Handle string `json:"handle"`
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.UserService.ChangeHandle", err)
+	}
+
+	handle := strings.TrimPrefix(strings.TrimSpace(req.Handle), "@")
+	if !utils.ValidateHandle(handle) {
+		return http.StatusBadRequest, nil, errs.ErrInvalidHandle
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ChangeHandle", err)
+	}
+	if user == nil {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+	if user.Username == handle {
+		dto := toProfileDTO(user)
+		return http.StatusOK, utils.SuccessResponse(map[string]any{"profile": &dto}), nil
+	}
+
+	cooldown := config.Config.Account.HandleChangeCooldown
+	if cooldown <= 0 {
+		cooldown = defaultHandleChangeCooldown
+	}
+	if user.UsernameChangedAt.Valid && time.Since(user.UsernameChangedAt.Time) < cooldown {
+		return http.StatusTooManyRequests, nil, errs.ErrHandleCooldown
+	}
+
+	available, err := s.userRepo.IsHandleAvailable(ctx, handle, user.ID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ChangeHandle", err)
+	}
+	if !available {
+		return http.StatusConflict, nil, errs.ErrHandleTaken
+	}
+
+	reservation := config.Config.Account.HandleReservation
+	if reservation <= 0 {
+		reservation = defaultHandleReservation
+	}
+	if err := s.userRepo.ChangeHandle(ctx, user.ID, handle, time.Now().Add(reservation)); err != nil {
+		if errs.Is(err, errs.ErrHandleTaken) {
+			return http.StatusConflict, nil, errs.ErrHandleTaken
+		}
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ChangeHandle", err)
+	}
+	user.Username = handle
+
+	dto := toProfileDTO(user)
+	s.publishProfile(ctx, user.ID, &dto)
+
+	responseData := map[string]any{
+		"profile": &dto,
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/mailer"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/google/uuid"
+)
+
+const (
+	reauthCodeTTL         = 10 * time.Minute
+	reauthCodeLimit       = 3 // emails per user per window
+	reauthCodeLimitWindow = time.Hour
+)
+
+// POST -> emails a code that confirms sensitive actions for accounts that
+// only sign in through single sign-on and so have no password to give.
+func (s *UserServiceImpl) SendReauthCode(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.SendReauthCode", err)
+	}
+	if user == nil {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+	if user.PasswordHash != "" {
+		return http.StatusBadRequest, nil, errs.ErrPasswordSet
+	}
+
+	allowed, err := s.authStore.Allow(ctx, "rate:reauth:"+user.ID, reauthCodeLimit, reauthCodeLimitWindow)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.SendReauthCode", err)
+	}
+	if !allowed {
+		return http.StatusTooManyRequests, nil, errs.ErrTooManyAttempts
+	}
+
+	code, err := utils.GenerateOTP(verificationCodeDigits)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.SendReauthCode", err)
+	}
+
+	now := time.Now().UTC()
+	record := &model.VerificationCode{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		Purpose:   model.PurposeReauthentication,
+		CodeHash:  utils.HashToken(code),
+		ExpiresAt: now.Add(reauthCodeTTL),
+		CreatedAt: now,
+	}
+	if err := s.verificationRepo.CreateCode(ctx, record); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.SendReauthCode", err)
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your account change",
+		Body: fmt.Sprintf("Hi %s,\n\nYour confirmation code is %s. It expires in %d minutes. If you did not ask for it, sign out your other sessions.\n",
+			user.Username, code, int(reauthCodeTTL.Minutes())),
+	}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.SendReauthCode", err)
+	}
+
+	return http.StatusOK, nil, nil
+}
+
+// reauthenticate checks the proof sensitive actions ask of a logged in
+// user: the password, or for single sign-on accounts without one a code
+// from SendReauthCode. Wrong proofs count towards the account lockout like
+// failed logins. A nil error means the proof holds.
+func (s *UserServiceImpl) reauthenticate(ctx context.Context, w http.ResponseWriter, r *http.Request, user *model.User, password, code string) (int, error) {
+	if status, err := s.accountLocked(ctx, w, user.Email); err != nil {
+		return status, err
+	}
+
+	var valid bool
+	if user.PasswordHash != "" {
+		if !utils.Required(password) {
+			return http.StatusBadRequest, errs.ErrValidation
+		}
+		valid = utils.ComparePassword(user.PasswordHash, password)
+	} else {
+		if !utils.Required(code) {
+			return http.StatusBadRequest, errs.ErrValidation
+		}
+		ok, err := s.verificationRepo.ConsumeCode(ctx, user.ID, model.PurposeReauthentication,
+			utils.HashToken(strings.TrimSpace(code)), maxCodeAttempts)
+		if err != nil {
+			return http.StatusInternalServerError, errs.Wrap("service.UserService.reauthenticate", err)
+		}
+		valid = ok
+	}
+	if valid {
+		return http.StatusOK, nil
+	}
+
+	if err := s.loginFailed(ctx, r, loginAccountKey(user.Email), user.Email, user); err != nil {
+		return http.StatusInternalServerError, errs.Wrap("service.UserService.reauthenticate", err)
+	}
+	if user.PasswordHash != "" {
+		return http.StatusBadRequest, errs.ErrInvalidPassword
+	}
+	return http.StatusBadRequest, errs.ErrInvalidCode
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+)
+
+func TestSSOAccountsConfirmSensitiveActionsWithEmailedCode(t *testing.T) {
+	useTestMFAConfig(t)
+
+	// Provisioned by single sign-on, so no password
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Username: "alice", Email: "a@example.com"}}
+	codes := &fakeVerificationRepo{}
+	mail := &fakeMailer{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: &fakeSessionRepo{}, VerificationRepo: codes, MFARepo: &fakeMFARepo{}, AuthStore: &fakeAuthStore{}, Mailer: mail})
+
+	call := func(fn func(http.ResponseWriter, *http.Request) (int, *utils.APIResponse, error), method, body string) (int, error) {
+		req := httptest.NewRequest(method, "/api/v1/users/me", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+		status, _, err := fn(httptest.NewRecorder(), req)
+		return status, err
+	}
+
+	// An empty password must not match the empty hash
+	if status, err := call(service.DeleteAccount, http.MethodDelete, `{"password":""}`); status != http.StatusBadRequest || !errors.Is(err, errs.ErrValidation) {
+		t.Fatalf("expected a code to be required, got %d %v", status, err)
+	}
+
+	if status, err := call(service.SendReauthCode, http.MethodPost, ""); status != http.StatusOK {
+		t.Fatalf("expected a code to be sent, got %d %v", status, err)
+	}
+	if len(codes.created) != 1 || codes.created[0].Purpose != model.PurposeReauthentication || len(mail.sent) != 1 {
+		t.Fatalf("expected one emailed reauthentication code, got %v and %d emails", codes.created, len(mail.sent))
+	}
+
+	if status, err := call(service.EnrollMFA, http.MethodPost, `{"reauth_code":"123456"}`); status != http.StatusBadRequest || !errors.Is(err, errs.ErrInvalidCode) {
+		t.Fatalf("expected a wrong code to be rejected, got %d %v", status, err)
+	}
+	if users.deletedID != "" {
+		t.Fatalf("expected nothing to happen on a wrong code")
+	}
+
+	codes.valid = true
+	if status, err := call(service.EnrollMFA, http.MethodPost, `{"reauth_code":" 123456 "}`); status != http.StatusOK {
+		t.Fatalf("expected enrollment with the code, got %d %v", status, err)
+	}
+	if codes.consumedHash != utils.HashToken("123456") {
+		t.Fatalf("expected the code to be checked by hash")
+	}
+	if status, err := call(service.DeleteAccount, http.MethodDelete, `{"reauth_code":"123456"}`); status != http.StatusOK || users.deletedID != "user-1" {
+		t.Fatalf("expected deletion with the code, got %d %v", status, err)
+	}
+}
+
+func TestSendReauthCodeRefusesAccountsWithPassword(t *testing.T) {
+	hash, _ := utils.HashPassword("password-1")
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Email: "a@example.com", PasswordHash: hash}}
+	codes := &fakeVerificationRepo{valid: true}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: &fakeSessionRepo{}, VerificationRepo: codes, AuthStore: &fakeAuthStore{}, Mailer: &fakeMailer{}})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/me/reauth-code", nil)
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+	if status, _, err := service.SendReauthCode(httptest.NewRecorder(), req); status != http.StatusBadRequest || !errors.Is(err, errs.ErrPasswordSet) {
+		t.Fatalf("expected accounts with a password to use it, got %d %v", status, err)
+	}
+
+	// Nor does a code stand in for their password
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/users/me", bytes.NewBufferString(`{"reauth_code":"123456"}`))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+	if status, _, err := service.DeleteAccount(httptest.NewRecorder(), req); status != http.StatusBadRequest || !errors.Is(err, errs.ErrValidation) {
+		t.Fatalf("expected the password to be required, got %d %v", status, err)
+	}
+	if users.deletedID != "" {
+		t.Fatalf("expected account to stay")
+	}
+}
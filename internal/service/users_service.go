@@ -3,16 +3,26 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"fmt"
+	"math"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+	"github.com/ak-repo/go-chat-system/internal/platform/mailer"
 	"github.com/ak-repo/go-chat-system/internal/repository"
 	"github.com/ak-repo/go-chat-system/internal/shared/errs"
 	"github.com/ak-repo/go-chat-system/internal/shared/jwt"
+	"github.com/ak-repo/go-chat-system/internal/shared/logger"
 	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
 	"github.com/google/uuid"
+	"go.uber.org/zap"
 )
 
 type UserService interface {
@@ -20,20 +30,114 @@ type UserService interface {
 	Register(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
 	Login(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
 	RefreshToken(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	Logout(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	LogoutAll(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	CreateWSTicket(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	ListSessions(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	RevokeSession(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	VerifyEmail(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	ResendVerification(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	ForgotPassword(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	ResetPassword(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	ChangePassword(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	EnrollMFA(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	ConfirmMFA(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	RegenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	DisableMFA(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	VerifyMFA(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	DeleteAccount(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	SendReauthCode(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	GetMe(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	UpdateMe(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	GetProfile(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	GetByHandle(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	CheckHandle(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	ChangeHandle(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	GetPrivacy(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	UpdatePrivacy(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
 
-	//TODO: admin actions
+	// Admin actions
+	AdminGetUser(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+	AdminSetRole(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error)
+}
+
+// SessionDisconnector closes live (WebSocket) connections of revoked sessions.
+type SessionDisconnector interface {
+	DisconnectSessions(sessionIDs ...string)
+}
 
+// EventPublisher pushes server events to the live connections of users.
+type EventPublisher interface {
+	Publish(event, senderID string, payload any, userIDs ...string)
 }
 
+const (
+	verificationCodeDigits = 6
+	verificationCodeTTL    = 15 * time.Minute
+	maxCodeAttempts        = 5
+	// Resends hand out fresh codes, so both limits hold across codes. Guesses
+	// are counted per address and caller, so strangers cannot use up the
+	// owner's; resends and maxCodeAttempts bound the total per address.
+	verificationResendLimit   = 3 // emails per address per window
+	verificationResendWindow  = time.Hour
+	verificationAttemptLimit  = 10 // guesses per address and IP per window
+	verificationAttemptWindow = 24 * time.Hour
+
+	passwordResetTTL         = 30 * time.Minute
+	passwordResetLimit       = 3 // emails per address per window
+	passwordResetLimitWindow = time.Hour
+
+	wsTicketTTL = 30 * time.Second
+)
+
 type UserServiceImpl struct {
-	userRepo repository.UserRepository
+	userRepo         repository.UserRepository
+	sessionRepo      repository.SessionRepository
+	verificationRepo repository.VerificationRepository
+	mfaRepo          repository.MFARepository
+	friendRepo       repository.FriendRepository
+	securityRepo     repository.SecurityEventRepository
+	authStore        repository.AuthStore
+	mailer           mailer.Mailer
+	disconnector     SessionDisconnector
+	publisher        EventPublisher
+}
+
+// UserServiceDeps are the collaborators of UserServiceImpl. Mailer,
+// Disconnector and Publisher may be left nil where they are not needed.
+type UserServiceDeps struct {
+	UserRepo         repository.UserRepository
+	SessionRepo      repository.SessionRepository
+	VerificationRepo repository.VerificationRepository
+	MFARepo          repository.MFARepository
+	FriendRepo       repository.FriendRepository
+	SecurityRepo     repository.SecurityEventRepository
+	AuthStore        repository.AuthStore
+	Mailer           mailer.Mailer
+	Disconnector     SessionDisconnector
+	Publisher        EventPublisher
 }
 
-func NewUserServiceImpl(userRepo repository.UserRepository) *UserServiceImpl {
-	return &UserServiceImpl{userRepo: userRepo}
+func NewUserServiceImpl(deps UserServiceDeps) *UserServiceImpl {
+	return &UserServiceImpl{
+		userRepo:         deps.UserRepo,
+		sessionRepo:      deps.SessionRepo,
+		verificationRepo: deps.VerificationRepo,
+		mfaRepo:          deps.MFARepo,
+		friendRepo:       deps.FriendRepo,
+		securityRepo:     deps.SecurityRepo,
+		authStore:        deps.AuthStore,
+		mailer:           deps.Mailer,
+		disconnector:     deps.Disconnector,
+		publisher:        deps.Publisher,
+	}
 }
 
 func (s *UserServiceImpl) SearchUser(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
 	filter := r.URL.Query().Get("filter")
 
 	limit := 20
@@ -43,7 +147,8 @@ func (s *UserServiceImpl) SearchUser(w http.ResponseWriter, r *http.Request) (in
 		}
 	}
 
-	respObj, err := s.userRepo.SearchUser(r.Context(), filter, limit)
+	// Privacy settings of the matched users decide whether userID sees them
+	respObj, err := s.userRepo.SearchUser(r.Context(), userID, filter, limit)
 	if err != nil {
 		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.SearchUser", err)
 	}
@@ -56,9 +161,10 @@ func (s *UserServiceImpl) SearchUser(w http.ResponseWriter, r *http.Request) (in
 
 func (s *UserServiceImpl) Register(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
 	var req struct {
-		Username string `json:"username"`
-		Email    string `json:"email"`
-		Password string `json:"password"`
+		Username   string `json:"username"`
+		Email      string `json:"email"`
+		Password   string `json:"password"`
+		InviteCode string `json:"invite_code"`
 	}
 
 	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
@@ -68,6 +174,16 @@ func (s *UserServiceImpl) Register(w http.ResponseWriter, r *http.Request) (int,
 		return http.StatusBadRequest, nil, errs.Wrap("service.UserService.Register", err)
 	}
 
+	req.InviteCode = strings.TrimSpace(req.InviteCode)
+	switch registrationMode() {
+	case model.RegistrationClosed:
+		return http.StatusForbidden, nil, errs.ErrRegistrationClosed
+	case model.RegistrationInviteOnly:
+		if req.InviteCode == "" {
+			return http.StatusForbidden, nil, errs.ErrInviteRequired
+		}
+	}
+
 	if !utils.Required(req.Username) ||
 		!utils.Required(req.Email) ||
 		!utils.Required(req.Password) {
@@ -80,6 +196,10 @@ func (s *UserServiceImpl) Register(w http.ResponseWriter, r *http.Request) (int,
 		return http.StatusBadRequest, nil, errs.ErrInvalidEmail
 	}
 
+	if !utils.ValidateHandle(req.Username) {
+		return http.StatusBadRequest, nil, errs.ErrInvalidHandle
+	}
+
 	// Validate password minimum length
 	if !utils.ValidatePassword(req.Password) {
 		return http.StatusBadRequest, nil, errs.ErrWeakPassword
@@ -99,30 +219,57 @@ func (s *UserServiceImpl) Register(w http.ResponseWriter, r *http.Request) (int,
 		Username:     req.Username,
 		Email:        req.Email,
 		PasswordHash: hash,
-		Role:         "user",
+		Role:         string(model.RoleUser),
 		CreatedAt:    time.Now().UTC(),
 		ModifiedAt:   time.Now().UTC(),
 	}
 
-	if err := s.userRepo.CreateUser(ctx, user); err != nil {
+	available, err := s.userRepo.IsHandleAvailable(ctx, user.Username, "")
+	if err != nil {
 		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.Register", err)
 	}
+	if !available {
+		return http.StatusConflict, nil, errs.ErrHandleTaken
+	}
 
-	token, ttl, err := jwt.GenerateToken(user.ID, user.Email, user.Role)
+	// An invite is redeemed together with the account creation, so a failed
+	// sign-up does not use it up. In open mode a code is optional and only
+	// records who invited whom.
+	if req.InviteCode != "" {
+		err = s.userRepo.CreateInvitedUser(ctx, user, utils.HashToken(req.InviteCode))
+	} else {
+		err = s.userRepo.CreateUser(ctx, user)
+	}
 	if err != nil {
+		if errs.Is(err, errs.ErrInvalidInvite) {
+			return http.StatusForbidden, nil, errs.ErrInvalidInvite
+		}
+		if errs.Is(err, errs.ErrHandleTaken) || errs.Is(err, errs.ErrConflict) {
+			return http.StatusConflict, nil, errs.Wrap("service.UserService.Register", err)
+		}
 		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.Register", err)
 	}
+	if user.InvitedBy != "" {
+		logger.L().Info("invite code redeemed", zap.String("user_id", user.ID), zap.String("invited_by", user.InvitedBy))
+	}
 
-	responseData := map[string]any{
-		"user": &model.UserDTO{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-			Role:     user.Role,
-		},
-		"token": token,
-		"exp":   ttl,
+	// The account works right away but stays limited until the email is
+	// confirmed; a failed send is recoverable through the resend endpoint.
+	if err := s.sendVerificationCode(ctx, user); err != nil {
+		logger.L().Error("failed to send verification email", zap.String("user_id", user.ID), zap.Error(err))
+	}
+
+	responseData, err := s.startSession(ctx, r, user)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.Register", err)
 	}
+	responseData["user"] = &model.UserDTO{
+		ID:       user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Role:     user.Role,
+	}
+	responseData["email_verified"] = false
 	return http.StatusCreated, utils.SuccessResponse(responseData), nil
 
 }
@@ -149,47 +296,98 @@ func (s *UserServiceImpl) Login(w http.ResponseWriter, r *http.Request) (int, *u
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	user, err := s.userRepo.GetByEmail(ctx, req.Email)
+	// Throttling is keyed by the address, not the user, so unknown emails
+	// are delayed and locked exactly like existing ones
+	account := loginAccountKey(req.Email)
+	wait, err := s.authStore.LoginBlockedFor(ctx, account)
 	if err != nil {
 		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.Login", err)
 	}
-	if user == nil {
-		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		return http.StatusTooManyRequests, nil, errs.ErrTooManyAttempts
+	}
 
+	user, err := s.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.Login", err)
 	}
 
-	if !utils.ComparePassword(user.PasswordHash, req.Password) {
+	// Unknown emails still pay for the password hash comparisons
+	var passwordHash string
+	if user != nil {
+		passwordHash = user.PasswordHash
+	}
+	if !checkPassword(passwordHash, req.Password) || user == nil {
+		if err := s.loginFailed(ctx, r, account, req.Email, user); err != nil {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.Login", err)
+		}
 		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
 	}
+	s.upgradePasswordHash(ctx, user, req.Password)
 	user.PasswordHash = ""
 
-	token, ttl, err := jwt.GenerateToken(user.ID, user.Email, user.Role)
+	// Accounts with 2FA get a challenge instead of tokens. Failures are only
+	// cleared once the second factor is right as well.
+	mfa, err := s.mfaRepo.GetMFA(ctx, user.ID)
 	if err != nil {
 		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.Login", err)
 	}
+	if mfa.Enabled() {
+		responseData, err := s.startMFAChallenge(ctx, user)
+		if err != nil {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.Login", err)
+		}
+		return http.StatusOK, utils.SuccessResponse(responseData), nil
+	}
 
-	refreshToken, refreshTTL, err := jwt.GenerateRefreshToken(user.ID)
-	if err != nil {
+	if err := s.authStore.ClearLoginFailures(ctx, account); err != nil {
 		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.Login", err)
 	}
-
-	responseData := map[string]any{
-		"user": &model.UserDTO{
-			ID:       user.ID,
-			Username: user.Username,
-			Email:    user.Email,
-			Role:     user.Role,
-		},
-		"token":         token,
-		"exp":           ttl,
-		"refresh_token": refreshToken,
-		"refresh_exp":   refreshTTL,
+	responseData, err := s.loginResponse(ctx, r, user)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.Login", err)
 	}
 
 	return http.StatusOK, utils.SuccessResponse(responseData), nil
 
 }
 
+// upgradePasswordHash rehashes a just verified password whose hash was made
+// with an outdated algorithm or parameters. Failing to do so does not fail
+// the login; it is tried again on the next one.
+func (s *UserServiceImpl) upgradePasswordHash(ctx context.Context, user *model.User, password string) {
+	if !utils.PasswordNeedsRehash(user.PasswordHash) {
+		return
+	}
+	hash, err := utils.HashPassword(password)
+	if err == nil {
+		err = s.userRepo.RehashPassword(ctx, user.ID, user.PasswordHash, hash)
+	}
+	if err != nil {
+		logger.L().Warn("failed to rehash password", zap.String("user_id", user.ID), zap.Error(err))
+		return
+	}
+	logger.L().Info("password rehashed", zap.String("user_id", user.ID))
+}
+
+// loginResponse starts a session for an authenticated user and adds the
+// user summary expected by the login clients.
+func (s *UserServiceImpl) loginResponse(ctx context.Context, r *http.Request, user *model.User) (map[string]any, error) {
+	responseData, err := s.startSession(ctx, r, user)
+	if err != nil {
+		return nil, errs.Wrap("service.UserService.loginResponse", err)
+	}
+	responseData["user"] = &model.UserDTO{
+		ID:       user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Role:     user.Role,
+	}
+	responseData["email_verified"] = user.VerifiedAt.Valid
+	return responseData, nil
+}
+
 func (s *UserServiceImpl) RefreshToken(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -209,14 +407,46 @@ func (s *UserServiceImpl) RefreshToken(w http.ResponseWriter, r *http.Request) (
 	}
 
 	claims, err := jwt.ValidateRefreshToken(req.RefreshToken)
-	if err != nil {
+	if err != nil || claims.SessionID == "" {
 		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
 	}
 
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	user, err := s.userRepo.GetByID(ctx, claims.UserID)
+	refreshToken, refreshTTL, err := jwt.GenerateRefreshToken(claims.UserID, claims.SessionID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.RefreshToken", err)
+	}
+
+	now := time.Now().UTC()
+	next := &model.RefreshToken{
+		ID:        uuid.NewString(),
+		SessionID: claims.SessionID,
+		TokenHash: utils.HashToken(refreshToken),
+		CreatedAt: now,
+		ExpiresAt: refreshTTL,
+	}
+
+	session, err := s.sessionRepo.RotateRefreshToken(ctx, utils.HashToken(req.RefreshToken), next)
+	if err != nil {
+		if errs.Is(err, errs.ErrRefreshTokenReused) {
+			logger.L().Warn("refresh token reuse detected, session revoked",
+				zap.String("user_id", claims.UserID),
+				zap.String("session_id", claims.SessionID),
+			)
+			return http.StatusUnauthorized, nil, errs.Wrap("service.UserService.RefreshToken", err)
+		}
+		if errs.Is(err, errs.ErrUnauthorized) {
+			return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+		}
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.RefreshToken", err)
+	}
+	if session.UserID != claims.UserID {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	user, err := s.userRepo.GetByID(ctx, session.UserID)
 	if err != nil || user == nil {
 		if err != nil {
 			return http.StatusUnauthorized, nil, errs.Wrap("service.UserService.RefreshToken", err)
@@ -224,22 +454,579 @@ func (s *UserServiceImpl) RefreshToken(w http.ResponseWriter, r *http.Request) (
 		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
 	}
 
-	token, ttl, err := jwt.GenerateToken(user.ID, user.Email, user.Role)
+	token, ttl, err := jwt.GenerateToken(user.ID, user.Email, user.Role, session.ID)
 	if err != nil {
 		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.RefreshToken", err)
 	}
 
-	refreshToken, refreshTTL, err := jwt.GenerateRefreshToken(user.ID)
+	responseData := map[string]any{
+		"token":         token,
+		"exp":           ttl,
+		"refresh_token": refreshToken,
+		"refresh_exp":   refreshTTL,
+	}
+
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// startSession opens a new refresh token family for user, recording the
+// client it was opened from, and returns the token pair in the shape used by
+// the auth responses. Logins from a device the user has not used before are
+// announced to them.
+func (s *UserServiceImpl) startSession(ctx context.Context, r *http.Request, user *model.User) (map[string]any, error) {
+	now := time.Now().UTC()
+	sessionID := uuid.NewString()
+
+	userAgent := clientUserAgent(r)
+	knownDevice, err := s.sessionRepo.IsKnownDevice(ctx, user.ID, userAgent)
 	if err != nil {
-		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.RefreshToken", err)
+		return nil, errs.Wrap("service.UserService.startSession", err)
 	}
 
-	responseData := map[string]any{
+	refreshToken, refreshTTL, err := jwt.GenerateRefreshToken(user.ID, sessionID)
+	if err != nil {
+		return nil, errs.Wrap("service.UserService.startSession", err)
+	}
+
+	session := &model.Session{
+		ID:         sessionID,
+		UserID:     user.ID,
+		CreatedAt:  now,
+		LastSeenAt: now,
+		ExpiresAt:  refreshTTL,
+		DeviceName: deviceName(r, userAgent),
+		UserAgent:  userAgent,
+		IP:         middleware.ClientIP(r),
+	}
+	rt := &model.RefreshToken{
+		ID:        uuid.NewString(),
+		SessionID: sessionID,
+		TokenHash: utils.HashToken(refreshToken),
+		CreatedAt: now,
+		ExpiresAt: refreshTTL,
+	}
+	if err := s.sessionRepo.CreateSession(ctx, session, rt); err != nil {
+		return nil, errs.Wrap("service.UserService.startSession", err)
+	}
+
+	token, ttl, err := jwt.GenerateToken(user.ID, user.Email, user.Role, sessionID)
+	if err != nil {
+		return nil, errs.Wrap("service.UserService.startSession", err)
+	}
+
+	if !knownDevice {
+		s.notifyNewDevice(ctx, user, session)
+	}
+
+	return map[string]any{
 		"token":         token,
 		"exp":           ttl,
 		"refresh_token": refreshToken,
 		"refresh_exp":   refreshTTL,
+	}, nil
+}
+
+// POST -> ends the current session
+func (s *UserServiceImpl) Logout(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+	sessionID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+	tokenID, _ := r.Context().Value(middleware.TokenIDKey).(string)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Already revoked elsewhere (e.g. from another device): still log out
+	if err := s.sessionRepo.RevokeSession(ctx, sessionID, userID); err != nil && !errs.Is(err, errs.ErrNotFound) {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.Logout", err)
+	}
+	if tokenID != "" {
+		if err := s.authStore.RevokeToken(ctx, tokenID, config.Config.JWT.Expiry); err != nil {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.Logout", err)
+		}
+	}
+	if err := s.revokeSessions(ctx, []string{sessionID}); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.Logout", err)
+	}
+
+	return http.StatusOK, nil, nil
+}
+
+// POST -> ends every session of the user, including the current one
+func (s *UserServiceImpl) LogoutAll(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sessionIDs, err := s.sessionRepo.RevokeUserSessions(ctx, userID, "")
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.LogoutAll", err)
+	}
+
+	// The current session may already be revoked in the DB; denylist it anyway
+	if sessionID, _ := r.Context().Value(middleware.SessionIDKey).(string); sessionID != "" && !slices.Contains(sessionIDs, sessionID) {
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	if err := s.revokeSessions(ctx, sessionIDs); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.LogoutAll", err)
+	}
+
+	responseData := map[string]any{
+		"revoked_sessions": len(sessionIDs),
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// POST -> short-lived, single-use ticket for opening the WebSocket, so the
+// access token never ends up in a URL
+func (s *UserServiceImpl) CreateWSTicket(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+	sessionID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+	// Bots have no session, their sockets go when the key is revoked
+	if keyID, _ := r.Context().Value(middleware.APIKeyIDKey).(string); keyID != "" {
+		sessionID = apiKeySessionID(keyID)
+	}
+
+	ticket, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.CreateWSTicket", err)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := s.authStore.SetWSTicket(ctx, utils.HashToken(ticket), userID, sessionID, wsTicketTTL); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.CreateWSTicket", err)
+	}
+
+	responseData := map[string]any{
+		"ticket":     ticket,
+		"expires_at": time.Now().Add(wsTicketTTL).UTC(),
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// revokeSessions denylists the access tokens of already revoked sessions
+// for their remaining lifetime and drops their WebSocket connections.
+func (s *UserServiceImpl) revokeSessions(ctx context.Context, sessionIDs []string) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+	if err := s.authStore.RevokeSessions(ctx, sessionIDs, config.Config.JWT.Expiry); err != nil {
+		return errs.Wrap("service.UserService.revokeSessions", err)
+	}
+	if s.disconnector != nil {
+		s.disconnector.DisconnectSessions(sessionIDs...)
+	}
+	return nil
+}
+
+// POST -> confirms the email address with the emailed code
+func (s *UserServiceImpl) VerifyEmail(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	var req struct {
+		Email string `json:"email"`
+		Code  string `json:"code"`
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.UserService.VerifyEmail", err)
+	}
+
+	if !utils.Required(req.Email) || !utils.Required(req.Code) {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	attemptKey := "rate:verify-attempts:" + utils.HashToken(utils.NormalizeEmail(req.Email)+"|"+middleware.ClientIP(r))
+	allowed, err := s.authStore.Allow(ctx, attemptKey, verificationAttemptLimit, verificationAttemptWindow)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.VerifyEmail", err)
+	}
+	if !allowed {
+		return http.StatusTooManyRequests, nil, errs.ErrTooManyAttempts
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.VerifyEmail", err)
+	}
+	if user == nil {
+		return http.StatusBadRequest, nil, errs.ErrInvalidCode
+	}
+	if user.VerifiedAt.Valid {
+		return http.StatusOK, nil, nil
+	}
+
+	ok, err := s.verificationRepo.ConsumeCode(ctx, user.ID, model.PurposeEmailVerification,
+		utils.HashToken(strings.TrimSpace(req.Code)), maxCodeAttempts)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.VerifyEmail", err)
+	}
+	if !ok {
+		return http.StatusBadRequest, nil, errs.ErrInvalidCode
+	}
+
+	if err := s.userRepo.MarkVerified(ctx, user.ID); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.VerifyEmail", err)
+	}
+
+	return http.StatusOK, nil, nil
+}
+
+// POST -> sends a fresh verification code. Always answers 200 so the
+// endpoint cannot be used to discover registered emails.
+func (s *UserServiceImpl) ResendVerification(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.UserService.ResendVerification", err)
+	}
+
+	if !utils.ValidateEmail(req.Email) {
+		return http.StatusBadRequest, nil, errs.ErrInvalidEmail
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Per-address limit, independent of the caller's IP
+	allowed, err := s.authStore.Allow(ctx, "rate:verify:"+utils.NormalizeEmail(req.Email),
+		verificationResendLimit, verificationResendWindow)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ResendVerification", err)
+	}
+	if !allowed {
+		return http.StatusOK, nil, nil
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ResendVerification", err)
+	}
+	if user == nil || user.VerifiedAt.Valid {
+		return http.StatusOK, nil, nil
+	}
+
+	if err := s.sendVerificationCode(ctx, user); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ResendVerification", err)
+	}
+
+	return http.StatusOK, nil, nil
+}
+
+func (s *UserServiceImpl) sendVerificationCode(ctx context.Context, user *model.User) error {
+	code, err := utils.GenerateOTP(verificationCodeDigits)
+	if err != nil {
+		return errs.Wrap("service.UserService.sendVerificationCode", err)
+	}
+
+	now := time.Now().UTC()
+	record := &model.VerificationCode{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		Purpose:   model.PurposeEmailVerification,
+		CodeHash:  utils.HashToken(code),
+		ExpiresAt: now.Add(verificationCodeTTL),
+		CreatedAt: now,
+	}
+	if err := s.verificationRepo.CreateCode(ctx, record); err != nil {
+		return errs.Wrap("service.UserService.sendVerificationCode", err)
+	}
+
+	msg := mailer.Message{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nYour verification code is %s. It expires in %d minutes.\n",
+			user.Username, code, int(verificationCodeTTL.Minutes())),
+	}
+	return errs.Wrap("service.UserService.sendVerificationCode", s.mailer.Send(ctx, msg))
+}
+
+// POST -> emails a single-use reset token. Always answers 200 so the
+// endpoint cannot be used to discover registered emails.
+func (s *UserServiceImpl) ForgotPassword(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	var req struct {
+		Email string `json:"email"`
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.UserService.ForgotPassword", err)
 	}
 
+	if !utils.ValidateEmail(req.Email) {
+		return http.StatusBadRequest, nil, errs.ErrInvalidEmail
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	// Per-address limit, independent of the caller's IP
+	allowed, err := s.authStore.Allow(ctx, "rate:pwreset:"+utils.NormalizeEmail(req.Email), passwordResetLimit, passwordResetLimitWindow)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ForgotPassword", err)
+	}
+	if !allowed {
+		return http.StatusOK, nil, nil
+	}
+
+	user, err := s.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ForgotPassword", err)
+	}
+	if user == nil {
+		return http.StatusOK, nil, nil
+	}
+
+	token, err := utils.GenerateRandomToken(32)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ForgotPassword", err)
+	}
+
+	now := time.Now().UTC()
+	record := &model.VerificationCode{
+		ID:        uuid.NewString(),
+		UserID:    user.ID,
+		Purpose:   model.PurposePasswordReset,
+		CodeHash:  utils.HashToken(token),
+		ExpiresAt: now.Add(passwordResetTTL),
+		CreatedAt: now,
+	}
+	if err := s.verificationRepo.CreateCode(ctx, record); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ForgotPassword", err)
+	}
+
+	body := fmt.Sprintf("Hi %s,\n\nUse this token to reset your password: %s\n", user.Username, token)
+	if appURL := config.Config.Mail.AppURL; appURL != "" {
+		link := fmt.Sprintf("%s/reset-password?email=%s&token=%s",
+			strings.TrimRight(appURL, "/"), url.QueryEscape(user.Email), url.QueryEscape(token))
+		body = fmt.Sprintf("Hi %s,\n\nOpen this link to reset your password: %s\n", user.Username, link)
+	}
+	body += fmt.Sprintf("It expires in %d minutes. If you did not ask for a reset, ignore this email.\n",
+		int(passwordResetTTL.Minutes()))
+
+	msg := mailer.Message{To: user.Email, Subject: "Reset your password", Body: body}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ForgotPassword", err)
+	}
+
+	return http.StatusOK, nil, nil
+}
+
+// POST -> sets a new password with an emailed reset token and signs the
+// user out everywhere.
+func (s *UserServiceImpl) ResetPassword(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	var req struct {
+		Email       string `json:"email"`
+		Token       string `json:"token"`
+		NewPassword string `json:"new_password"`
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.UserService.ResetPassword", err)
+	}
+
+	if !utils.Required(req.Email) || !utils.Required(req.Token) {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+	if !utils.ValidatePassword(req.NewPassword) {
+		return http.StatusBadRequest, nil, errs.ErrWeakPassword
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByEmail(ctx, req.Email)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ResetPassword", err)
+	}
+	if user == nil {
+		return http.StatusBadRequest, nil, errs.ErrInvalidCode
+	}
+
+	ok, err := s.verificationRepo.ConsumeCode(ctx, user.ID, model.PurposePasswordReset,
+		utils.HashToken(strings.TrimSpace(req.Token)), maxCodeAttempts)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ResetPassword", err)
+	}
+	if !ok {
+		return http.StatusBadRequest, nil, errs.ErrInvalidCode
+	}
+
+	hash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ResetPassword", err)
+	}
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, hash); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ResetPassword", err)
+	}
+
+	// The reset link proves control of the mailbox
+	if !user.VerifiedAt.Valid {
+		if err := s.userRepo.MarkVerified(ctx, user.ID); err != nil {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ResetPassword", err)
+		}
+	}
+
+	sessionIDs, err := s.sessionRepo.RevokeUserSessions(ctx, user.ID, "")
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ResetPassword", err)
+	}
+	// The owner just proved control of the mailbox, so lift any lockout
+	if err := s.authStore.ClearLoginFailures(ctx, loginAccountKey(user.Email)); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ResetPassword", err)
+	}
+	if err := s.revokeSessions(ctx, sessionIDs); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ResetPassword", err)
+	}
+
+	return http.StatusOK, nil, nil
+}
+
+// POST -> changes the password of the logged in user. Every other session
+// is revoked; the current one stays signed in.
+func (s *UserServiceImpl) ChangePassword(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+	sessionID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+
+	var req struct {
+		CurrentPassword string `json:"current_password"`
+		NewPassword     string `json:"new_password"`
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.UserService.ChangePassword", err)
+	}
+
+	if !utils.Required(req.CurrentPassword) {
+		return http.StatusBadRequest, nil, errs.ErrValidation
+	}
+	if !utils.ValidatePassword(req.NewPassword) {
+		return http.StatusBadRequest, nil, errs.ErrWeakPassword
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ChangePassword", err)
+	}
+	if user == nil {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	if status, err := s.accountLocked(ctx, w, user.Email); err != nil {
+		return status, nil, err
+	}
+	if !utils.ComparePassword(user.PasswordHash, req.CurrentPassword) {
+		if err := s.loginFailed(ctx, r, loginAccountKey(user.Email), user.Email, user); err != nil {
+			return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ChangePassword", err)
+		}
+		return http.StatusBadRequest, nil, errs.ErrInvalidPassword
+	}
+
+	hash, err := utils.HashPassword(req.NewPassword)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ChangePassword", err)
+	}
+	if err := s.userRepo.UpdatePassword(ctx, user.ID, hash); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ChangePassword", err)
+	}
+
+	sessionIDs, err := s.sessionRepo.RevokeUserSessions(ctx, user.ID, sessionID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ChangePassword", err)
+	}
+	if err := s.revokeSessions(ctx, sessionIDs); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ChangePassword", err)
+	}
+
+	responseData := map[string]any{
+		"revoked_sessions": len(sessionIDs),
+	}
 	return http.StatusOK, utils.SuccessResponse(responseData), nil
 }
+
+// DELETE -> soft-deletes the account of the logged in user after checking the
+// password. Friendships and pending requests go away immediately and every
+// session is revoked; personal data is purged after the grace period.
+func (s *UserServiceImpl) DeleteAccount(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	var req struct {
+		Password   string `json:"password"`
+		ReauthCode string `json:"reauth_code"` // accounts without a password
+	}
+
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(&req); err != nil {
+		return http.StatusBadRequest, nil, errs.Wrap("service.UserService.DeleteAccount", err)
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	user, err := s.userRepo.GetByID(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.DeleteAccount", err)
+	}
+	if user == nil {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+	if status, err := s.reauthenticate(ctx, w, r, user, req.Password, req.ReauthCode); err != nil {
+		return status, nil, err
+	}
+
+	if err := s.userRepo.SoftDelete(ctx, user.ID); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.DeleteAccount", err)
+	}
+
+	sessionIDs, err := s.sessionRepo.RevokeUserSessions(ctx, user.ID, "")
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.DeleteAccount", err)
+	}
+	if sessionID, _ := r.Context().Value(middleware.SessionIDKey).(string); sessionID != "" && !slices.Contains(sessionIDs, sessionID) {
+		sessionIDs = append(sessionIDs, sessionID)
+	}
+	if err := s.revokeSessions(ctx, sessionIDs); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.DeleteAccount", err)
+	}
+
+	return http.StatusOK, nil, nil
+}
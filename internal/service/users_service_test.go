@@ -0,0 +1,1117 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/jwt"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/go-chi/chi"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type fakeUserRepo struct {
+	user         *model.User
+	passwordHash string
+	deletedID    string
+	profile      *model.Profile
+	handleTaken  bool
+	newHandle    string
+	role         string
+	botIDs       []string
+	created      *model.User
+	privacy      *model.PrivacySettings
+	invites      map[string]string // code hash -> inviter
+}
+
+func (f *fakeUserRepo) SearchUser(context.Context, string, string, int) (model.UsersDTO, error) {
+	return nil, nil
+}
+
+func (f *fakeUserRepo) CreateUser(_ context.Context, user *model.User) error {
+	f.created = user
+	return nil
+}
+
+func (f *fakeUserRepo) CreateInvitedUser(_ context.Context, user *model.User, codeHash string) error {
+	inviter, ok := f.invites[codeHash]
+	if !ok {
+		return errs.ErrInvalidInvite
+	}
+	user.InvitedBy = inviter
+	f.created = user
+	return nil
+}
+
+func (f *fakeUserRepo) GetByEmail(context.Context, string) (*model.User, error) {
+	return f.user, nil
+}
+
+func (f *fakeUserRepo) GetByID(context.Context, string) (*model.User, error) {
+	return f.user, nil
+}
+
+func (f *fakeUserRepo) GetByHandle(context.Context, string) (*model.User, error) {
+	return f.user, nil
+}
+
+func (f *fakeUserRepo) IsHandleAvailable(context.Context, string, string) (bool, error) {
+	return !f.handleTaken, nil
+}
+
+func (f *fakeUserRepo) ChangeHandle(_ context.Context, _, handle string, _ time.Time) error {
+	f.newHandle = handle
+	return nil
+}
+
+func (f *fakeUserRepo) MarkVerified(context.Context, string) error { return nil }
+
+func (f *fakeUserRepo) UpdatePassword(_ context.Context, _, passwordHash string) error {
+	f.passwordHash = passwordHash
+	return nil
+}
+
+func (f *fakeUserRepo) RehashPassword(_ context.Context, _, _, newHash string) error {
+	f.passwordHash = newHash
+	return nil
+}
+
+func (f *fakeUserRepo) UpdatePrivacy(_ context.Context, _ string, privacy *model.PrivacySettings) error {
+	f.privacy = privacy
+	return nil
+}
+
+func (f *fakeUserRepo) TouchLastSeen(context.Context, string) error { return nil }
+
+func (f *fakeUserRepo) UpdateProfile(_ context.Context, _ string, profile *model.Profile) error {
+	f.profile = profile
+	return nil
+}
+
+func (f *fakeUserRepo) UpdateRole(_ context.Context, _, role string) error {
+	f.role = role
+	return nil
+}
+
+func (f *fakeUserRepo) IsBot(_ context.Context, userIDs ...string) (bool, error) {
+	for _, id := range userIDs {
+		if slices.Contains(f.botIDs, id) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (f *fakeUserRepo) SoftDelete(_ context.Context, id string) error {
+	f.deletedID = id
+	return nil
+}
+
+func (f *fakeUserRepo) PurgeDeleted(context.Context, time.Time) (int64, error) { return 0, nil }
+
+type fakeSessionRepo struct {
+	rotateErr     error
+	rotatedHash   string
+	rotatedNext   *model.RefreshToken
+	createdToken  *model.RefreshToken
+	createdRecord *model.Session
+	userSessions  []string
+	keptSession   string
+	sessions      []model.Session
+	revokedID     string
+	newDevice     bool
+}
+
+func (f *fakeSessionRepo) CreateSession(_ context.Context, session *model.Session, token *model.RefreshToken) error {
+	f.createdRecord = session
+	f.createdToken = token
+	return nil
+}
+
+func (f *fakeSessionRepo) RotateRefreshToken(_ context.Context, tokenHash string, next *model.RefreshToken) (*model.Session, error) {
+	f.rotatedHash = tokenHash
+	f.rotatedNext = next
+	if f.rotateErr != nil {
+		return nil, f.rotateErr
+	}
+	return &model.Session{ID: next.SessionID, UserID: "user-1", ExpiresAt: next.ExpiresAt}, nil
+}
+
+func (f *fakeSessionRepo) RevokeSession(_ context.Context, sessionID, userID string) error {
+	for _, session := range f.sessions {
+		if session.ID == sessionID && session.UserID == userID {
+			f.revokedID = sessionID
+			return nil
+		}
+	}
+	return errs.ErrNotFound
+}
+
+func (f *fakeSessionRepo) ListSessions(context.Context, string) ([]model.Session, error) {
+	return f.sessions, nil
+}
+
+func (f *fakeSessionRepo) IsKnownDevice(context.Context, string, string) (bool, error) {
+	return !f.newDevice, nil
+}
+
+func (f *fakeSessionRepo) RevokeUserSessions(_ context.Context, _, exceptSessionID string) ([]string, error) {
+	f.keptSession = exceptSessionID
+	return f.userSessions, nil
+}
+
+func useTestJWTConfig(t *testing.T) {
+	t.Helper()
+	oldConfig := config.Config
+	t.Cleanup(func() { config.Config = oldConfig })
+
+	config.Config.JWT = config.JWTConfig{
+		Secret:        "test-secret",
+		Expiry:        time.Hour,
+		Issuer:        "system",
+		RefreshExpiry: 2 * time.Hour,
+	}
+}
+
+func TestRefreshTokenRotatesHashedToken(t *testing.T) {
+	useTestJWTConfig(t)
+
+	refreshToken, _, err := jwt.GenerateRefreshToken("user-1", "session-1")
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken failed: %v", err)
+	}
+
+	sessions := &fakeSessionRepo{}
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Email: "a@example.com", Role: "user"}}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: sessions})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", bytes.NewBufferString(`{"refresh_token":"`+refreshToken+`"}`))
+	status, resp, err := service.RefreshToken(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	if sessions.rotatedHash != utils.HashToken(refreshToken) {
+		t.Fatalf("expected presented token to be looked up by hash")
+	}
+	if sessions.rotatedNext == nil || sessions.rotatedNext.SessionID != "session-1" {
+		t.Fatalf("expected rotation within session-1, got %#v", sessions.rotatedNext)
+	}
+
+	data := resp.Data.(map[string]any)
+	next, _ := data["refresh_token"].(string)
+	if next == "" || next == refreshToken {
+		t.Fatalf("expected a new refresh token, got %q", next)
+	}
+	if sessions.rotatedNext.TokenHash != utils.HashToken(next) {
+		t.Fatalf("expected stored hash to match returned refresh token")
+	}
+}
+
+func TestRefreshTokenRejectsReusedToken(t *testing.T) {
+	useTestJWTConfig(t)
+
+	refreshToken, _, err := jwt.GenerateRefreshToken("user-1", "session-1")
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken failed: %v", err)
+	}
+
+	sessions := &fakeSessionRepo{rotateErr: errs.ErrRefreshTokenReused}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: &fakeUserRepo{}, SessionRepo: sessions})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/refresh", bytes.NewBufferString(`{"refresh_token":"`+refreshToken+`"}`))
+	status, resp, err := service.RefreshToken(httptest.NewRecorder(), req)
+	if status != http.StatusUnauthorized {
+		t.Fatalf("expected status %d, got %d", http.StatusUnauthorized, status)
+	}
+	if resp != nil {
+		t.Fatalf("expected nil response, got %#v", resp)
+	}
+	if !errors.Is(err, errs.ErrRefreshTokenReused) {
+		t.Fatalf("expected reuse error, got %v", err)
+	}
+}
+
+type fakeVerificationRepo struct {
+	valid        bool
+	consumedHash string
+	created      []*model.VerificationCode
+}
+
+func (f *fakeVerificationRepo) CreateCode(_ context.Context, code *model.VerificationCode) error {
+	f.created = append(f.created, code)
+	return nil
+}
+
+func (f *fakeVerificationRepo) ConsumeCode(_ context.Context, _ string, _ model.VerificationPurpose, codeHash string, _ int) (bool, error) {
+	f.consumedHash = codeHash
+	return f.valid, nil
+}
+
+type fakeAuthStore struct {
+	revokedSessions []string
+	challenges      map[string]string
+	tickets         map[string]string
+	loginFailures   map[string]int64
+	loginBlocks     map[string]time.Duration
+	oidcStates      map[string]string
+	counters        map[string]int
+}
+
+func (f *fakeAuthStore) RevokeSessions(_ context.Context, sessionIDs []string, _ time.Duration) error {
+	f.revokedSessions = append(f.revokedSessions, sessionIDs...)
+	return nil
+}
+
+func (f *fakeAuthStore) RevokeToken(context.Context, string, time.Duration) error { return nil }
+
+func (f *fakeAuthStore) IsRevoked(context.Context, string, string) (bool, error) { return false, nil }
+
+func (f *fakeAuthStore) Allow(_ context.Context, key string, limit int, _ time.Duration) (bool, error) {
+	if f.counters == nil {
+		f.counters = map[string]int{}
+	}
+	f.counters[key]++
+	return f.counters[key] <= limit, nil
+}
+
+func (f *fakeAuthStore) SetMFAChallenge(_ context.Context, tokenHash, userID string, _ time.Duration) error {
+	if f.challenges == nil {
+		f.challenges = map[string]string{}
+	}
+	f.challenges[tokenHash] = userID
+	return nil
+}
+
+func (f *fakeAuthStore) GetMFAChallenge(_ context.Context, tokenHash string) (string, error) {
+	return f.challenges[tokenHash], nil
+}
+
+func (f *fakeAuthStore) DeleteMFAChallenge(_ context.Context, tokenHash string) (bool, error) {
+	_, ok := f.challenges[tokenHash]
+	delete(f.challenges, tokenHash)
+	return ok, nil
+}
+
+func (f *fakeAuthStore) SetWSTicket(_ context.Context, ticketHash, userID, sessionID string, _ time.Duration) error {
+	if f.tickets == nil {
+		f.tickets = map[string]string{}
+	}
+	f.tickets[ticketHash] = userID + ":" + sessionID
+	return nil
+}
+
+func (f *fakeAuthStore) ConsumeWSTicket(_ context.Context, ticketHash string) (string, string, error) {
+	val, ok := f.tickets[ticketHash]
+	delete(f.tickets, ticketHash)
+	if !ok {
+		return "", "", nil
+	}
+	userID, sessionID, _ := strings.Cut(val, ":")
+	return userID, sessionID, nil
+}
+
+func (f *fakeAuthStore) SetOIDCState(_ context.Context, stateHash, codeVerifier, nonce string, _ time.Duration) error {
+	if f.oidcStates == nil {
+		f.oidcStates = map[string]string{}
+	}
+	f.oidcStates[stateHash] = codeVerifier + ":" + nonce
+	return nil
+}
+
+func (f *fakeAuthStore) ConsumeOIDCState(_ context.Context, stateHash string) (string, string, error) {
+	val, ok := f.oidcStates[stateHash]
+	delete(f.oidcStates, stateHash)
+	if !ok {
+		return "", "", nil
+	}
+	codeVerifier, nonce, _ := strings.Cut(val, ":")
+	return codeVerifier, nonce, nil
+}
+
+func (f *fakeAuthStore) LoginBlockedFor(_ context.Context, account string) (time.Duration, error) {
+	return f.loginBlocks[account], nil
+}
+
+func (f *fakeAuthStore) RecordLoginFailure(_ context.Context, account string, _ time.Duration) (int64, error) {
+	if f.loginFailures == nil {
+		f.loginFailures = map[string]int64{}
+	}
+	f.loginFailures[account]++
+	return f.loginFailures[account], nil
+}
+
+func (f *fakeAuthStore) BlockLogin(_ context.Context, account string, d time.Duration) error {
+	if f.loginBlocks == nil {
+		f.loginBlocks = map[string]time.Duration{}
+	}
+	f.loginBlocks[account] = d
+	return nil
+}
+
+func (f *fakeAuthStore) ClearLoginFailures(_ context.Context, account string) error {
+	delete(f.loginFailures, account)
+	delete(f.loginBlocks, account)
+	return nil
+}
+
+type fakeSecurityRepo struct {
+	events []*model.SecurityEvent
+}
+
+func (f *fakeSecurityRepo) Record(_ context.Context, event *model.SecurityEvent) error {
+	f.events = append(f.events, event)
+	return nil
+}
+
+func TestResetPasswordUpdatesHashAndRevokesSessions(t *testing.T) {
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Email: "a@example.com"}}
+	sessions := &fakeSessionRepo{userSessions: []string{"session-1", "session-2"}}
+	codes := &fakeVerificationRepo{valid: true}
+	store := &fakeAuthStore{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: sessions, VerificationRepo: codes, AuthStore: store})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/password/reset",
+		bytes.NewBufferString(`{"email":"a@example.com","token":"reset-token","new_password":"new-password-1"}`))
+	status, _, err := service.ResetPassword(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	if codes.consumedHash != utils.HashToken("reset-token") {
+		t.Fatalf("expected reset token to be checked by hash")
+	}
+	if !utils.ComparePassword(users.passwordHash, "new-password-1") {
+		t.Fatalf("expected new password hash to be stored")
+	}
+	if len(store.revokedSessions) != 2 {
+		t.Fatalf("expected all sessions to be revoked, got %v", store.revokedSessions)
+	}
+}
+
+func TestVerificationLimitsHoldPerAddressAcrossCodes(t *testing.T) {
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Username: "alice", Email: "a@example.com"}}
+	mail := &fakeMailer{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: &fakeSessionRepo{}, VerificationRepo: &fakeVerificationRepo{}, AuthStore: &fakeAuthStore{}, Mailer: mail})
+
+	// Resends to one address stop mailing past the limit, whatever the spelling
+	for _, email := range []string{"a@example.com", "A@Example.com", "a@EXAMPLE.com", "a@example.com", "A@example.com"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/email/resend",
+			bytes.NewBufferString(`{"email":"`+email+`"}`))
+		if status, _, err := service.ResendVerification(httptest.NewRecorder(), req); status != http.StatusOK {
+			t.Fatalf("expected resends to always answer 200, got %d %v", status, err)
+		}
+	}
+	if len(mail.sent) != verificationResendLimit {
+		t.Fatalf("expected %d verification emails, got %d", verificationResendLimit, len(mail.sent))
+	}
+
+	// Fresh codes do not bring fresh guesses
+	for i := 0; i <= verificationAttemptLimit; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/email/verify",
+			bytes.NewBufferString(`{"email":"a@example.com","code":"000000"}`))
+		status, _, err := service.VerifyEmail(httptest.NewRecorder(), req)
+		if i < verificationAttemptLimit && (status != http.StatusBadRequest || !errors.Is(err, errs.ErrInvalidCode)) {
+			t.Fatalf("attempt %d: expected an invalid code, got %d %v", i+1, status, err)
+		}
+		if i == verificationAttemptLimit && (status != http.StatusTooManyRequests || !errors.Is(err, errs.ErrTooManyAttempts)) {
+			t.Fatalf("expected guesses past the limit to be refused, got %d %v", status, err)
+		}
+	}
+
+	// Someone else's guesses do not lock the owner out
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/email/verify",
+		bytes.NewBufferString(`{"email":"a@example.com","code":"000000"}`))
+	req.RemoteAddr = "198.51.100.7:4321"
+	if status, _, err := service.VerifyEmail(httptest.NewRecorder(), req); status != http.StatusBadRequest || !errors.Is(err, errs.ErrInvalidCode) {
+		t.Fatalf("expected another caller to still be able to verify, got %d %v", status, err)
+	}
+}
+
+func TestForgotPasswordLimitHoldsPerAddress(t *testing.T) {
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Username: "alice", Email: "a@example.com"}}
+	mail := &fakeMailer{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: &fakeSessionRepo{}, VerificationRepo: &fakeVerificationRepo{}, AuthStore: &fakeAuthStore{}, Mailer: mail})
+
+	// Other spellings of the address share its quota
+	for _, email := range []string{"a@example.com", "A@Example.com", "a@EXAMPLE.com", "a@example.com", "A@example.com"} {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/password/forgot",
+			bytes.NewBufferString(`{"email":"`+email+`"}`))
+		if status, _, err := service.ForgotPassword(httptest.NewRecorder(), req); status != http.StatusOK {
+			t.Fatalf("expected reset requests to always answer 200, got %d %v", status, err)
+		}
+	}
+	if len(mail.sent) != passwordResetLimit {
+		t.Fatalf("expected %d reset emails, got %d", passwordResetLimit, len(mail.sent))
+	}
+}
+
+func TestResetPasswordRejectsInvalidToken(t *testing.T) {
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Email: "a@example.com"}}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: &fakeSessionRepo{}, VerificationRepo: &fakeVerificationRepo{}, AuthStore: &fakeAuthStore{}})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/password/reset",
+		bytes.NewBufferString(`{"email":"a@example.com","token":"wrong","new_password":"new-password-1"}`))
+	status, _, err := service.ResetPassword(httptest.NewRecorder(), req)
+	if status != http.StatusBadRequest {
+		t.Fatalf("expected status %d, got %d", http.StatusBadRequest, status)
+	}
+	if !errors.Is(err, errs.ErrInvalidCode) {
+		t.Fatalf("expected invalid code error, got %v", err)
+	}
+	if users.passwordHash != "" {
+		t.Fatalf("expected password to stay unchanged")
+	}
+}
+
+func TestChangePasswordKeepsCurrentSession(t *testing.T) {
+	current, err := utils.HashPassword("old-password-1")
+	if err != nil {
+		t.Fatalf("HashPassword failed: %v", err)
+	}
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", PasswordHash: current}}
+	sessions := &fakeSessionRepo{userSessions: []string{"session-2"}}
+	store := &fakeAuthStore{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: sessions, AuthStore: store})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/me/password",
+		bytes.NewBufferString(`{"current_password":"old-password-1","new_password":"new-password-1"}`))
+	ctx := context.WithValue(req.Context(), middleware.UserIDKey, "user-1")
+	ctx = context.WithValue(ctx, middleware.SessionIDKey, "session-1")
+	req = req.WithContext(ctx)
+
+	status, _, err := service.ChangePassword(httptest.NewRecorder(), req)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	if sessions.keptSession != "session-1" {
+		t.Fatalf("expected current session to be kept, got %q", sessions.keptSession)
+	}
+	if len(store.revokedSessions) != 1 || store.revokedSessions[0] != "session-2" {
+		t.Fatalf("expected only other sessions to be revoked, got %v", store.revokedSessions)
+	}
+	if !utils.ComparePassword(users.passwordHash, "new-password-1") {
+		t.Fatalf("expected new password hash to be stored")
+	}
+}
+
+func TestChangePasswordRejectsWrongCurrentPassword(t *testing.T) {
+	current, err := utils.HashPassword("old-password-1")
+	if err != nil {
+		t.Fatalf("HashPassword failed: %v", err)
+	}
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", PasswordHash: current}}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: &fakeSessionRepo{}, AuthStore: &fakeAuthStore{}})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/users/me/password",
+		bytes.NewBufferString(`{"current_password":"not-it","new_password":"new-password-1"}`))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+
+	status, _, err := service.ChangePassword(httptest.NewRecorder(), req)
+	if status != http.StatusBadRequest || !errors.Is(err, errs.ErrInvalidPassword) {
+		t.Fatalf("expected invalid password, got status %d err %v", status, err)
+	}
+	if users.passwordHash != "" {
+		t.Fatalf("expected password to stay unchanged")
+	}
+}
+
+func TestWrongCurrentPasswordsCountTowardsLockout(t *testing.T) {
+	hash, _ := utils.HashPassword("password-1")
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Email: "a@example.com", PasswordHash: hash}}
+	store := &fakeAuthStore{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: &fakeSessionRepo{}, SecurityRepo: &fakeSecurityRepo{}, AuthStore: store})
+
+	call := func(fn func(http.ResponseWriter, *http.Request) (int, *utils.APIResponse, error), method, path, body string) (int, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+		rec := httptest.NewRecorder()
+		status, _, _ := fn(rec, req)
+		return status, rec
+	}
+
+	// A stolen session cannot search for the password faster than a login
+	policy := lockoutPolicy()
+	if status, _ := call(service.ChangePassword, http.MethodPost, "/api/v1/users/me/password",
+		`{"current_password":"not-it","new_password":"new-password-1"}`); status != http.StatusBadRequest {
+		t.Fatalf("expected wrong current password to be rejected, got %d", status)
+	}
+	for i := 1; i <= policy.FreeAttempts; i++ {
+		if status, _ := call(service.DeleteAccount, http.MethodDelete, "/api/v1/users/me", `{"password":"not-it"}`); status != http.StatusBadRequest {
+			t.Fatalf("attempt %d: expected wrong password to be rejected, got %d", i+1, status)
+		}
+	}
+	if got := store.loginFailures[loginAccountKey("a@example.com")]; got != int64(policy.FreeAttempts+1) {
+		t.Fatalf("expected every wrong password counted, got %d", got)
+	}
+
+	for name, tt := range map[string]struct {
+		fn     func(http.ResponseWriter, *http.Request) (int, *utils.APIResponse, error)
+		method string
+		path   string
+		body   string
+	}{
+		"change password": {service.ChangePassword, http.MethodPost, "/api/v1/users/me/password", `{"current_password":"password-1","new_password":"new-password-1"}`},
+		"delete account":  {service.DeleteAccount, http.MethodDelete, "/api/v1/users/me", `{"password":"password-1"}`},
+	} {
+		status, rec := call(tt.fn, tt.method, tt.path, tt.body)
+		if status != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("%s: expected a locked account to get 429 with Retry-After, got %d", name, status)
+		}
+	}
+	if users.deletedID != "" || users.passwordHash != "" {
+		t.Fatalf("expected a locked account to stay unchanged")
+	}
+}
+
+type fakeMFARepo struct {
+	mfa      *model.UserMFA
+	recovery map[string]bool
+}
+
+func (f *fakeMFARepo) GetMFA(context.Context, string) (*model.UserMFA, error) { return f.mfa, nil }
+
+func (f *fakeMFARepo) SaveSecret(context.Context, string, string) error { return nil }
+
+func (f *fakeMFARepo) Enable(context.Context, string, int64, []string) error { return nil }
+
+func (f *fakeMFARepo) Disable(context.Context, string) error { return nil }
+
+func (f *fakeMFARepo) UseStep(_ context.Context, _ string, step int64) (bool, error) {
+	if step <= f.mfa.LastUsedStep {
+		return false, nil
+	}
+	f.mfa.LastUsedStep = step
+	return true, nil
+}
+
+func (f *fakeMFARepo) UseRecoveryCode(_ context.Context, _ string, codeHash string) (bool, error) {
+	if !f.recovery[codeHash] {
+		return false, nil
+	}
+	delete(f.recovery, codeHash)
+	return true, nil
+}
+
+func (f *fakeMFARepo) ReplaceRecoveryCodes(context.Context, string, []string) error { return nil }
+
+func useTestMFAConfig(t *testing.T) []byte {
+	t.Helper()
+	useTestJWTConfig(t)
+
+	key := make([]byte, 32)
+	config.Config.MFA = config.MFAConfig{
+		Issuer:        "test",
+		EncryptionKey: base64.StdEncoding.EncodeToString(key),
+	}
+	return key
+}
+
+func TestLoginWithMFARequiresSecondFactor(t *testing.T) {
+	key := useTestMFAConfig(t)
+
+	secret, _ := utils.GenerateTOTPSecret()
+	secretEnc, err := utils.EncryptSecret(key, secret)
+	if err != nil {
+		t.Fatalf("EncryptSecret failed: %v", err)
+	}
+	hash, _ := utils.HashPassword("password-1")
+
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Email: "a@example.com", PasswordHash: hash}}
+	mfa := &fakeMFARepo{mfa: &model.UserMFA{
+		UserID:    "user-1",
+		SecretEnc: secretEnc,
+		EnabledAt: sql.NullTime{Time: time.Now(), Valid: true},
+	}}
+	sessions := &fakeSessionRepo{}
+	store := &fakeAuthStore{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: sessions, MFARepo: mfa, AuthStore: store})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login",
+		bytes.NewBufferString(`{"email":"a@example.com","password":"password-1"}`))
+	status, resp, err := service.Login(httptest.NewRecorder(), req)
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("expected challenge, got status %d err %v", status, err)
+	}
+	data := resp.Data.(map[string]any)
+	if data["mfa_required"] != true || data["token"] != nil {
+		t.Fatalf("expected mfa challenge without tokens, got %#v", data)
+	}
+	if sessions.createdRecord != nil {
+		t.Fatalf("expected no session before the second factor")
+	}
+	mfaToken := data["mfa_token"].(string)
+
+	code, _ := utils.TOTPCode(secret, time.Now())
+	body := `{"mfa_token":"` + mfaToken + `","code":"` + code + `"}`
+	status, resp, err = service.VerifyMFA(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/api/v1/auth/mfa/verify", bytes.NewBufferString(body)))
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("expected tokens, got status %d err %v", status, err)
+	}
+	if token, _ := resp.Data.(map[string]any)["token"].(string); token == "" {
+		t.Fatalf("expected access token after verification")
+	}
+
+	// The challenge and the TOTP step are both single use
+	status, _, _ = service.VerifyMFA(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/api/v1/auth/mfa/verify", bytes.NewBufferString(body)))
+	if status != http.StatusUnauthorized {
+		t.Fatalf("expected replay to be rejected, got %d", status)
+	}
+}
+
+func TestWrongSecondFactorCountsTowardsLockout(t *testing.T) {
+	key := useTestMFAConfig(t)
+
+	secret, _ := utils.GenerateTOTPSecret()
+	secretEnc, _ := utils.EncryptSecret(key, secret)
+	hash, _ := utils.HashPassword("password-1")
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Email: "a@example.com", PasswordHash: hash}}
+	mfa := &fakeMFARepo{mfa: &model.UserMFA{UserID: "user-1", SecretEnc: secretEnc, EnabledAt: sql.NullTime{Time: time.Now(), Valid: true}}}
+	store := &fakeAuthStore{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: &fakeSessionRepo{}, MFARepo: mfa, AuthStore: store})
+
+	login := func() (int, string) {
+		users.user.PasswordHash = hash // Login clears it on the shared user
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login",
+			bytes.NewBufferString(`{"email":"a@example.com","password":"password-1"}`))
+		status, resp, _ := service.Login(httptest.NewRecorder(), req)
+		if resp == nil {
+			return status, ""
+		}
+		return status, resp.Data.(map[string]any)["mfa_token"].(string)
+	}
+
+	// Each new challenge keeps the failures of the earlier ones
+	policy := lockoutPolicy()
+	for i := 0; i <= policy.FreeAttempts; i++ {
+		status, token := login()
+		if status != http.StatusOK {
+			t.Fatalf("round %d: expected a challenge, got %d", i+1, status)
+		}
+		body := `{"mfa_token":"` + token + `","code":"000000"}`
+		if status, _, _ := service.VerifyMFA(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodPost, "/api/v1/auth/mfa/verify", bytes.NewBufferString(body))); status != http.StatusUnauthorized {
+			t.Fatalf("round %d: expected wrong code to be rejected, got %d", i+1, status)
+		}
+	}
+	if got := store.loginFailures[loginAccountKey("a@example.com")]; got != int64(policy.FreeAttempts+1) {
+		t.Fatalf("expected every wrong code counted, got %d", got)
+	}
+	if status, _ := login(); status != http.StatusTooManyRequests {
+		t.Fatalf("expected the account to be throttled, got %d", status)
+	}
+
+	// A complete login clears the failures
+	delete(store.loginBlocks, loginAccountKey("a@example.com"))
+	_, token := login()
+	code, _ := utils.TOTPCode(secret, time.Now())
+	body := `{"mfa_token":"` + token + `","code":"` + code + `"}`
+	if status, _, err := service.VerifyMFA(httptest.NewRecorder(),
+		httptest.NewRequest(http.MethodPost, "/api/v1/auth/mfa/verify", bytes.NewBufferString(body))); status != http.StatusOK {
+		t.Fatalf("expected login to complete, got %d %v", status, err)
+	}
+	if _, ok := store.loginFailures[loginAccountKey("a@example.com")]; ok {
+		t.Fatalf("expected failures to be cleared after the second factor")
+	}
+}
+
+func TestWrongCodesInMFASettingsCountTowardsLockout(t *testing.T) {
+	key := useTestMFAConfig(t)
+
+	secret, _ := utils.GenerateTOTPSecret()
+	secretEnc, _ := utils.EncryptSecret(key, secret)
+	hash, _ := utils.HashPassword("password-1")
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Email: "a@example.com", PasswordHash: hash}}
+	mfa := &fakeMFARepo{mfa: &model.UserMFA{UserID: "user-1", SecretEnc: secretEnc, EnabledAt: sql.NullTime{Time: time.Now(), Valid: true}}}
+	store := &fakeAuthStore{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, MFARepo: mfa, SecurityRepo: &fakeSecurityRepo{}, AuthStore: store})
+
+	call := func(fn func(http.ResponseWriter, *http.Request) (int, *utils.APIResponse, error), method, body string) (int, *httptest.ResponseRecorder) {
+		req := httptest.NewRequest(method, "/api/v1/users/me/mfa", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+		rec := httptest.NewRecorder()
+		status, _, _ := fn(rec, req)
+		return status, rec
+	}
+
+	// A stolen session gets the same few guesses as a login
+	policy := lockoutPolicy()
+	for i := 0; i <= policy.FreeAttempts; i++ {
+		if status, _ := call(service.RegenerateRecoveryCodes, http.MethodPost, `{"code":"000000"}`); status != http.StatusBadRequest {
+			t.Fatalf("attempt %d: expected wrong code to be rejected, got %d", i+1, status)
+		}
+	}
+	if got := store.loginFailures[loginAccountKey("a@example.com")]; got != int64(policy.FreeAttempts+1) {
+		t.Fatalf("expected every wrong code counted, got %d", got)
+	}
+
+	code, _ := utils.TOTPCode(secret, time.Now())
+	for name, tt := range map[string]struct {
+		fn     func(http.ResponseWriter, *http.Request) (int, *utils.APIResponse, error)
+		method string
+		body   string
+	}{
+		"regenerate": {service.RegenerateRecoveryCodes, http.MethodPost, `{"code":"` + code + `"}`},
+		"confirm":    {service.ConfirmMFA, http.MethodPost, `{"code":"` + code + `"}`},
+		"disable":    {service.DisableMFA, http.MethodDelete, `{"password":"password-1","code":"` + code + `"}`},
+	} {
+		status, rec := call(tt.fn, tt.method, tt.body)
+		if status != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+			t.Fatalf("%s: expected a locked account to get 429 with Retry-After, got %d", name, status)
+		}
+	}
+}
+
+func TestVerifyMFAAcceptsRecoveryCodeOnce(t *testing.T) {
+	useTestMFAConfig(t)
+
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Email: "a@example.com"}}
+	mfa := &fakeMFARepo{
+		mfa: &model.UserMFA{
+			UserID:    "user-1",
+			EnabledAt: sql.NullTime{Time: time.Now(), Valid: true},
+		},
+		recovery: map[string]bool{utils.HashToken("abcde12345"): true},
+	}
+	store := &fakeAuthStore{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: &fakeSessionRepo{}, MFARepo: mfa, AuthStore: store})
+
+	for i, want := range []int{http.StatusOK, http.StatusUnauthorized} {
+		_ = store.SetMFAChallenge(context.Background(), utils.HashToken("challenge"), "user-1", time.Minute)
+		body := `{"mfa_token":"challenge","recovery_code":"ABCDE-12345"}`
+		status, _, _ := service.VerifyMFA(httptest.NewRecorder(),
+			httptest.NewRequest(http.MethodPost, "/api/v1/auth/mfa/verify", bytes.NewBufferString(body)))
+		if status != want {
+			t.Fatalf("attempt %d: expected status %d, got %d", i+1, want, status)
+		}
+	}
+}
+
+func TestDeleteAccountSoftDeletesAndRevokesSessions(t *testing.T) {
+	hash, _ := utils.HashPassword("password-1")
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", PasswordHash: hash}}
+	sessions := &fakeSessionRepo{userSessions: []string{"session-2"}}
+	store := &fakeAuthStore{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: sessions, AuthStore: store})
+
+	req := httptest.NewRequest(http.MethodDelete, "/api/v1/users/me", bytes.NewBufferString(`{"password":"wrong"}`))
+	req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+	if status, _, _ := service.DeleteAccount(httptest.NewRecorder(), req); status != http.StatusBadRequest {
+		t.Fatalf("expected wrong password to be rejected, got %d", status)
+	}
+	if users.deletedID != "" {
+		t.Fatalf("expected account to stay after wrong password")
+	}
+
+	req = httptest.NewRequest(http.MethodDelete, "/api/v1/users/me", bytes.NewBufferString(`{"password":"password-1"}`))
+	ctx := context.WithValue(req.Context(), middleware.UserIDKey, "user-1")
+	ctx = context.WithValue(ctx, middleware.SessionIDKey, "session-1")
+	status, _, err := service.DeleteAccount(httptest.NewRecorder(), req.WithContext(ctx))
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("expected deletion, got status %d err %v", status, err)
+	}
+	if users.deletedID != "user-1" {
+		t.Fatalf("expected user-1 to be soft-deleted, got %q", users.deletedID)
+	}
+	if len(store.revokedSessions) != 2 {
+		t.Fatalf("expected every session including the current one to be revoked, got %v", store.revokedSessions)
+	}
+}
+
+type fakePublisher struct {
+	event   string
+	payload any
+	userIDs []string
+	sent    []publishedEvent // every event, oldest first
+}
+
+type publishedEvent struct {
+	event   string
+	payload any
+	userIDs []string
+}
+
+func (f *fakePublisher) Publish(event, _ string, payload any, userIDs ...string) {
+	f.event = event
+	f.payload = payload
+	f.userIDs = userIDs
+	f.sent = append(f.sent, publishedEvent{event: event, payload: payload, userIDs: userIDs})
+}
+
+func TestUpdateMeValidatesAndNotifiesFriends(t *testing.T) {
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Username: "alex", Profile: model.Profile{Bio: "old"}}}
+	friends := fakeFriendRepo{friendIDs: []string{"user-2"}}
+	publisher := &fakePublisher{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, FriendRepo: friends, Publisher: publisher})
+
+	patch := func(body string) (int, *utils.APIResponse) {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/users/me", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+		status, resp, _ := service.UpdateMe(httptest.NewRecorder(), req)
+		return status, resp
+	}
+
+	for _, body := range []string{
+		`{"avatar_url":"javascript:alert(1)"}`,
+		`{"timezone":"Mars/Olympus"}`,
+		`{"display_name":"` + strings.Repeat("x", 51) + `"}`,
+	} {
+		if status, _ := patch(body); status != http.StatusBadRequest {
+			t.Fatalf("expected %s to be rejected, got %d", body, status)
+		}
+	}
+	if users.profile != nil {
+		t.Fatalf("expected no update for invalid input")
+	}
+
+	status, _ := patch(`{"display_name":" Alex ","timezone":"Europe/Berlin"}`)
+	if status != http.StatusOK {
+		t.Fatalf("expected status %d, got %d", http.StatusOK, status)
+	}
+	if users.profile.DisplayName != "Alex" || users.profile.Bio != "old" || users.profile.Timezone != "Europe/Berlin" {
+		t.Fatalf("expected partial update, got %#v", users.profile)
+	}
+	if publisher.event != "profile_updated" || len(publisher.userIDs) != 2 {
+		t.Fatalf("expected profile_updated to friend and self, got %q %v", publisher.event, publisher.userIDs)
+	}
+}
+
+func TestChangeHandleEnforcesPolicyAndCooldown(t *testing.T) {
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Username: "alex"}}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, FriendRepo: fakeFriendRepo{}})
+
+	change := func(handle string) int {
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/users/me/handle", bytes.NewBufferString(`{"handle":"`+handle+`"}`))
+		req = req.WithContext(context.WithValue(req.Context(), middleware.UserIDKey, "user-1"))
+		status, _, _ := service.ChangeHandle(httptest.NewRecorder(), req)
+		return status
+	}
+
+	for _, handle := range []string{"al", "alex smith", "Admin"} {
+		if status := change(handle); status != http.StatusBadRequest {
+			t.Fatalf("expected %q to be rejected, got %d", handle, status)
+		}
+	}
+
+	users.handleTaken = true
+	if status := change("alex_2"); status != http.StatusConflict {
+		t.Fatalf("expected taken handle to conflict, got %d", status)
+	}
+
+	users.handleTaken = false
+	if status := change("alex_2"); status != http.StatusOK || users.newHandle != "alex_2" {
+		t.Fatalf("expected rename, got status %d handle %q", status, users.newHandle)
+	}
+
+	users.newHandle = ""
+	users.user.UsernameChangedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	if status := change("alex_3"); status != http.StatusTooManyRequests || users.newHandle != "" {
+		t.Fatalf("expected cooldown, got status %d", status)
+	}
+}
+
+func TestAdminSetRoleRevokesTargetSessions(t *testing.T) {
+	useTestJWTConfig(t)
+
+	users := &fakeUserRepo{}
+	sessions := &fakeSessionRepo{userSessions: []string{"session-9"}}
+	store := &fakeAuthStore{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: sessions, AuthStore: store})
+
+	const target = "6f1c2a8e-4a61-4f0e-9d0b-2a4f3c9e1b7d"
+	setRole := func(adminID, id, body string) int {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/admin/users/"+id+"/role", bytes.NewBufferString(body))
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		ctx = context.WithValue(ctx, middleware.UserIDKey, adminID)
+		status, _, _ := service.AdminSetRole(httptest.NewRecorder(), req.WithContext(ctx))
+		return status
+	}
+
+	if status := setRole("admin-1", target, `{"role":"superuser"}`); status != http.StatusBadRequest {
+		t.Fatalf("expected unknown role to be rejected, got %d", status)
+	}
+	if status := setRole(target, target, `{"role":"user"}`); status != http.StatusBadRequest {
+		t.Fatalf("expected own role change to be rejected, got %d", status)
+	}
+	if users.role != "" {
+		t.Fatalf("expected no role change, got %q", users.role)
+	}
+
+	if status := setRole("admin-1", target, `{"role":"moderator"}`); status != http.StatusOK {
+		t.Fatalf("expected role change, got %d", status)
+	}
+	if users.role != "moderator" {
+		t.Fatalf("expected moderator, got %q", users.role)
+	}
+	if sessions.keptSession != "" || len(store.revokedSessions) != 1 {
+		t.Fatalf("expected every session of the target to be revoked, got %v", store.revokedSessions)
+	}
+}
+
+func TestLogoutAllCountsCurrentSessionOnce(t *testing.T) {
+	useTestJWTConfig(t)
+
+	// The repository returns the current session along with the others
+	sessions := &fakeSessionRepo{userSessions: []string{"session-1", "session-2"}}
+	store := &fakeAuthStore{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: &fakeUserRepo{}, SessionRepo: sessions, AuthStore: store})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/logout-all", nil)
+	ctx := context.WithValue(req.Context(), middleware.UserIDKey, "user-1")
+	ctx = context.WithValue(ctx, middleware.SessionIDKey, "session-1")
+	status, resp, err := service.LogoutAll(httptest.NewRecorder(), req.WithContext(ctx))
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("expected logout, got %d %v", status, err)
+	}
+	if revoked := resp.Data.(map[string]any)["revoked_sessions"]; revoked != 2 {
+		t.Fatalf("expected 2 revoked sessions, got %v", revoked)
+	}
+	if !slices.Equal(store.revokedSessions, []string{"session-1", "session-2"}) {
+		t.Fatalf("expected each session denylisted once, got %v", store.revokedSessions)
+	}
+}
+
+func TestCreateWSTicketStoresHashedTicketForSession(t *testing.T) {
+	store := &fakeAuthStore{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: &fakeUserRepo{}, AuthStore: store})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/ws/ticket", nil)
+	ctx := context.WithValue(req.Context(), middleware.UserIDKey, "user-1")
+	ctx = context.WithValue(ctx, middleware.SessionIDKey, "session-1")
+	status, resp, err := service.CreateWSTicket(httptest.NewRecorder(), req.WithContext(ctx))
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("expected ticket, got status %d err %v", status, err)
+	}
+
+	ticket, _ := resp.Data.(map[string]any)["ticket"].(string)
+	if _, ok := store.tickets[ticket]; ok {
+		t.Fatalf("expected ticket to be stored hashed")
+	}
+	userID, sessionID, _ := store.ConsumeWSTicket(context.Background(), utils.HashToken(ticket))
+	if userID != "user-1" || sessionID != "session-1" {
+		t.Fatalf("expected ticket bound to user-1/session-1, got %q/%q", userID, sessionID)
+	}
+}
+
+func TestLoginLocksOutAccountsWhetherOrNotTheyExist(t *testing.T) {
+	useTestJWTConfig(t)
+	config.Config.Lockout = config.LockoutConfig{FreeAttempts: 2, MaxAttempts: 4, Window: time.Hour, Duration: 15 * time.Minute}
+
+	hash, _ := utils.HashPassword("password-1")
+	for _, tt := range []struct {
+		name string
+		user *model.User
+	}{
+		{name: "existing account", user: &model.User{ID: "user-1", Email: "a@example.com", PasswordHash: hash}},
+		{name: "unknown email", user: nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			store := &fakeAuthStore{}
+			security := &fakeSecurityRepo{}
+			service := NewUserServiceImpl(UserServiceDeps{UserRepo: &fakeUserRepo{user: tt.user}, SessionRepo: &fakeSessionRepo{}, MFARepo: &fakeMFARepo{}, SecurityRepo: security, AuthStore: store})
+			account := loginAccountKey("a@example.com")
+
+			login := func(password string) (int, *httptest.ResponseRecorder) {
+				body := `{"email":" A@Example.com ","password":"` + password + `"}`
+				rec := httptest.NewRecorder()
+				status, _, _ := service.Login(rec, httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", bytes.NewBufferString(body)))
+				return status, rec
+			}
+
+			wantDelays := []time.Duration{0, 0, time.Second, 15 * time.Minute}
+			for i, want := range wantDelays {
+				// Let the progressive delay pass
+				delete(store.loginBlocks, account)
+				if status, _ := login("wrong"); status != http.StatusUnauthorized {
+					t.Fatalf("attempt %d: expected 401, got %d", i+1, status)
+				}
+				if got := store.loginBlocks[account]; got != want {
+					t.Fatalf("attempt %d: expected block of %v, got %v", i+1, want, got)
+				}
+			}
+
+			status, rec := login("password-1")
+			if status != http.StatusTooManyRequests || rec.Header().Get("Retry-After") != "900" {
+				t.Fatalf("expected lockout with Retry-After, got %d %q", status, rec.Header().Get("Retry-After"))
+			}
+			if len(security.events) != 1 || security.events[0].Type != model.SecurityEventLoginLockout ||
+				security.events[0].Subject != "a@example.com" || security.events[0].UserID.Valid != (tt.user != nil) {
+				t.Fatalf("expected one lockout event, got %+v", security.events)
+			}
+		})
+	}
+}
+
+func TestSuccessfulLoginClearsFailures(t *testing.T) {
+	useTestJWTConfig(t)
+
+	hash, _ := utils.HashPassword("password-1")
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Email: "a@example.com", PasswordHash: hash}}
+	store := &fakeAuthStore{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: &fakeSessionRepo{}, MFARepo: &fakeMFARepo{}, SecurityRepo: &fakeSecurityRepo{}, AuthStore: store})
+
+	for _, password := range []string{"wrong", "password-1"} {
+		body := `{"email":"a@example.com","password":"` + password + `"}`
+		service.Login(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", bytes.NewBufferString(body)))
+	}
+	if n := store.loginFailures[loginAccountKey("a@example.com")]; n != 0 {
+		t.Fatalf("expected failures to be cleared, got %d", n)
+	}
+}
+
+func TestLoginRehashesOutdatedPasswordHash(t *testing.T) {
+	useTestJWTConfig(t)
+
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("password-1"), bcrypt.MinCost)
+	users := &fakeUserRepo{user: &model.User{ID: "user-1", Email: "a@example.com", PasswordHash: string(legacy)}}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: &fakeSessionRepo{}, MFARepo: &fakeMFARepo{}, SecurityRepo: &fakeSecurityRepo{}, AuthStore: &fakeAuthStore{}})
+
+	body := `{"email":"a@example.com","password":"password-1"}`
+	status, _, err := service.Login(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", bytes.NewBufferString(body)))
+	if err != nil || status != http.StatusOK {
+		t.Fatalf("expected a bcrypt hash to still log in, got %d %v", status, err)
+	}
+	if !strings.HasPrefix(users.passwordHash, "$argon2id$") || !utils.ComparePassword(users.passwordHash, "password-1") {
+		t.Fatalf("expected the password to be rehashed with argon2id, got %q", users.passwordHash)
+	}
+}
+
+func TestCheckPasswordOnlyMatchesStoredHash(t *testing.T) {
+	current, _ := utils.HashPassword("password-1")
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("password-1"), bcrypt.MinCost)
+
+	for name, hash := range map[string]string{"current": current, "legacy": string(legacy)} {
+		if !checkPassword(hash, "password-1") || checkPassword(hash, "password-2") {
+			t.Fatalf("%s: expected only the right password to match", name)
+		}
+	}
+	// Password-less accounts and unknown emails never match, not even the
+	// password the dummies were made from
+	if checkPassword("", "not-a-real-password") {
+		t.Fatalf("expected an empty hash to never match")
+	}
+}
@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/mailer"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/logger"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/go-chi/chi"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	maxUserAgentLength  = 512
+	maxDeviceNameLength = 100
+
+	// deviceNameHeader lets clients name the device they log in from
+	// (e.g. "Alice's iPhone"); otherwise a name is derived from the UA.
+	deviceNameHeader = "X-Device-Name"
+)
+
+// GET -> active sessions (devices) of the current user
+func (s *UserServiceImpl) ListSessions(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+	currentID, _ := r.Context().Value(middleware.SessionIDKey).(string)
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	sessions, err := s.sessionRepo.ListSessions(ctx, userID)
+	if err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.ListSessions", err)
+	}
+
+	dtos := make([]model.SessionDTO, 0, len(sessions))
+	for _, session := range sessions {
+		dtos = append(dtos, model.SessionDTO{
+			ID:         session.ID,
+			DeviceName: session.DeviceName,
+			UserAgent:  session.UserAgent,
+			IP:         session.IP,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == currentID,
+		})
+	}
+
+	responseData := map[string]any{
+		"sessions": dtos,
+	}
+	return http.StatusOK, utils.SuccessResponse(responseData), nil
+}
+
+// DELETE -> logs out one device. Revoking the current session works like
+// Logout.
+func (s *UserServiceImpl) RevokeSession(w http.ResponseWriter, r *http.Request) (int, *utils.APIResponse, error) {
+	userID, ok := r.Context().Value(middleware.UserIDKey).(string)
+	if !ok || userID == "" {
+		return http.StatusUnauthorized, nil, errs.ErrUnauthorized
+	}
+
+	sessionID := chi.URLParam(r, "id")
+	if _, err := uuid.Parse(sessionID); err != nil {
+		return http.StatusNotFound, nil, errs.ErrNotFound
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := s.sessionRepo.RevokeSession(ctx, sessionID, userID); err != nil {
+		if errs.Is(err, errs.ErrNotFound) {
+			return http.StatusNotFound, nil, errs.ErrNotFound
+		}
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.RevokeSession", err)
+	}
+	if err := s.revokeSessions(ctx, []string{sessionID}); err != nil {
+		return http.StatusInternalServerError, nil, errs.Wrap("service.UserService.RevokeSession", err)
+	}
+
+	return http.StatusOK, nil, nil
+}
+
+// notifyNewDevice tells the user about a login from a device they have not
+// used before, by email and on their open connections. Failures are logged;
+// they must not fail the login.
+func (s *UserServiceImpl) notifyNewDevice(ctx context.Context, user *model.User, session *model.Session) {
+	if s.publisher != nil {
+		s.publisher.Publish("new_device_login", "", map[string]any{
+			"session_id":  session.ID,
+			"device_name": session.DeviceName,
+			"ip":          session.IP,
+			"created_at":  session.CreatedAt,
+		}, user.ID)
+	}
+
+	if s.mailer == nil {
+		return
+	}
+	body := fmt.Sprintf("Hi %s,\n\nYour account was just signed in to from a new device:\n\n"+
+		"Device: %s\nIP address: %s\nTime: %s\n\n"+
+		"If this was not you, sign out that device under Sessions and change your password.\n",
+		user.Username, session.DeviceName, session.IP, session.CreatedAt.Format(time.RFC1123))
+
+	msg := mailer.Message{To: user.Email, Subject: "New sign-in to your account", Body: body}
+	if err := s.mailer.Send(ctx, msg); err != nil {
+		logger.L().Warn("failed to send new device email", zap.String("user_id", user.ID), zap.Error(err))
+	}
+}
+
+func clientUserAgent(r *http.Request) string {
+	return utils.Truncate(strings.TrimSpace(r.UserAgent()), maxUserAgentLength)
+}
+
+// deviceName is the client supplied name, or a readable one derived from
+// the user agent ("Firefox on Linux").
+func deviceName(r *http.Request, userAgent string) string {
+	if name := utils.Truncate(strings.TrimSpace(r.Header.Get(deviceNameHeader)), maxDeviceNameLength); name != "" {
+		return name
+	}
+	return deviceNameFromUserAgent(userAgent)
+}
+
+func deviceNameFromUserAgent(ua string) string {
+	if ua == "" {
+		return "Unknown device"
+	}
+
+	// Order matters: Edge and Opera also claim Chrome, Chrome also claims Safari
+	browser := ""
+	for _, b := range []struct{ token, name string }{
+		{"Edg/", "Edge"},
+		{"OPR/", "Opera"},
+		{"Firefox/", "Firefox"},
+		{"Chrome/", "Chrome"},
+		{"Safari/", "Safari"},
+	} {
+		if strings.Contains(ua, b.token) {
+			browser = b.name
+			break
+		}
+	}
+
+	os := ""
+	for _, o := range []struct{ token, name string }{
+		{"iPhone", "iOS"},
+		{"iPad", "iPadOS"},
+		{"Android", "Android"},
+		{"Windows", "Windows"},
+		{"Mac OS X", "macOS"},
+		{"CrOS", "ChromeOS"},
+		{"Linux", "Linux"},
+	} {
+		if strings.Contains(ua, o.token) {
+			os = o.name
+			break
+		}
+	}
+
+	switch {
+	case browser != "" && os != "":
+		return browser + " on " + os
+	case browser != "":
+		return browser
+	case os != "":
+		return os
+	}
+	// API clients and bots: the product token ("curl/8.5.0" -> "curl")
+	product, _, _ := strings.Cut(ua, " ")
+	product, _, _ = strings.Cut(product, "/")
+	return utils.Truncate(product, maxDeviceNameLength)
+}
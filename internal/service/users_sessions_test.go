@@ -0,0 +1,138 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/mailer"
+	"github.com/ak-repo/go-chat-system/internal/shared/errs"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/go-chi/chi"
+)
+
+type fakeMailer struct {
+	sent []mailer.Message
+}
+
+func (f *fakeMailer) Send(_ context.Context, msg mailer.Message) error {
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+const firefoxUA = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+
+func TestLoginRecordsDeviceAndNotifiesNewDevices(t *testing.T) {
+	useTestJWTConfig(t)
+
+	hash, _ := utils.HashPassword("password-1")
+	for _, newDevice := range []bool{false, true} {
+		users := &fakeUserRepo{user: &model.User{ID: "user-1", Username: "alice", Email: "a@example.com", PasswordHash: hash}}
+		sessions := &fakeSessionRepo{newDevice: newDevice}
+		mail := &fakeMailer{}
+		publisher := &fakePublisher{}
+		service := NewUserServiceImpl(UserServiceDeps{UserRepo: users, SessionRepo: sessions, MFARepo: &fakeMFARepo{}, SecurityRepo: &fakeSecurityRepo{}, AuthStore: &fakeAuthStore{}, Mailer: mail, Publisher: publisher})
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login",
+			bytes.NewBufferString(`{"email":"a@example.com","password":"password-1"}`))
+		req.Header.Set("User-Agent", firefoxUA)
+		req.RemoteAddr = "203.0.113.7:51234"
+		if status, _, err := service.Login(httptest.NewRecorder(), req); err != nil || status != http.StatusOK {
+			t.Fatalf("expected login, got %d %v", status, err)
+		}
+
+		session := sessions.createdRecord
+		if session == nil || session.UserAgent != firefoxUA || session.IP != "203.0.113.7" || session.DeviceName != "Firefox on Linux" {
+			t.Fatalf("expected client details on the session, got %#v", session)
+		}
+
+		if !newDevice {
+			if len(mail.sent) != 0 || publisher.event != "" {
+				t.Fatalf("expected no notification for a known device")
+			}
+			continue
+		}
+		if len(mail.sent) != 1 || mail.sent[0].To != "a@example.com" || !strings.Contains(mail.sent[0].Body, "Firefox on Linux") {
+			t.Fatalf("expected a new device email, got %#v", mail.sent)
+		}
+		if publisher.event != "new_device_login" || len(publisher.userIDs) != 1 || publisher.userIDs[0] != "user-1" {
+			t.Fatalf("expected a new device event for the user, got %#v", publisher)
+		}
+	}
+}
+
+func TestRevokeSessionOnlyRevokesOwnSessions(t *testing.T) {
+	sessions := &fakeSessionRepo{sessions: []model.Session{
+		{ID: "11111111-1111-1111-1111-111111111111", UserID: "user-1"},
+		{ID: "22222222-2222-2222-2222-222222222222", UserID: "user-2"},
+	}}
+	store := &fakeAuthStore{}
+	service := NewUserServiceImpl(UserServiceDeps{UserRepo: &fakeUserRepo{}, SessionRepo: sessions, AuthStore: store})
+
+	revoke := func(id string) (int, error) {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/sessions/"+id, nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("id", id)
+		ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+		ctx = context.WithValue(ctx, middleware.UserIDKey, "user-1")
+		status, _, err := service.RevokeSession(httptest.NewRecorder(), req.WithContext(ctx))
+		return status, err
+	}
+
+	if status, err := revoke("22222222-2222-2222-2222-222222222222"); status != http.StatusNotFound || !errors.Is(err, errs.ErrNotFound) {
+		t.Fatalf("expected another user's session to be not found, got %d %v", status, err)
+	}
+	if len(store.revokedSessions) != 0 {
+		t.Fatalf("expected nothing denylisted, got %v", store.revokedSessions)
+	}
+
+	if status, err := revoke("11111111-1111-1111-1111-111111111111"); status != http.StatusOK || err != nil {
+		t.Fatalf("expected own session to be revoked, got %d %v", status, err)
+	}
+	if sessions.revokedID != "11111111-1111-1111-1111-111111111111" ||
+		len(store.revokedSessions) != 1 || store.revokedSessions[0] != sessions.revokedID {
+		t.Fatalf("expected the session to be revoked and denylisted, got %q %v", sessions.revokedID, store.revokedSessions)
+	}
+}
+
+func TestDeviceNameFromUserAgent(t *testing.T) {
+	for ua, want := range map[string]string{
+		"":        "Unknown device",
+		firefoxUA: "Firefox on Linux",
+		"Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36 Edg/126.0.0.0":           "Edge on Windows",
+		"Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1": "Safari on iOS",
+		"curl/8.5.0": "curl",
+	} {
+		if got := deviceNameFromUserAgent(ua); got != want {
+			t.Errorf("deviceNameFromUserAgent(%q) = %q, want %q", ua, got, want)
+		}
+	}
+}
+
+func TestDeviceNameAndUserAgentAreCutOnCharacters(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/auth/login", nil)
+	req.Header.Set("User-Agent", strings.Repeat("é", maxUserAgentLength))
+	req.Header.Set(deviceNameHeader, "\xff"+strings.Repeat("ü", maxDeviceNameLength+1))
+
+	ua := clientUserAgent(req)
+	if !utf8.ValidString(ua) || utf8.RuneCountInString(ua) != maxUserAgentLength {
+		t.Fatalf("expected %d whole characters, got %q", maxUserAgentLength, ua)
+	}
+	name := deviceName(req, ua)
+	if name != strings.Repeat("ü", maxDeviceNameLength) {
+		t.Fatalf("expected a valid name of %d characters, got %q", maxDeviceNameLength, name)
+	}
+
+	// Without a name header the product token of the user agent is used
+	product := deviceNameFromUserAgent(strings.Repeat("端末", maxDeviceNameLength))
+	if !utf8.ValidString(product) || utf8.RuneCountInString(product) != maxDeviceNameLength {
+		t.Fatalf("expected %d whole characters, got %q", maxDeviceNameLength, product)
+	}
+}
@@ -28,6 +28,38 @@ var (
 	ErrAlreadyFriends      = errors.New("users are already friends")
 	ErrBlockedRelationship = errors.New("one of the users has blocked the other")
 	ErrBlockNotFound       = errors.New("block relationship not found")
+	ErrRequestsNotAllowed  = errors.New("user is not accepting friend requests")
+	ErrRequestCooldown     = errors.New("user rejected a recent friend request")
+	ErrRequestLimit        = errors.New("daily friend request limit reached")
+)
+
+// Auth module errors
+var (
+	ErrRefreshTokenReused = errors.New("refresh token reuse detected")
+	ErrEmailNotVerified   = errors.New("email address not verified")
+	ErrInvalidCode        = errors.New("invalid or expired code")
+	ErrInvalidPassword    = errors.New("current password is incorrect")
+	ErrPasswordSet        = errors.New("account has a password")
+	ErrMFANotEnabled      = errors.New("two-factor authentication is not enabled")
+	ErrMFAAlreadyEnabled  = errors.New("two-factor authentication is already enabled")
+	ErrTooManyAttempts    = errors.New("too many failed attempts")
+	ErrSSOFailed          = errors.New("single sign-on failed")
+	ErrSSONoAccount       = errors.New("no account is linked to this identity")
+	ErrSSOLinkRequired    = errors.New("an account with this email already exists")
+	ErrRegistrationClosed = errors.New("registration is closed")
+	ErrInviteRequired     = errors.New("an invite code is required")
+	ErrInvalidInvite      = errors.New("invite code is invalid or has expired")
+	ErrTooManyInvites     = errors.New("too many active invite codes")
+)
+
+// User module errors
+var (
+	ErrInvalidHandle  = errors.New("handle must be 3-30 letters, digits or underscores")
+	ErrHandleTaken    = errors.New("handle is already taken")
+	ErrHandleCooldown = errors.New("handle was changed too recently")
+
+	ErrExportInProgress = errors.New("a data export is already in progress")
+	ErrExportTooSoon    = errors.New("a data export was requested too recently")
 )
 
 //
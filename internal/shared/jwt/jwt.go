@@ -6,36 +6,53 @@ import (
 
 	"github.com/ak-repo/go-chat-system/internal/platform/config"
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+const defaultRefreshExpiry = 7 * 24 * time.Hour
+
+// Token types. Both kinds are signed with the same keys, so the typ claim
+// keeps a refresh token from passing as an access token and back.
+const (
+	TokenTypeAccess  = "access"
+	TokenTypeRefresh = "refresh"
 )
 
 type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	SessionID string `json:"sid"`
+	TokenType string `json:"typ"`
 	jwt.RegisteredClaims
 }
 
 type RefreshClaims struct {
-	UserID string `json:"user_id"`
+	UserID    string `json:"user_id"`
+	SessionID string `json:"sid"`
+	TokenType string `json:"typ"`
 	jwt.RegisteredClaims
 }
 
-// GenerateAccessToken creates a new JWT access token
-func GenerateToken(userID, email, role string) (string, time.Time, error) {
+// GenerateAccessToken creates a new JWT access token for a session.
+// The jti lets a single token be denylisted before it expires.
+func GenerateToken(userID, email, role, sessionID string) (string, time.Time, error) {
 	expirationTime := time.Now().Add(config.Config.JWT.Expiry)
 	claims := &Claims{
-		UserID: userID,
-		Email:  email,
-		Role:   role,
+		UserID:    userID,
+		Email:     email,
+		Role:      role,
+		SessionID: sessionID,
+		TokenType: TokenTypeAccess,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    config.Config.JWT.Issuer,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.Config.JWT.Secret))
+	tokenString, err := sign(claims)
 	if err != nil {
 		return "", time.Time{}, err
 	}
@@ -43,25 +60,28 @@ func GenerateToken(userID, email, role string) (string, time.Time, error) {
 	return tokenString, expirationTime, nil
 }
 
-// GenerateRefreshToken creates a new JWT refresh token
-func GenerateRefreshToken(userID string) (string, time.Time, error) {
+// GenerateRefreshToken creates a new JWT refresh token bound to a session.
+// Every token gets a unique jti so its hash can be tracked server-side.
+func GenerateRefreshToken(userID, sessionID string) (string, time.Time, error) {
 	refreshExpiry := config.Config.JWT.RefreshExpiry
 	if refreshExpiry <= 0 {
-		refreshExpiry = 7 * 24 * time.Hour // default 7 days
+		refreshExpiry = defaultRefreshExpiry
 	}
 	expirationTime := time.Now().Add(refreshExpiry)
 
 	claims := &RefreshClaims{
-		UserID: userID,
+		UserID:    userID,
+		SessionID: sessionID,
+		TokenType: TokenTypeRefresh,
 		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
 			ExpiresAt: jwt.NewNumericDate(expirationTime),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 			Issuer:    config.Config.JWT.Issuer,
 		},
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.Config.JWT.Secret))
+	tokenString, err := sign(claims)
 	if err != nil {
 		return "", time.Time{}, err
 	}
@@ -69,14 +89,56 @@ func GenerateRefreshToken(userID string) (string, time.Time, error) {
 	return tokenString, expirationTime, nil
 }
 
-func ValidateToken(tokenString string) (*Claims, error) {
-	claims := &Claims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if token.Method != jwt.SigningMethodHS256 {
+// sign uses the current asymmetric key when one is loaded, else the secret.
+func sign(claims jwt.Claims) (string, error) {
+	kr := ring
+	if kr == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(config.Config.JWT.Secret))
+	}
+
+	key := kr.current()
+	if key == nil {
+		return "", fmt.Errorf("no jwt signing key loaded")
+	}
+	token := jwt.NewWithClaims(kr.method, claims)
+	token.Header["kid"] = key.id
+	return token.SignedString(key.private)
+}
+
+// verificationKey picks the key for a token by its alg and kid. Once
+// asymmetric keys are loaded, HS256 tokens are only accepted until
+// jwt.legacy_hs256_until, so sessions can survive the switch without the
+// shared secret staying good for forging tokens.
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	kr := ring
+	if token.Method == jwt.SigningMethodHS256 {
+		if config.Config.JWT.Secret == "" || (kr != nil && !legacyHS256Accepted(time.Now())) {
 			return nil, fmt.Errorf("unexpected signing method")
 		}
 		return []byte(config.Config.JWT.Secret), nil
-	})
+	}
+
+	if kr == nil || token.Method != kr.method {
+		return nil, fmt.Errorf("unexpected signing method")
+	}
+	kid, _ := token.Header["kid"].(string)
+	key := kr.lookup(kid)
+	if key == nil {
+		return nil, fmt.Errorf("unknown signing key")
+	}
+	return key.private.Public(), nil
+}
+
+// legacyHS256Accepted reports whether the HS256 migration window is still
+// open at now.
+func legacyHS256Accepted(now time.Time) bool {
+	until, err := time.Parse(time.RFC3339, config.Config.JWT.LegacyHS256Until)
+	return err == nil && now.Before(until)
+}
+
+func ValidateToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey)
 
 	if err != nil {
 		return nil, err
@@ -85,6 +147,9 @@ func ValidateToken(tokenString string) (*Claims, error) {
 	if !token.Valid {
 		return nil, fmt.Errorf("token invalid")
 	}
+	if claims.TokenType != TokenTypeAccess {
+		return nil, fmt.Errorf("not an access token")
+	}
 
 	// Validate issuer if configured
 	if config.Config.JWT.Issuer != "" && claims.Issuer != config.Config.JWT.Issuer {
@@ -96,12 +161,7 @@ func ValidateToken(tokenString string) (*Claims, error) {
 
 func ValidateRefreshToken(tokenString string) (*RefreshClaims, error) {
 	claims := &RefreshClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if token.Method != jwt.SigningMethodHS256 {
-			return nil, fmt.Errorf("unexpected signing method")
-		}
-		return []byte(config.Config.JWT.Secret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey)
 
 	if err != nil {
 		return nil, err
@@ -110,6 +170,9 @@ func ValidateRefreshToken(tokenString string) (*RefreshClaims, error) {
 	if !token.Valid {
 		return nil, fmt.Errorf("refresh token invalid")
 	}
+	if claims.TokenType != TokenTypeRefresh {
+		return nil, fmt.Errorf("not a refresh token")
+	}
 
 	// Validate issuer if configured
 	if config.Config.JWT.Issuer != "" && claims.Issuer != config.Config.JWT.Issuer {
@@ -18,7 +18,7 @@ func TestGenerateAndValidateRefreshTokenUsesConfiguredIssuer(t *testing.T) {
 		RefreshExpiry: 2 * time.Hour,
 	}
 
-	token, _, err := GenerateRefreshToken("user-123")
+	token, _, err := GenerateRefreshToken("user-123", "session-1")
 	if err != nil {
 		t.Fatalf("GenerateRefreshToken failed: %v", err)
 	}
@@ -30,7 +30,39 @@ func TestGenerateAndValidateRefreshTokenUsesConfiguredIssuer(t *testing.T) {
 	if claims.UserID != "user-123" {
 		t.Fatalf("expected user-123, got %q", claims.UserID)
 	}
+	if claims.SessionID != "session-1" {
+		t.Fatalf("expected session-1, got %q", claims.SessionID)
+	}
+	if claims.ID == "" {
+		t.Fatalf("expected jti to be set")
+	}
 	if claims.Issuer != "system" {
 		t.Fatalf("expected issuer system, got %q", claims.Issuer)
 	}
 }
+
+func TestAccessAndRefreshTokensAreNotInterchangeable(t *testing.T) {
+	oldConfig := config.Config
+	defer func() { config.Config = oldConfig }()
+
+	config.Config.JWT = config.JWTConfig{Secret: "test-secret", Expiry: time.Hour, Issuer: "system"}
+
+	access, _, err := GenerateToken("user-123", "a@example.com", "user", "session-1")
+	if err != nil {
+		t.Fatalf("GenerateToken failed: %v", err)
+	}
+	refresh, _, err := GenerateRefreshToken("user-123", "session-1")
+	if err != nil {
+		t.Fatalf("GenerateRefreshToken failed: %v", err)
+	}
+
+	if claims, err := ValidateToken(access); err != nil || claims.TokenType != TokenTypeAccess {
+		t.Fatalf("expected access token to validate, got %+v %v", claims, err)
+	}
+	if _, err := ValidateToken(refresh); err == nil {
+		t.Fatalf("expected refresh token to be rejected as access token")
+	}
+	if _, err := ValidateRefreshToken(access); err == nil {
+		t.Fatalf("expected access token to be rejected as refresh token")
+	}
+}
@@ -0,0 +1,306 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const rsaKeyBits = 2048
+
+// signingKey is one private key from the key directory. Its file name
+// (without .pem) is the kid.
+type signingKey struct {
+	id        string
+	private   crypto.Signer
+	createdAt time.Time
+}
+
+// keyring holds the asymmetric keys. The newest key signs; every loaded key
+// verifies, so tokens stay valid across a rotation until they expire.
+type keyring struct {
+	mu     sync.RWMutex
+	method jwt.SigningMethod
+	dir    string
+	keys   []*signingKey // oldest first
+}
+
+// ring is nil while tokens are signed with the HS256 secret.
+var ring *keyring
+
+// LoadKeys switches signing to alg (RS256 or EdDSA) with the PEM keys in dir.
+// A first key is generated if the directory holds none. HS256 (or "") keeps
+// the shared secret and loads nothing.
+func LoadKeys(alg, dir string) error {
+	var method jwt.SigningMethod
+	switch strings.ToUpper(alg) {
+	case "", "HS256":
+		ring = nil
+		return nil
+	case "RS256":
+		method = jwt.SigningMethodRS256
+	case "EDDSA":
+		method = jwt.SigningMethodEdDSA
+	default:
+		return fmt.Errorf("unsupported jwt algorithm %q", alg)
+	}
+	if dir == "" {
+		return errors.New("jwt keys_dir is required for " + alg)
+	}
+	if until := config.Config.JWT.LegacyHS256Until; until != "" {
+		if _, err := time.Parse(time.RFC3339, until); err != nil {
+			return fmt.Errorf("invalid jwt legacy_hs256_until: %w", err)
+		}
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	kr := &keyring{method: method, dir: dir}
+	if err := kr.reload(); err != nil {
+		return err
+	}
+	if len(kr.keys) == 0 {
+		if err := kr.generate(); err != nil {
+			return err
+		}
+	}
+	ring = kr
+	return nil
+}
+
+// RotateKeys picks up keys written by other instances, adds a new signing key
+// once the current one is older than interval, and deletes keys that were
+// replaced more than retain ago (no token they signed can still be valid).
+func RotateKeys(interval, retain time.Duration) error {
+	kr := ring
+	if kr == nil {
+		return nil
+	}
+	if err := kr.reload(); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if current := kr.current(); current == nil || interval > 0 && now.Sub(current.createdAt) >= interval {
+		if err := kr.generate(); err != nil {
+			return err
+		}
+	}
+	return kr.prune(now.Add(-retain))
+}
+
+// reload reads every *.pem file in the key directory.
+func (kr *keyring) reload() error {
+	paths, err := filepath.Glob(filepath.Join(kr.dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+
+	keys := make([]*signingKey, 0, len(paths))
+	for _, path := range paths {
+		key, err := readKey(path)
+		if err != nil {
+			return fmt.Errorf("jwt key %s: %w", filepath.Base(path), err)
+		}
+		if !kr.accepts(key.private) {
+			return fmt.Errorf("jwt key %s does not match %s", filepath.Base(path), kr.method.Alg())
+		}
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].createdAt.Before(keys[j].createdAt) })
+
+	kr.mu.Lock()
+	kr.keys = keys
+	kr.mu.Unlock()
+	return nil
+}
+
+func (kr *keyring) accepts(key crypto.Signer) bool {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return kr.method == jwt.SigningMethodRS256
+	case ed25519.PrivateKey:
+		return kr.method == jwt.SigningMethodEdDSA
+	}
+	return false
+}
+
+// generate writes a new key and makes it the signing key.
+func (kr *keyring) generate() error {
+	var private crypto.Signer
+	var err error
+	if kr.method == jwt.SigningMethodRS256 {
+		private, err = rsa.GenerateKey(rand.Reader, rsaKeyBits)
+	} else {
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return err
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return err
+	}
+	id, err := keyID(private.Public())
+	if err != nil {
+		return err
+	}
+
+	// Write then rename, so other instances never read a half-written key
+	path := filepath.Join(kr.dir, id+".pem")
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+
+	kr.mu.Lock()
+	kr.keys = append(kr.keys, &signingKey{id: id, private: private, createdAt: time.Now()})
+	kr.mu.Unlock()
+	return nil
+}
+
+// prune removes keys whose successor was created before cutoff.
+func (kr *keyring) prune(cutoff time.Time) error {
+	kr.mu.Lock()
+	defer kr.mu.Unlock()
+
+	keep := kr.keys[:0]
+	for i, key := range kr.keys {
+		if i < len(kr.keys)-1 && kr.keys[i+1].createdAt.Before(cutoff) {
+			if err := os.Remove(filepath.Join(kr.dir, key.id+".pem")); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+			continue
+		}
+		keep = append(keep, key)
+	}
+	kr.keys = keep
+	return nil
+}
+
+func (kr *keyring) current() *signingKey {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	if len(kr.keys) == 0 {
+		return nil
+	}
+	return kr.keys[len(kr.keys)-1]
+}
+
+func (kr *keyring) lookup(id string) *signingKey {
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	for _, key := range kr.keys {
+		if key.id == id {
+			return key
+		}
+	}
+	return nil
+}
+
+func readKey(path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("expected a PKCS#8 PEM private key")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	private, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported key type")
+	}
+
+	return &signingKey{
+		id:        strings.TrimSuffix(filepath.Base(path), ".pem"),
+		private:   private,
+		createdAt: info.ModTime(),
+	}, nil
+}
+
+// keyID derives a stable kid from the public key.
+func keyID(public crypto.PublicKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(public)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:8]), nil
+}
+
+// JWK is the public half of a signing key (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// PublicKeys returns every verification key. It is empty while HS256 is used,
+// since a shared secret cannot be published.
+func PublicKeys() JWKS {
+	set := JWKS{Keys: []JWK{}}
+	kr := ring
+	if kr == nil {
+		return set
+	}
+
+	kr.mu.RLock()
+	defer kr.mu.RUnlock()
+	for _, key := range kr.keys {
+		jwk := JWK{Use: "sig", Alg: kr.method.Alg(), Kid: key.id}
+		switch pub := key.private.Public().(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
@@ -0,0 +1,132 @@
+package jwt
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func useTestKeys(t *testing.T, alg string) string {
+	t.Helper()
+	oldConfig, oldRing := config.Config, ring
+	t.Cleanup(func() { config.Config, ring = oldConfig, oldRing })
+
+	config.Config.JWT = config.JWTConfig{Expiry: time.Hour, Issuer: "system", Algorithm: alg}
+	dir := t.TempDir()
+	if err := LoadKeys(alg, dir); err != nil {
+		t.Fatalf("LoadKeys failed: %v", err)
+	}
+	return dir
+}
+
+func TestAsymmetricTokensSurviveKeyRotation(t *testing.T) {
+	for _, alg := range []string{"RS256", "EdDSA"} {
+		t.Run(alg, func(t *testing.T) {
+			dir := useTestKeys(t, alg)
+
+			oldToken, _, err := GenerateToken("user-1", "a@example.com", "user", "session-1")
+			if err != nil {
+				t.Fatalf("GenerateToken failed: %v", err)
+			}
+			header, _, _ := new(jwt.Parser).ParseUnverified(oldToken, &Claims{})
+			if header.Method.Alg() != alg || header.Header["kid"] == "" {
+				t.Fatalf("expected %s token with kid, got %v", alg, header.Header)
+			}
+
+			if err := RotateKeys(time.Nanosecond, time.Hour); err != nil {
+				t.Fatalf("RotateKeys failed: %v", err)
+			}
+			newToken, _, _ := GenerateToken("user-1", "a@example.com", "user", "session-1")
+			newHeader, _, _ := new(jwt.Parser).ParseUnverified(newToken, &Claims{})
+			if newHeader.Header["kid"] == header.Header["kid"] {
+				t.Fatalf("expected a new kid after rotation")
+			}
+
+			for _, token := range []string{oldToken, newToken} {
+				if _, err := ValidateToken(token); err != nil {
+					t.Fatalf("ValidateToken failed: %v", err)
+				}
+			}
+			if keys := PublicKeys().Keys; len(keys) != 2 || keys[0].Alg != alg {
+				t.Fatalf("expected both keys in the JWKS, got %+v", keys)
+			}
+
+			// Once the replaced key is older than the retention it is dropped
+			if err := RotateKeys(time.Hour, -time.Hour); err != nil {
+				t.Fatalf("RotateKeys failed: %v", err)
+			}
+			if _, err := ValidateToken(oldToken); err == nil {
+				t.Fatalf("expected token of a pruned key to be rejected")
+			}
+			if files, _ := filepath.Glob(filepath.Join(dir, "*.pem")); len(files) != 1 {
+				t.Fatalf("expected one key file left, got %v", files)
+			}
+		})
+	}
+}
+
+func TestValidateTokenRejectsUnknownKeyAndHS256WithoutSecret(t *testing.T) {
+	useTestKeys(t, "EdDSA")
+	token, _, _ := GenerateToken("user-1", "a@example.com", "user", "session-1")
+
+	// A key from another directory (e.g. another deployment) is not trusted
+	if err := LoadKeys("EdDSA", t.TempDir()); err != nil {
+		t.Fatalf("LoadKeys failed: %v", err)
+	}
+	if _, err := ValidateToken(token); err == nil || !strings.Contains(err.Error(), "unknown signing key") {
+		t.Fatalf("expected unknown key error, got %v", err)
+	}
+
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{UserID: "user-1"}).SignedString([]byte(""))
+	if _, err := ValidateToken(forged); err == nil {
+		t.Fatalf("expected HS256 token to be rejected without a secret")
+	}
+}
+
+func TestHS256TokensRejectedAfterSwitchUnlessInMigrationWindow(t *testing.T) {
+	useTestKeys(t, "RS256")
+	config.Config.JWT.Secret = "super-secret"
+
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		UserID:           "user-1",
+		Role:             "admin",
+		TokenType:        TokenTypeAccess,
+		RegisteredClaims: jwt.RegisteredClaims{Issuer: "system", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))},
+	}).SignedString([]byte("super-secret"))
+	if _, err := ValidateToken(forged); err == nil {
+		t.Fatalf("expected HS256 token to be rejected once keys are loaded")
+	}
+
+	config.Config.JWT.LegacyHS256Until = time.Now().Add(time.Hour).Format(time.RFC3339)
+	if _, err := ValidateToken(forged); err != nil {
+		t.Fatalf("expected HS256 token to be accepted during the migration window, got %v", err)
+	}
+
+	config.Config.JWT.LegacyHS256Until = time.Now().Add(-time.Minute).Format(time.RFC3339)
+	if _, err := ValidateToken(forged); err == nil {
+		t.Fatalf("expected HS256 token to be rejected after the migration window")
+	}
+
+	config.Config.JWT.LegacyHS256Until = "tomorrow"
+	if err := LoadKeys("RS256", t.TempDir()); err == nil {
+		t.Fatalf("expected an invalid cutoff to be rejected")
+	}
+}
+
+func TestLoadKeysRejectsMismatchedKeyFiles(t *testing.T) {
+	dir := useTestKeys(t, "RS256")
+	if err := LoadKeys("EdDSA", dir); err == nil {
+		t.Fatalf("expected RSA key to be rejected for EdDSA")
+	}
+	if err := os.WriteFile(filepath.Join(dir, "broken.pem"), []byte("nope"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadKeys("RS256", dir); err == nil {
+		t.Fatalf("expected unreadable key file to fail loading")
+	}
+}
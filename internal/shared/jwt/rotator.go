@@ -0,0 +1,53 @@
+package jwt
+
+import (
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+	"github.com/ak-repo/go-chat-system/internal/shared/logger"
+	"go.uber.org/zap"
+)
+
+// keyCheckInterval is how often the key directory is re-read, so keys
+// rotated by another instance are trusted within a minute.
+const keyCheckInterval = time.Minute
+
+// KeyRotator adds a new signing key every interval and drops keys once no
+// token they signed can still be valid.
+type KeyRotator struct {
+	interval time.Duration
+	quit     chan struct{}
+}
+
+func NewKeyRotator(interval time.Duration) *KeyRotator {
+	return &KeyRotator{
+		interval: interval,
+		quit:     make(chan struct{}),
+	}
+}
+
+func (k *KeyRotator) Run() {
+	ticker := time.NewTicker(keyCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-k.quit:
+			return
+		case <-ticker.C:
+		}
+
+		refreshExpiry := config.Config.JWT.RefreshExpiry
+		if refreshExpiry <= 0 {
+			refreshExpiry = defaultRefreshExpiry
+		}
+		retain := max(config.Config.JWT.Expiry, refreshExpiry)
+		if err := RotateKeys(k.interval, retain); err != nil {
+			logger.L().Error("jwt key rotation failed", zap.Error(err))
+		}
+	}
+}
+
+func (k *KeyRotator) Stop() {
+	close(k.quit)
+}
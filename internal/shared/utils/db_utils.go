@@ -1,12 +1,22 @@
 package utils
 
-import "github.com/jackc/pgconn"
+import (
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
 
 func IsUniqueViolation(err error) bool {
 	if err == nil {
 		return false
 	}
 
-	pgErr, ok := err.(*pgconn.PgError)
-	return ok && pgErr.Code == "23505"
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// IsUniqueViolationOn is IsUniqueViolation limited to one constraint or index.
+func IsUniqueViolationOn(err error, constraint string) bool {
+	var pgErr *pgconn.PgError
+	return IsUniqueViolation(err) && errors.As(err, &pgErr) && pgErr.ConstraintName == constraint
 }
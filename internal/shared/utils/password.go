@@ -1,15 +1,219 @@
 package utils
 
-import "golang.org/x/crypto/bcrypt"
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+	"sync"
 
-// HashPassword generates a bcrypt hash from a plain text password
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hashing algorithms (password.algorithm)
+const (
+	PasswordArgon2id = "argon2id"
+	PasswordBcrypt   = "bcrypt"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// PasswordParams selects how new password hashes are made. Hashes made with
+// other algorithms or parameters keep verifying; PasswordNeedsRehash tells
+// when one should be replaced.
+type PasswordParams struct {
+	Algorithm         string
+	Argon2Memory      uint32 // KiB
+	Argon2Iterations  uint32
+	Argon2Parallelism uint8
+	BcryptCost        int
+}
+
+// DefaultPasswordParams follow the OWASP recommendation for Argon2id.
+var DefaultPasswordParams = PasswordParams{
+	Algorithm:         PasswordArgon2id,
+	Argon2Memory:      19 * 1024,
+	Argon2Iterations:  2,
+	Argon2Parallelism: 1,
+	BcryptCost:        bcrypt.DefaultCost,
+}
+
+var (
+	passwordMu     sync.RWMutex
+	passwordParams = DefaultPasswordParams
+)
+
+// SetPasswordParams changes the parameters of new hashes. Zero values fall
+// back to DefaultPasswordParams.
+func SetPasswordParams(p PasswordParams) error {
+	if p.Algorithm == "" {
+		p.Algorithm = DefaultPasswordParams.Algorithm
+	}
+	if p.Argon2Memory == 0 {
+		p.Argon2Memory = DefaultPasswordParams.Argon2Memory
+	}
+	if p.Argon2Iterations == 0 {
+		p.Argon2Iterations = DefaultPasswordParams.Argon2Iterations
+	}
+	if p.Argon2Parallelism == 0 {
+		p.Argon2Parallelism = DefaultPasswordParams.Argon2Parallelism
+	}
+	if p.BcryptCost == 0 {
+		p.BcryptCost = DefaultPasswordParams.BcryptCost
+	}
+
+	switch p.Algorithm {
+	case PasswordArgon2id:
+		if p.Argon2Memory < 8*uint32(p.Argon2Parallelism) {
+			return fmt.Errorf("argon2 memory must be at least 8 KiB per lane")
+		}
+	case PasswordBcrypt:
+		if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return fmt.Errorf("unknown password algorithm %q", p.Algorithm)
+	}
+
+	passwordMu.Lock()
+	passwordParams = p
+	passwordMu.Unlock()
+	return nil
+}
+
+func currentPasswordParams() PasswordParams {
+	passwordMu.RLock()
+	defer passwordMu.RUnlock()
+	return passwordParams
+}
+
+// HashPassword hashes a plain text password with the configured algorithm.
+// Argon2id hashes use the PHC string format
+// ($argon2id$v=19$m=...,t=...,p=...$salt$key), bcrypt hashes their own.
 func HashPassword(password string) (string, error) {
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	return string(hashed), err
+	return hashPassword(currentPasswordParams(), password)
+}
+
+// HashPasswordWith hashes like HashPassword but with the given algorithm
+// instead of the configured one, keeping the configured parameters.
+func HashPasswordWith(algorithm, password string) (string, error) {
+	p := currentPasswordParams()
+	p.Algorithm = algorithm
+	return hashPassword(p, password)
 }
 
-// ComparePassword compares plain password with hashed password
+func hashPassword(p PasswordParams, password string) (string, error) {
+	if p.Algorithm == PasswordBcrypt {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), p.BcryptCost)
+		return string(hashed), err
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, p.Argon2Iterations, p.Argon2Memory, p.Argon2Parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, p.Argon2Memory, p.Argon2Iterations, p.Argon2Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// ComparePassword compares plain password with hashed password, whichever
+// supported algorithm made the hash.
 func ComparePassword(hashedPwd, plainPwd string) bool {
-	err := bcrypt.CompareHashAndPassword([]byte(hashedPwd), []byte(plainPwd))
-	return err == nil
+	if !strings.HasPrefix(hashedPwd, "$argon2id$") {
+		err := bcrypt.CompareHashAndPassword([]byte(hashedPwd), []byte(plainPwd))
+		return err == nil
+	}
+
+	h, ok := parseArgon2Hash(hashedPwd)
+	if !ok {
+		return false
+	}
+	key := argon2.IDKey([]byte(plainPwd), h.salt, h.iterations, h.memory, h.parallelism, uint32(len(h.key)))
+	return subtle.ConstantTimeCompare(key, h.key) == 1
+}
+
+// PasswordAlgorithm names the algorithm that made a hash, or returns ""
+// for values no supported algorithm made, such as an empty hash.
+func PasswordAlgorithm(hashedPwd string) string {
+	if strings.HasPrefix(hashedPwd, "$argon2id$") {
+		if _, ok := parseArgon2Hash(hashedPwd); ok {
+			return PasswordArgon2id
+		}
+		return ""
+	}
+	if _, err := bcrypt.Cost([]byte(hashedPwd)); err == nil {
+		return PasswordBcrypt
+	}
+	return ""
+}
+
+// PasswordNeedsRehash reports whether a hash was made with another algorithm
+// or other parameters than the configured ones. Unrecognized hashes are left
+// alone.
+func PasswordNeedsRehash(hashedPwd string) bool {
+	p := currentPasswordParams()
+
+	if strings.HasPrefix(hashedPwd, "$argon2id$") {
+		h, ok := parseArgon2Hash(hashedPwd)
+		if !ok {
+			return false
+		}
+		return p.Algorithm != PasswordArgon2id ||
+			h.version != argon2.Version ||
+			h.memory != p.Argon2Memory ||
+			h.iterations != p.Argon2Iterations ||
+			h.parallelism != p.Argon2Parallelism ||
+			len(h.key) != argon2KeyLength
+	}
+
+	cost, err := bcrypt.Cost([]byte(hashedPwd))
+	if err != nil {
+		return false
+	}
+	return p.Algorithm != PasswordBcrypt || cost != p.BcryptCost
+}
+
+type argon2Hash struct {
+	version     int
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func parseArgon2Hash(encoded string) (*argon2Hash, bool) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != PasswordArgon2id {
+		return nil, false
+	}
+
+	var h argon2Hash
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &h.version); err != nil {
+		return nil, false
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.iterations, &h.parallelism); err != nil {
+		return nil, false
+	}
+	if h.iterations == 0 || h.parallelism == 0 {
+		return nil, false
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, false
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil || len(h.key) == 0 {
+		return nil, false
+	}
+	return &h, true
 }
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func usePasswordParams(t *testing.T, p PasswordParams) {
+	t.Helper()
+	old := currentPasswordParams()
+	t.Cleanup(func() { _ = SetPasswordParams(old) })
+	if err := SetPasswordParams(p); err != nil {
+		t.Fatalf("SetPasswordParams failed: %v", err)
+	}
+}
+
+func TestArgon2idHashRoundTrip(t *testing.T) {
+	usePasswordParams(t, PasswordParams{Algorithm: PasswordArgon2id, Argon2Memory: 64, Argon2Iterations: 1, Argon2Parallelism: 1})
+
+	hash, err := HashPassword("password-1")
+	if err != nil {
+		t.Fatalf("HashPassword failed: %v", err)
+	}
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("expected a versioned argon2id hash, got %q", hash)
+	}
+	if !ComparePassword(hash, "password-1") || ComparePassword(hash, "password-2") {
+		t.Fatalf("expected only the right password to match")
+	}
+	if other, _ := HashPassword("password-1"); other == hash {
+		t.Fatalf("expected a random salt per hash")
+	}
+	if PasswordNeedsRehash(hash) {
+		t.Fatalf("expected a current hash to be kept")
+	}
+
+	for _, broken := range []string{"$argon2id$v=19$m=64,t=1,p=1$", "$argon2id$v=19$m=64,t=0,p=1$c2FsdA$a2V5", "$argon2id$junk"} {
+		if ComparePassword(broken, "password-1") || PasswordNeedsRehash(broken) {
+			t.Fatalf("expected %q to be rejected and left alone", broken)
+		}
+	}
+}
+
+func TestPasswordNeedsRehashOnOutdatedSettings(t *testing.T) {
+	legacy, _ := bcrypt.GenerateFromPassword([]byte("password-1"), bcrypt.MinCost)
+
+	usePasswordParams(t, PasswordParams{Algorithm: PasswordArgon2id, Argon2Memory: 64, Argon2Iterations: 1, Argon2Parallelism: 1})
+	if !ComparePassword(string(legacy), "password-1") {
+		t.Fatalf("expected bcrypt hashes to keep working")
+	}
+	if !PasswordNeedsRehash(string(legacy)) {
+		t.Fatalf("expected a bcrypt hash to need a rehash")
+	}
+	old, _ := HashPassword("password-1")
+
+	usePasswordParams(t, PasswordParams{Algorithm: PasswordArgon2id, Argon2Memory: 128, Argon2Iterations: 1, Argon2Parallelism: 1})
+	if !PasswordNeedsRehash(old) || !ComparePassword(old, "password-1") {
+		t.Fatalf("expected a hash with old parameters to verify and need a rehash")
+	}
+
+	usePasswordParams(t, PasswordParams{Algorithm: PasswordBcrypt, BcryptCost: bcrypt.MinCost})
+	if PasswordNeedsRehash(string(legacy)) || !PasswordNeedsRehash(old) {
+		t.Fatalf("expected the configured algorithm to decide")
+	}
+}
+
+func TestSetPasswordParamsRejectsInvalidSettings(t *testing.T) {
+	for _, p := range []PasswordParams{
+		{Algorithm: "md5"},
+		{Algorithm: PasswordBcrypt, BcryptCost: 99},
+		{Algorithm: PasswordArgon2id, Argon2Memory: 8, Argon2Parallelism: 4},
+	} {
+		if err := SetPasswordParams(p); err == nil {
+			t.Fatalf("expected %+v to be rejected", p)
+		}
+	}
+}
+
+func TestPasswordAlgorithmNamesTheHash(t *testing.T) {
+	usePasswordParams(t, PasswordParams{Algorithm: PasswordArgon2id, Argon2Memory: 64, Argon2Iterations: 1, Argon2Parallelism: 1, BcryptCost: bcrypt.MinCost})
+
+	argon, _ := HashPassword("password-1")
+	legacy, err := HashPasswordWith(PasswordBcrypt, "password-1")
+	if err != nil || !ComparePassword(legacy, "password-1") {
+		t.Fatalf("expected a working bcrypt hash, got %q %v", legacy, err)
+	}
+	if cost, _ := bcrypt.Cost([]byte(legacy)); cost != bcrypt.MinCost {
+		t.Fatalf("expected the configured bcrypt cost, got %d", cost)
+	}
+
+	for hash, want := range map[string]string{
+		argon:            PasswordArgon2id,
+		legacy:           PasswordBcrypt,
+		"":               "",
+		"$argon2id$junk": "",
+		"plain-text":     "",
+	} {
+		if got := PasswordAlgorithm(hash); got != want {
+			t.Fatalf("PasswordAlgorithm(%q) = %q, want %q", hash, got, want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"encoding/base32"
+	"testing"
+	"time"
+)
+
+// RFC 6238 appendix B vectors (SHA1, truncated to 6 digits)
+func TestTOTPCodeMatchesRFCVectors(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, want := range cases {
+		got, err := TOTPCode(secret, time.Unix(unix, 0))
+		if err != nil {
+			t.Fatalf("TOTPCode failed: %v", err)
+		}
+		if got != want {
+			t.Fatalf("at %d expected %s, got %s", unix, want, got)
+		}
+	}
+}
+
+func TestValidateTOTPAllowsOneStepOfSkew(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret failed: %v", err)
+	}
+	now := time.Unix(1700000000, 0)
+
+	previous, _ := TOTPCode(secret, now.Add(-30*time.Second))
+	if _, ok := ValidateTOTP(secret, previous, now); !ok {
+		t.Fatalf("expected previous step to be accepted")
+	}
+
+	stale, _ := TOTPCode(secret, now.Add(-90*time.Second))
+	if _, ok := ValidateTOTP(secret, stale, now); ok {
+		t.Fatalf("expected code three steps old to be rejected")
+	}
+}
+
+func TestEncryptSecretRoundTrip(t *testing.T) {
+	key := make([]byte, 32)
+	sealed, err := EncryptSecret(key, "JBSWY3DPEHPK3PXP")
+	if err != nil {
+		t.Fatalf("EncryptSecret failed: %v", err)
+	}
+	if sealed == "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("expected ciphertext to differ from plaintext")
+	}
+
+	plain, err := DecryptSecret(key, sealed)
+	if err != nil {
+		t.Fatalf("DecryptSecret failed: %v", err)
+	}
+	if plain != "JBSWY3DPEHPK3PXP" {
+		t.Fatalf("expected round trip, got %q", plain)
+	}
+
+	other := make([]byte, 32)
+	other[0] = 1
+	if _, err := DecryptSecret(other, sealed); err == nil {
+		t.Fatalf("expected decryption with another key to fail")
+	}
+}
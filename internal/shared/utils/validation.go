@@ -1,8 +1,12 @@
 package utils
 
 import (
+	"net/url"
 	"regexp"
 	"strings"
+	"time"
+	_ "time/tzdata" // timezone validation must not depend on the host zoneinfo
+	"unicode/utf8"
 )
 
 const (
@@ -11,6 +15,19 @@ const (
 
 var emailRegex = regexp.MustCompile(`^[a-zA-Z0-9._%+\-]+@[a-zA-Z0-9.\-]+\.[a-zA-Z]{2,}$`)
 
+var handleRegex = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// Handles nobody can register, compared case-insensitively
+var reservedHandles = map[string]bool{
+	"admin":         true,
+	"administrator": true,
+	"moderator":     true,
+	"root":          true,
+	"support":       true,
+	"system":        true,
+	"deleted":       true,
+}
+
 func Required(val string) bool {
 	return strings.TrimSpace(val) != ""
 }
@@ -23,6 +40,17 @@ func ValidateEmail(email string) bool {
 	return emailRegex.MatchString(email)
 }
 
+// NormalizeEmail lowercases and trims an address for use as a lookup key.
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// ValidateHandle checks a username against the handle policy: 3-30 letters,
+// digits or underscores, and not one of the reserved names.
+func ValidateHandle(handle string) bool {
+	return handleRegex.MatchString(handle) && !reservedHandles[strings.ToLower(handle)]
+}
+
 // ValidatePassword checks password meets minimum requirements
 func ValidatePassword(password string) bool {
 	if len(password) < MinPasswordLength {
@@ -30,3 +58,39 @@ func ValidatePassword(password string) bool {
 	}
 	return true
 }
+
+// MaxLength reports whether val has at most max characters (not bytes).
+func MaxLength(val string, max int) bool {
+	return utf8.RuneCountInString(val) <= max
+}
+
+// Truncate cuts val to at most max characters (not bytes) and drops
+// invalid UTF-8, so client supplied text can be stored as is.
+func Truncate(val string, max int) string {
+	val = strings.ToValidUTF8(val, "")
+	for i := range val {
+		if max == 0 {
+			return val[:i]
+		}
+		max--
+	}
+	return val
+}
+
+// ValidateHTTPURL checks that val is an absolute http(s) URL.
+func ValidateHTTPURL(val string) bool {
+	u, err := url.Parse(val)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// ValidateTimezone checks that val is an IANA zone name such as "Europe/Berlin".
+func ValidateTimezone(val string) bool {
+	if val == "" || val == "Local" {
+		return false
+	}
+	_, err := time.LoadLocation(val)
+	return err == nil
+}
@@ -1,9 +1,17 @@
 package injector
 
 import (
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
 	"github.com/ak-repo/go-chat-system/internal/platform/database"
+	"github.com/ak-repo/go-chat-system/internal/platform/mailer"
+	"github.com/ak-repo/go-chat-system/internal/platform/oidc"
 	"github.com/ak-repo/go-chat-system/internal/repository"
 	"github.com/ak-repo/go-chat-system/internal/service"
+	"github.com/ak-repo/go-chat-system/internal/shared/jwt"
+	"github.com/ak-repo/go-chat-system/internal/shared/logger"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+	"github.com/ak-repo/go-chat-system/internal/transport/websocket"
+	"go.uber.org/zap"
 )
 
 // Container holds all dependencies  want to share across  app.
@@ -16,6 +24,14 @@ type Container struct {
 	FriendRequestRepo repository.FriendRequestRepository
 	BlockRepo         repository.BlockRepository
 	MessageRepo       repository.MessageRepository
+	SessionRepo       repository.SessionRepository
+	AuthStore         repository.AuthStore
+	VerificationRepo  repository.VerificationRepository
+	MFARepo           repository.MFARepository
+	APIKeyRepo        repository.APIKeyRepository
+	IdentityRepo      repository.IdentityRepository
+	ExportRepo        repository.ExportRepository
+	InviteRepo        repository.InviteRepository
 
 	// Service
 	UserService          service.UserService
@@ -23,6 +39,22 @@ type Container struct {
 	FriendRequestService service.FriendRequestService
 	BlockService         service.BlockService
 	MessageService       service.MessageService
+	BotService           service.BotService
+	SSOService           service.SSOService // nil unless oidc.enabled
+	ExportService        service.ExportService
+	InviteService        service.InviteService
+
+	// Realtime
+	Hub *websocket.Hub
+
+	// Background jobs, started by the router and stopped on shutdown
+	Workers []Worker
+}
+
+// Worker is a long-running background job.
+type Worker interface {
+	Run()
+	Stop()
 }
 
 // Init creates and wires dependencies.
@@ -30,6 +62,28 @@ type Container struct {
 func Init() *Container {
 	// 0) any dependecies
 	db := database.GetDB()
+	rdb := database.RedisClient
+
+	mail, err := mailer.New(config.Config.Mail)
+	if err != nil {
+		logger.L().Fatal("failed to init mailer", zap.Error(err))
+	}
+	if err := jwt.LoadKeys(config.Config.JWT.Algorithm, config.Config.JWT.KeysDir); err != nil {
+		logger.L().Fatal("failed to load jwt keys", zap.Error(err))
+	}
+	pw := config.Config.Password
+	if err := utils.SetPasswordParams(utils.PasswordParams{
+		Algorithm:         pw.Algorithm,
+		Argon2Memory:      pw.Argon2Memory,
+		Argon2Iterations:  pw.Argon2Iterations,
+		Argon2Parallelism: pw.Argon2Parallelism,
+		BcryptCost:        pw.BcryptCost,
+	}); err != nil {
+		logger.L().Fatal("invalid password hashing config", zap.Error(err))
+	}
+	if config.Config.MFA.EncryptionKey == "" {
+		logger.L().Warn("mfa.encryption_key is not set, two-factor enrollment will fail")
+	}
 
 	// 1) Create repositories (DB layer)
 	friendRepo := repository.NewFriendRepositoryImpl(db)
@@ -37,13 +91,60 @@ func Init() *Container {
 	blockRepo := repository.BlockRepositoryInit(db)
 	friendReqRepo := repository.FriendRequestRepositoryInit(db)
 	messageRepo := repository.NewMessageRepositoryImpl(db)
+	sessionRepo := repository.NewSessionRepositoryImpl(db)
+	authStore := repository.NewAuthStoreImpl(rdb)
+	friendCache := repository.NewFriendCacheImpl(rdb)
+	verificationRepo := repository.NewVerificationRepositoryImpl(db)
+	mfaRepo := repository.NewMFARepositoryImpl(db)
+	securityRepo := repository.NewSecurityEventRepositoryImpl(db)
+	apiKeyRepo := repository.NewAPIKeyRepositoryImpl(db)
+	identityRepo := repository.NewIdentityRepositoryImpl(db)
+	exportRepo := repository.NewExportRepositoryImpl(db)
+	inviteRepo := repository.NewInviteRepositoryImpl(db)
 
 	// 2) Create services (business layer)
-	friendService := service.NewFriendServiceImpl(friendRepo)
-	userService := service.NewUserServiceImpl(userRepo)
-	blockService := service.BlockServiceInit(blockRepo)
-	friendReqService := service.FriendRequestServiceInit(friendReqRepo, friendRepo, blockRepo)
-	messageService := service.NewMessageServiceImpl(messageRepo, friendRepo, blockRepo)
+	messageService := service.NewMessageServiceImpl(messageRepo, friendRepo, blockRepo, userRepo)
+	presenceService := service.NewPresenceServiceImpl(userRepo, friendRepo)
+	inviteService := service.NewInviteServiceImpl(inviteRepo, userRepo)
+
+	// 3) Realtime hub (services push to it, e.g. to drop revoked sessions)
+	hub := websocket.NewHub(messageService, presenceService)
+
+	botService := service.NewBotServiceImpl(userRepo, apiKeyRepo, hub)
+	friendService := service.NewFriendServiceImpl(friendRepo, userRepo, blockRepo, friendCache, hub)
+	blockService := service.BlockServiceInit(blockRepo, friendCache, hub)
+	friendReqService := service.FriendRequestServiceInit(friendReqRepo, friendRepo, blockRepo, userRepo, authStore, friendCache, hub)
+
+	userService := service.NewUserServiceImpl(service.UserServiceDeps{
+		UserRepo:         userRepo,
+		SessionRepo:      sessionRepo,
+		VerificationRepo: verificationRepo,
+		MFARepo:          mfaRepo,
+		FriendRepo:       friendRepo,
+		SecurityRepo:     securityRepo,
+		AuthStore:        authStore,
+		Mailer:           mail,
+		Disconnector:     hub,
+		Publisher:        hub,
+	})
+
+	var ssoService service.SSOService
+	if config.Config.OIDC.Enabled {
+		provider, err := oidc.New(config.Config.OIDC)
+		if err != nil {
+			logger.L().Fatal("failed to init oidc provider", zap.Error(err))
+		}
+		ssoService = service.NewSSOServiceImpl(userService, userRepo, identityRepo, authStore, provider)
+	}
+
+	// 4) Background jobs
+	accountPurger := service.NewAccountPurger(userRepo,
+		config.Config.Account.DeletionGracePeriod, config.Config.Account.PurgeInterval)
+	keyRotator := jwt.NewKeyRotator(config.Config.JWT.RotationInterval)
+	requestSweeper := service.NewFriendRequestSweeper(friendReqRepo, hub, config.Config.FriendRequests.SweepInterval)
+	dataExporter := service.NewDataExporter(exportRepo, userRepo, friendRepo, friendReqRepo, blockRepo, messageRepo, mail, hub,
+		config.Config.Export.Dir, config.Config.Export.Retention, config.Config.Export.PollInterval)
+	exportService := service.NewExportServiceImpl(exportRepo, dataExporter, config.Config.Export.LinkTTL, config.Config.Export.Cooldown)
 
 	return &Container{
 		FriendRepo:           friendRepo,
@@ -56,5 +157,19 @@ func Init() *Container {
 		BlockService:         blockService,
 		MessageRepo:          messageRepo,
 		MessageService:       messageService,
+		SessionRepo:          sessionRepo,
+		AuthStore:            authStore,
+		VerificationRepo:     verificationRepo,
+		MFARepo:              mfaRepo,
+		APIKeyRepo:           apiKeyRepo,
+		IdentityRepo:         identityRepo,
+		ExportRepo:           exportRepo,
+		InviteRepo:           inviteRepo,
+		BotService:           botService,
+		SSOService:           ssoService,
+		ExportService:        exportService,
+		InviteService:        inviteService,
+		Hub:                  hub,
+		Workers:              []Worker{accountPurger, keyRotator, dataExporter, requestSweeper},
 	}
 }
@@ -5,30 +5,49 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
 	"github.com/ak-repo/go-chat-system/internal/shared/jwt"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
 )
 
 type ContextKey string
 
-const UserIDKey ContextKey = "userID"
+const (
+	UserIDKey      ContextKey = "userID"
+	SessionIDKey   ContextKey = "sessionID"
+	TokenIDKey     ContextKey = "tokenID"
+	RoleKey        ContextKey = "role"
+	PermissionsKey ContextKey = "permissions"
+	APIKeyIDKey    ContextKey = "apiKeyID"
+)
+
+// RevocationChecker reports whether a session or a single access token
+// has been revoked before its natural expiry.
+type RevocationChecker interface {
+	IsRevoked(ctx context.Context, sessionID, tokenID string) (bool, error)
+}
 
-func AuthMiddleware() Middleware {
+// APIKeyVerifier looks up an active bot API key by its hash.
+type APIKeyVerifier interface {
+	Authenticate(ctx context.Context, keyHash string) (*model.APIKey, error)
+}
+
+func AuthMiddleware(revocations RevocationChecker, apiKeys APIKeyVerifier) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			var token string
 
 			// 1. Check Authorization header first
 			authHeader := r.Header.Get("Authorization")
+			if strings.HasPrefix(authHeader, "Bot ") {
+				authenticateBot(w, r, next, apiKeys, strings.TrimPrefix(authHeader, "Bot "))
+				return
+			}
 			if strings.HasPrefix(authHeader, "Bearer ") {
 				token = strings.TrimPrefix(authHeader, "Bearer ")
 			}
 
-			// 2. Fallback to query param (for WebSocket)
-			if token == "" {
-				token = r.URL.Query().Get("token")
-			}
-
-			// 3. Fallback to cookie if no bearer token
+			// 2. Fallback to cookie if no bearer token
 			if token == "" {
 				cookie, err := r.Cookie("access")
 				if err != nil {
@@ -42,16 +61,61 @@ func AuthMiddleware() Middleware {
 				token = cookie.Value
 			}
 
-			// 4. Validate token
+			// 3. Validate token
 			claims, err := jwt.ValidateToken(token)
-			if err != nil {
+			if err != nil || claims.SessionID == "" {
 				http.Error(w, "invalid token", http.StatusUnauthorized)
 				return
 			}
 
-			// 5. Inject user ID into request context
+			// 4. Reject tokens of logged out sessions (fail closed)
+			revoked, err := revocations.IsRevoked(r.Context(), claims.SessionID, claims.ID)
+			if err != nil {
+				http.Error(w, "authentication unavailable", http.StatusServiceUnavailable)
+				return
+			}
+			if revoked {
+				http.Error(w, "token revoked", http.StatusUnauthorized)
+				return
+			}
+
+			// 5. Inject user, session and role into request context
 			ctx := context.WithValue(r.Context(), UserIDKey, claims.UserID)
+			ctx = context.WithValue(ctx, SessionIDKey, claims.SessionID)
+			ctx = context.WithValue(ctx, TokenIDKey, claims.ID)
+			ctx = context.WithValue(ctx, RoleKey, claims.Role)
+			ctx = context.WithValue(ctx, PermissionsKey, model.PermissionsFor(claims.Role))
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
+
+// authenticateBot serves a request made with a bot API key. Bots have no
+// session; their permissions are the scopes of the key.
+func authenticateBot(w http.ResponseWriter, r *http.Request, next http.Handler, apiKeys APIKeyVerifier, key string) {
+	if apiKeys == nil || key == "" {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	apiKey, err := apiKeys.Authenticate(r.Context(), utils.HashToken(key))
+	if err != nil {
+		http.Error(w, "authentication unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if apiKey == nil {
+		http.Error(w, "invalid api key", http.StatusUnauthorized)
+		return
+	}
+
+	perms := make([]model.Permission, 0, len(apiKey.Scopes))
+	for _, scope := range apiKey.Scopes {
+		perms = append(perms, model.Permission(scope))
+	}
+
+	ctx := context.WithValue(r.Context(), UserIDKey, apiKey.BotID)
+	ctx = context.WithValue(ctx, APIKeyIDKey, apiKey.ID)
+	ctx = context.WithValue(ctx, RoleKey, string(model.RoleBot))
+	ctx = context.WithValue(ctx, PermissionsKey, perms)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+	"github.com/ak-repo/go-chat-system/internal/shared/jwt"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+)
+
+type fakeRevocations struct {
+	revoked bool
+	err     error
+}
+
+func (f fakeRevocations) IsRevoked(context.Context, string, string) (bool, error) {
+	return f.revoked, f.err
+}
+
+func TestAuthMiddlewareRejectsRevokedSession(t *testing.T) {
+	oldConfig := config.Config
+	t.Cleanup(func() { config.Config = oldConfig })
+	config.Config.JWT = config.JWTConfig{Secret: "test-secret", Expiry: time.Hour, Issuer: "system"}
+
+	token, _, err := jwt.GenerateToken("user-1", "a@example.com", "user", "session-1")
+	if err != nil {
+		t.Fatalf("GenerateToken failed: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		revoked bool
+		want    int
+	}{
+		{name: "active session", revoked: false, want: http.StatusOK},
+		{name: "revoked session", revoked: true, want: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotSession string
+			handler := AuthMiddleware(fakeRevocations{revoked: tt.revoked}, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotSession, _ = r.Context().Value(SessionIDKey).(string)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/friends", nil)
+			req.Header.Set("Authorization", "Bearer "+token)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusOK && gotSession != "session-1" {
+				t.Fatalf("expected session-1 in context, got %q", gotSession)
+			}
+		})
+	}
+}
+
+func TestAuthMiddlewareIgnoresQueryToken(t *testing.T) {
+	oldConfig := config.Config
+	t.Cleanup(func() { config.Config = oldConfig })
+	config.Config.JWT = config.JWTConfig{Secret: "test-secret", Expiry: time.Hour, Issuer: "system"}
+
+	token, _, err := jwt.GenerateToken("user-1", "a@example.com", "user", "session-1")
+	if err != nil {
+		t.Fatalf("GenerateToken failed: %v", err)
+	}
+
+	handler := AuthMiddleware(fakeRevocations{}, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/friends?token="+token, nil))
+
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, want %d", rec.Code, http.StatusUnauthorized)
+	}
+}
+
+type fakeAPIKeys map[string]*model.APIKey
+
+func (f fakeAPIKeys) Authenticate(_ context.Context, keyHash string) (*model.APIKey, error) {
+	return f[keyHash], nil
+}
+
+func TestAuthMiddlewareAcceptsBotKeys(t *testing.T) {
+	keys := fakeAPIKeys{utils.HashToken("bot_key"): {ID: "key-1", BotID: "bot-1", Scopes: []string{"messages:read"}}}
+
+	var gotUser, gotRole string
+	var gotPerms []model.Permission
+	handler := AuthMiddleware(fakeRevocations{}, keys)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUser, _ = r.Context().Value(UserIDKey).(string)
+		gotRole, _ = r.Context().Value(RoleKey).(string)
+		gotPerms, _ = r.Context().Value(PermissionsKey).([]model.Permission)
+	}))
+
+	for _, tt := range []struct {
+		header string
+		want   int
+	}{
+		{header: "Bot bot_key", want: http.StatusOK},
+		{header: "Bot bot_other", want: http.StatusUnauthorized},
+		{header: "Bearer bot_key", want: http.StatusUnauthorized},
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/messages", nil)
+		req.Header.Set("Authorization", tt.header)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Fatalf("%s: status = %d, want %d", tt.header, rec.Code, tt.want)
+		}
+	}
+
+	if gotUser != "bot-1" || gotRole != "bot" || len(gotPerms) != 1 || gotPerms[0] != model.PermMessagesRead {
+		t.Fatalf("expected bot-1 with its key scopes, got %q %q %v", gotUser, gotRole, gotPerms)
+	}
+
+	// Bots are kept out of routes that only allow people
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/friends", nil)
+	req.Header.Set("Authorization", "Bot bot_key")
+	rec := httptest.NewRecorder()
+	AuthMiddleware(fakeRevocations{}, keys)(RequireRole(model.RoleUser, model.RoleModerator, model.RoleAdmin)(handler)).ServeHTTP(rec, req)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected bot to be forbidden, got %d", rec.Code)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"strings"
 	"time"
 
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
 	"github.com/ak-repo/go-chat-system/internal/platform/database"
 	"github.com/google/uuid"
 	"github.com/redis/go-redis/v9"
@@ -64,18 +65,48 @@ return 1
 
 // IP based key for public routes
 func IPKey(r *http.Request) string {
-	ip := r.Header.Get("X-Forwarded-For")
+	ip := ClientIP(r)
 	if ip == "" {
-		host, _, err := net.SplitHostPort(r.RemoteAddr)
-		if err == nil {
-			ip = host
+		return ""
+	}
+	return "rate:ip:" + ip
+}
+
+// maxIPLength is the longest textual IPv6 address.
+const maxIPLength = 45
+
+// ClientIP returns the caller's address. X-Forwarded-For is only read when
+// server.trusted_proxy_hops says proxies set it, and then only the entry the
+// outermost trusted proxy appended; entries left of it are client supplied.
+// Values that are not IP addresses fall back to the connection's address.
+func ClientIP(r *http.Request) string {
+	if hops := config.Config.Server.TrustedProxyHops; hops > 0 {
+		entries := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+		if len(entries) >= hops {
+			if ip := parseIP(entries[len(entries)-hops]); ip != "" {
+				return ip
+			}
 		}
 	}
-	ip = strings.TrimSpace(ip)
-	if ip == "" {
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return parseIP(host)
+}
+
+// parseIP returns s in canonical form, or "" if it is not an IP address.
+func parseIP(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) > maxIPLength {
 		return ""
 	}
-	return "rate:ip:" + ip
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
 }
 
 // For private apis
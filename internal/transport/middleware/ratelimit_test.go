@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ak-repo/go-chat-system/internal/platform/config"
+)
+
+func TestClientIPOnlyTrustsConfiguredProxyHops(t *testing.T) {
+	oldConfig := config.Config
+	t.Cleanup(func() { config.Config = oldConfig })
+
+	for _, tt := range []struct {
+		hops      int
+		forwarded []string
+		want      string
+	}{
+		// Without proxies the header is the client's word
+		{hops: 0, forwarded: []string{"203.0.113.9"}, want: "192.0.2.1"},
+		// The entry the proxy appended, not what the client sent before it
+		{hops: 1, forwarded: []string{"203.0.113.9, 198.51.100.7"}, want: "198.51.100.7"},
+		{hops: 1, forwarded: []string{"203.0.113.9", "198.51.100.7"}, want: "198.51.100.7"},
+		{hops: 2, forwarded: []string{"203.0.113.9, 198.51.100.7, 10.0.0.2"}, want: "198.51.100.7"},
+		{hops: 1, forwarded: []string{" 2001:DB8::1 "}, want: "2001:db8::1"},
+		// Garbage and missing entries fall back to the connection
+		{hops: 1, forwarded: []string{"victim, <script>"}, want: "192.0.2.1"},
+		{hops: 1, forwarded: []string{strings.Repeat("1", 100)}, want: "192.0.2.1"},
+		{hops: 2, forwarded: []string{"198.51.100.7"}, want: "192.0.2.1"},
+		{hops: 1, want: "192.0.2.1"},
+	} {
+		config.Config.Server.TrustedProxyHops = tt.hops
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = "192.0.2.1:1234"
+		for _, v := range tt.forwarded {
+			req.Header.Add("X-Forwarded-For", v)
+		}
+
+		if got := ClientIP(req); got != tt.want {
+			t.Errorf("hops %d, X-Forwarded-For %q: got %q, want %q", tt.hops, tt.forwarded, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
+)
+
+func TestRequireRoleAndPermission(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name    string
+		role    string
+		handler http.Handler
+		want    int
+	}{
+		{name: "no auth context", role: "", handler: RequireRole(model.RoleAdmin)(ok), want: http.StatusUnauthorized},
+		{name: "role allowed", role: "moderator", handler: RequireRole(model.RoleAdmin, model.RoleModerator)(ok), want: http.StatusOK},
+		{name: "role denied", role: "user", handler: RequireRole(model.RoleAdmin, model.RoleModerator)(ok), want: http.StatusForbidden},
+		{name: "permission allowed", role: "admin", handler: RequirePermission(model.PermUsersManageRoles)(ok), want: http.StatusOK},
+		{name: "permission denied", role: "moderator", handler: RequirePermission(model.PermUsersManageRoles)(ok), want: http.StatusForbidden},
+		{name: "unknown role has no permissions", role: "root", handler: RequirePermission(model.PermUsersRead)(ok), want: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/users/1", nil)
+			if tt.role != "" {
+				ctx := context.WithValue(req.Context(), RoleKey, tt.role)
+				ctx = context.WithValue(ctx, PermissionsKey, model.PermissionsFor(tt.role))
+				req = req.WithContext(ctx)
+			}
+			rec := httptest.NewRecorder()
+			tt.handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -1,10 +1,13 @@
 package routes
 
 import (
+	"encoding/json"
 	"net/http"
 	"time"
 
+	"github.com/ak-repo/go-chat-system/internal/domain/model"
 	"github.com/ak-repo/go-chat-system/internal/platform/database"
+	"github.com/ak-repo/go-chat-system/internal/shared/jwt"
 	"github.com/ak-repo/go-chat-system/internal/transport/injector"
 	mdware "github.com/ak-repo/go-chat-system/internal/transport/middleware"
 	"github.com/ak-repo/go-chat-system/internal/transport/websocket"
@@ -12,7 +15,10 @@ import (
 	"github.com/go-chi/chi"
 )
 
-var GlobalHub *websocket.Hub
+var (
+	GlobalHub     *websocket.Hub
+	GlobalWorkers []injector.Worker
+)
 
 func Router() chi.Router {
 	r := chi.NewRouter()
@@ -26,6 +32,11 @@ func Router() chi.Router {
 	// injector -> contains all services and repository
 	app := injector.Init()
 
+	GlobalWorkers = app.Workers
+	for _, w := range GlobalWorkers {
+		go w.Run()
+	}
+
 	// ---------------- API v1 ----------------
 	r.Route("/api/v1", func(v1 chi.Router) {
 
@@ -35,44 +46,140 @@ func Router() chi.Router {
 			auth.Post("/auth/register", wrapper.HTTPResponseWrapper(app.UserService.Register))
 			auth.Post("/auth/login", wrapper.HTTPResponseWrapper(app.UserService.Login))
 			auth.Post("/auth/refresh", wrapper.HTTPResponseWrapper(app.UserService.RefreshToken))
+			auth.Post("/auth/email/verify", wrapper.HTTPResponseWrapper(app.UserService.VerifyEmail))
+			auth.Post("/auth/email/resend", wrapper.HTTPResponseWrapper(app.UserService.ResendVerification))
+			auth.Post("/auth/password/forgot", wrapper.HTTPResponseWrapper(app.UserService.ForgotPassword))
+			auth.Post("/auth/password/reset", wrapper.HTTPResponseWrapper(app.UserService.ResetPassword))
+			auth.Post("/auth/mfa/verify", wrapper.HTTPResponseWrapper(app.UserService.VerifyMFA))
+			if app.SSOService != nil {
+				auth.Post("/auth/oidc/start", wrapper.HTTPResponseWrapper(app.SSOService.StartSSO))
+				auth.Post("/auth/oidc/callback", wrapper.HTTPResponseWrapper(app.SSOService.SSOCallback))
+			}
+
+			// Public so the sign-up form can check a handle
+			auth.Get("/users/handle-available", wrapper.HTTPResponseWrapper(app.UserService.CheckHandle))
+
+			// The time-limited link is the credential, browsers download it directly
+			auth.Get("/exports/{token}", app.ExportService.DownloadExport)
 		})
 
 		// ---------------- Protected routes ----------------
 		v1.Group(func(pr chi.Router) {
-			pr.Use(mdware.AuthMiddleware())
+			pr.Use(mdware.AuthMiddleware(app.AuthStore, app.APIKeyRepo))
 			pr.Use(mdware.RateLimitRedis(mdware.UserKey, 120, time.Minute))
 
-			// Users
-			pr.Get("/users", wrapper.HTTPResponseWrapper(app.UserService.SearchUser))
-
-			// Friends
-			pr.Get("/friends", wrapper.HTTPResponseWrapper(app.FriendService.ListFriends))
-
-			// Friend Requests
-			pr.Route("/friend-requests", func(fr chi.Router) {
-				fr.Get("/", wrapper.HTTPResponseWrapper(app.FriendRequestService.GetAllRequests))
-				fr.Post("/", wrapper.HTTPResponseWrapper(app.FriendRequestService.CreateRequest))
-				fr.Post("/accept", wrapper.HTTPResponseWrapper(app.FriendRequestService.AcceptRequest))
-				fr.Post("/cancel", wrapper.HTTPResponseWrapper(app.FriendRequestService.CancelRequest))
-				fr.Post("/reject", wrapper.HTTPResponseWrapper(app.FriendRequestService.RejectRequest))
-			})
-
-			// Blocks
-			pr.Route("/blocks", func(b chi.Router) {
-				b.Post("/", wrapper.HTTPResponseWrapper(app.BlockService.BlockUser))
-				b.Post("/unblock", wrapper.HTTPResponseWrapper(app.BlockService.UnblockUser))
+			// Messages and websocket tickets, also open to bots with the scope
+			pr.With(mdware.RequirePermission(model.PermMessagesRead)).
+				Get("/messages", wrapper.HTTPResponseWrapper(app.MessageService.GetMessages))
+			// A socket receives messages as well as sending them
+			pr.With(mdware.RequirePermission(model.PermMessagesRead, model.PermMessagesWrite)).
+				Post("/ws/ticket", wrapper.HTTPResponseWrapper(app.UserService.CreateWSTicket))
+
+			// Everything else is for people only
+			pr.Group(func(pr chi.Router) {
+				pr.Use(mdware.RequireRole(model.RoleUser, model.RoleModerator, model.RoleAdmin))
+
+				// Auth (session)
+				pr.Post("/auth/logout", wrapper.HTTPResponseWrapper(app.UserService.Logout))
+				pr.Post("/auth/logout-all", wrapper.HTTPResponseWrapper(app.UserService.LogoutAll))
+				pr.Get("/sessions", wrapper.HTTPResponseWrapper(app.UserService.ListSessions))
+				pr.Delete("/sessions/{id}", wrapper.HTTPResponseWrapper(app.UserService.RevokeSession))
+
+				// Users
+				pr.Get("/users", wrapper.HTTPResponseWrapper(app.UserService.SearchUser))
+				pr.Post("/users/me/password", wrapper.HTTPResponseWrapper(app.UserService.ChangePassword))
+				pr.Post("/users/me/mfa/enroll", wrapper.HTTPResponseWrapper(app.UserService.EnrollMFA))
+				pr.Post("/users/me/mfa/confirm", wrapper.HTTPResponseWrapper(app.UserService.ConfirmMFA))
+				pr.Post("/users/me/mfa/recovery-codes", wrapper.HTTPResponseWrapper(app.UserService.RegenerateRecoveryCodes))
+				pr.Delete("/users/me/mfa", wrapper.HTTPResponseWrapper(app.UserService.DisableMFA))
+				pr.Get("/users/me", wrapper.HTTPResponseWrapper(app.UserService.GetMe))
+				pr.Patch("/users/me", wrapper.HTTPResponseWrapper(app.UserService.UpdateMe))
+				pr.Delete("/users/me", wrapper.HTTPResponseWrapper(app.UserService.DeleteAccount))
+				pr.Post("/users/me/reauth-code", wrapper.HTTPResponseWrapper(app.UserService.SendReauthCode))
+				pr.Patch("/users/me/handle", wrapper.HTTPResponseWrapper(app.UserService.ChangeHandle))
+				pr.Get("/users/me/privacy", wrapper.HTTPResponseWrapper(app.UserService.GetPrivacy))
+				pr.Patch("/users/me/privacy", wrapper.HTTPResponseWrapper(app.UserService.UpdatePrivacy))
+				pr.Post("/users/me/export", wrapper.HTTPResponseWrapper(app.ExportService.RequestExport))
+				pr.Get("/users/me/export/{id}", wrapper.HTTPResponseWrapper(app.ExportService.GetExport))
+				pr.Get("/users/by-handle/{handle}", wrapper.HTTPResponseWrapper(app.UserService.GetByHandle))
+				pr.Get("/users/{id}", wrapper.HTTPResponseWrapper(app.UserService.GetProfile))
+
+				// Invite codes
+				pr.Route("/invites", func(inv chi.Router) {
+					inv.Get("/", wrapper.HTTPResponseWrapper(app.InviteService.ListInvites))
+					inv.Post("/", wrapper.HTTPResponseWrapper(app.InviteService.CreateInvite))
+					inv.Delete("/{id}", wrapper.HTTPResponseWrapper(app.InviteService.RevokeInvite))
+				})
+
+				// Friends
+				pr.Get("/friends", wrapper.HTTPResponseWrapper(app.FriendService.ListFriends))
+				pr.Get("/friends/mutual", wrapper.HTTPResponseWrapper(app.FriendService.MutualFriends))
+				pr.Get("/friends/suggestions", wrapper.HTTPResponseWrapper(app.FriendService.Suggestions))
+				pr.Delete("/friends/{id}", wrapper.HTTPResponseWrapper(app.FriendService.RemoveFriend))
+
+				// Friend Requests
+				pr.Route("/friend-requests", func(fr chi.Router) {
+					fr.Get("/", wrapper.HTTPResponseWrapper(app.FriendRequestService.GetAllRequests))
+					fr.Post("/", wrapper.HTTPResponseWrapper(app.FriendRequestService.CreateRequest))
+					fr.Post("/accept", wrapper.HTTPResponseWrapper(app.FriendRequestService.AcceptRequest))
+					fr.Post("/cancel", wrapper.HTTPResponseWrapper(app.FriendRequestService.CancelRequest))
+					fr.Post("/reject", wrapper.HTTPResponseWrapper(app.FriendRequestService.RejectRequest))
+				})
+
+				// Blocks
+				pr.Route("/blocks", func(b chi.Router) {
+					b.Get("/", wrapper.HTTPResponseWrapper(app.BlockService.ListBlocks))
+					b.Post("/", wrapper.HTTPResponseWrapper(app.BlockService.BlockUser))
+					b.Post("/unblock", wrapper.HTTPResponseWrapper(app.BlockService.UnblockUser))
+				})
 			})
+		})
 
-			// Messages
-			pr.Get("/messages", wrapper.HTTPResponseWrapper(app.MessageService.GetMessages))
+		// ---------------- Websocket ----------------
+		// Authenticated by a one-time ticket instead of AuthMiddleware
+		v1.Group(func(wsr chi.Router) {
+			wsr.Use(mdware.RateLimitRedis(mdware.IPKey, 30, time.Minute))
 
-			// Websocket - higher rate limit to allow frequent connections
-			GlobalHub = websocket.NewHub(app.MessageService)
+			GlobalHub = app.Hub
 			go GlobalHub.Run()
 
-			wsHandler := wrapper.NewWebsocketHandler(GlobalHub)
-			pr.Get("/ws", wsHandler.Handler)
+			wsHandler := wrapper.NewWebsocketHandler(GlobalHub, app.AuthStore)
+			wsr.Get("/ws", wsHandler.Handler)
 		})
+
+		// ---------------- Admin ----------------
+		v1.Route("/admin", func(admin chi.Router) {
+			admin.Use(mdware.AuthMiddleware(app.AuthStore, app.APIKeyRepo))
+			admin.Use(mdware.RequireRole(model.RoleAdmin, model.RoleModerator))
+			admin.Use(mdware.RateLimitRedis(mdware.UserKey, 120, time.Minute))
+
+			admin.With(mdware.RequirePermission(model.PermUsersRead)).
+				Get("/users/{id}", wrapper.HTTPResponseWrapper(app.UserService.AdminGetUser))
+			admin.With(mdware.RequirePermission(model.PermUsersManageRoles)).
+				Put("/users/{id}/role", wrapper.HTTPResponseWrapper(app.UserService.AdminSetRole))
+
+			admin.Route("/bots", func(bots chi.Router) {
+				bots.Use(mdware.RequirePermission(model.PermBotsManage))
+				bots.Post("/", wrapper.HTTPResponseWrapper(app.BotService.CreateBot))
+				bots.Get("/{id}/keys", wrapper.HTTPResponseWrapper(app.BotService.ListKeys))
+				bots.Post("/{id}/keys", wrapper.HTTPResponseWrapper(app.BotService.CreateKey))
+				bots.Delete("/{id}/keys/{keyID}", wrapper.HTTPResponseWrapper(app.BotService.RevokeKey))
+			})
+
+			admin.Route("/invites", func(inv chi.Router) {
+				inv.Use(mdware.RequirePermission(model.PermInvitesManage))
+				inv.Get("/", wrapper.HTTPResponseWrapper(app.InviteService.AdminListInvites))
+				inv.Post("/", wrapper.HTTPResponseWrapper(app.InviteService.AdminCreateInvite))
+				inv.Delete("/{id}", wrapper.HTTPResponseWrapper(app.InviteService.AdminRevokeInvite))
+			})
+		})
+	})
+
+	// Public verification keys for services that check our tokens themselves
+	r.Get("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(jwt.PublicKeys())
 	})
 
 	// ---------------- Health checks ----------------
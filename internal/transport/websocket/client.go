@@ -19,6 +19,7 @@ const (
 
 type Client struct {
 	userID      string
+	sessionID   string
 	conn        *websocket.Conn
 	send        chan *WSMessage
 	hub         *Hub
@@ -55,12 +56,13 @@ func (r *RateLimiter) Allow() bool {
 	return true
 }
 
-func NewClient(hub *Hub, conn *websocket.Conn, userID string) *Client {
+func NewClient(hub *Hub, conn *websocket.Conn, userID, sessionID string) *Client {
 	return &Client{
 		hub:         hub,
 		conn:        conn,
 		send:        make(chan *WSMessage, 256),
 		userID:      userID,
+		sessionID:   sessionID,
 		rateLimiter: NewRateLimiter(),
 	}
 }
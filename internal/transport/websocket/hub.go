@@ -10,30 +10,52 @@ import (
 	"github.com/ak-repo/go-chat-system/internal/service"
 )
 
+// presenceQueueSize bounds the presence changes waiting for their audience
+// to be resolved; beyond it changes are dropped rather than stall the hub.
+const presenceQueueSize = 256
+
+// presenceChange is a user coming online or going offline.
+type presenceChange struct {
+	userID string
+	event  string
+}
+
 type Hub struct {
 	clients        map[string]map[*Client]bool
 	rooms          map[string]*Room
 	register       chan *Client
 	unregister     chan *Client
 	incoming       chan *WSMessage
+	disconnect     chan []string
+	events         chan []*WSMessage
+	broadcast      chan *WSMessage
+	presenceQueue  chan presenceChange
 	messageService service.MessageService
+	presence       service.PresenceService
 	// Graceful shutdown support
 	quit chan struct{}
 }
 
-func NewHub(msgService service.MessageService) *Hub {
+func NewHub(msgService service.MessageService, presence service.PresenceService) *Hub {
 	return &Hub{
 		clients:        make(map[string]map[*Client]bool),
 		rooms:          make(map[string]*Room),
 		register:       make(chan *Client),
 		unregister:     make(chan *Client),
 		incoming:       make(chan *WSMessage),
+		disconnect:     make(chan []string),
+		events:         make(chan []*WSMessage),
+		broadcast:      make(chan *WSMessage),
+		presenceQueue:  make(chan presenceChange, presenceQueueSize),
 		messageService: msgService,
+		presence:       presence,
 		quit:           make(chan struct{}),
 	}
 }
 
 func (h *Hub) Run() {
+	go h.runPresence()
+
 	for {
 		select {
 		case <-h.quit:
@@ -56,15 +78,18 @@ func (h *Hub) Run() {
 			h.broadcastPresence(c.userID, "user_online")
 
 		case c := <-h.unregister:
-			userID := c.userID
-			if conns, ok := h.clients[userID]; ok {
-				delete(conns, c)
-				if len(conns) == 0 {
-					delete(h.clients, userID)
-					h.broadcastPresence(userID, "user_offline")
-				}
+			h.removeClient(c)
+
+		case sessionIDs := <-h.disconnect:
+			h.disconnectSessions(sessionIDs)
+
+		case msgs := <-h.events:
+			for _, msg := range msgs {
+				h.sendToUser(msg)
 			}
-			close(c.send)
+
+		case msg := <-h.broadcast:
+			h.broadcastToAll(*msg)
 
 		case msg := <-h.incoming:
 			h.routeMessage(msg)
@@ -72,6 +97,82 @@ func (h *Hub) Run() {
 	}
 }
 
+// removeClient drops c from the hub and closes its send channel once.
+// Clients already dropped (slow consumers, revoked sessions) are ignored.
+func (h *Hub) removeClient(c *Client) {
+	conns, ok := h.clients[c.userID]
+	if !ok {
+		return
+	}
+	if _, ok := conns[c]; !ok {
+		return
+	}
+
+	delete(conns, c)
+	close(c.send)
+	if len(conns) == 0 {
+		delete(h.clients, c.userID)
+		h.broadcastPresence(c.userID, "user_offline")
+	}
+}
+
+// DisconnectSessions closes every live connection opened by one of the
+// given sessions. Closing send makes WritePump send a close frame.
+func (h *Hub) DisconnectSessions(sessionIDs ...string) {
+	if len(sessionIDs) == 0 {
+		return
+	}
+	select {
+	case h.disconnect <- sessionIDs:
+	case <-h.quit:
+	}
+}
+
+func (h *Hub) disconnectSessions(sessionIDs []string) {
+	revoked := make(map[string]bool, len(sessionIDs))
+	for _, id := range sessionIDs {
+		revoked[id] = true
+	}
+
+	for _, conns := range h.clients {
+		for c := range conns {
+			if revoked[c.sessionID] {
+				h.removeClient(c)
+			}
+		}
+	}
+}
+
+// Publish delivers a server event to every live connection of the given
+// users. It must not be called from the hub goroutine itself.
+func (h *Hub) Publish(event, senderID string, payload any, userIDs ...string) {
+	if len(userIDs) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		log.Printf("failed to marshal %s event: %v", event, err)
+		return
+	}
+
+	msgs := make([]*WSMessage, 0, len(userIDs))
+	for _, id := range userIDs {
+		msgs = append(msgs, &WSMessage{
+			Event:        event,
+			SenderID:     senderID,
+			ReceiverID:   id,
+			ReceiverType: ReceiverUser,
+			Data:         data,
+		})
+	}
+
+	select {
+	case h.events <- msgs:
+	case <-h.quit:
+	}
+}
+
 // Stop gracefully shuts down the hub
 func (h *Hub) Stop() {
 	close(h.quit)
@@ -82,12 +183,81 @@ func (h *Hub) Register(client *Client) {
 	h.register <- client
 }
 
+// broadcastPresence tells the users allowed by userID's presence setting
+// that userID came online or went offline. Without a presence service
+// everyone is told. The audience comes from the database, so it is
+// resolved by runPresence and not on the hub goroutine.
 func (h *Hub) broadcastPresence(userID, event string) {
+	if h.presence == nil {
+		h.broadcastToAll(WSMessage{Event: event, SenderID: userID})
+		return
+	}
+
+	select {
+	case h.presenceQueue <- presenceChange{userID: userID, event: event}:
+	default:
+		log.Printf("presence queue full, dropping %s of %s", event, userID)
+	}
+}
+
+// runPresence resolves queued presence changes one at a time, so a user's
+// changes keep their order, and hands the messages back to the hub.
+func (h *Hub) runPresence() {
+	for {
+		select {
+		case <-h.quit:
+			return
+		case change := <-h.presenceQueue:
+			h.resolvePresence(change)
+		}
+	}
+}
+
+func (h *Hub) resolvePresence(change presenceChange) {
 	msg := WSMessage{
-		Event:    event,
-		SenderID: userID,
+		Event:    change.event,
+		SenderID: change.userID,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	if change.event == "user_offline" {
+		if err := h.presence.MarkOffline(ctx, change.userID); err != nil {
+			log.Printf("failed to record last seen: %v", err)
+		}
+		msg.Data, _ = json.Marshal(map[string]string{
+			"last_seen_at": time.Now().UTC().Format(time.RFC3339Nano),
+		})
+	}
+
+	everyone, userIDs, err := h.presence.PresenceAudience(ctx, change.userID)
+	if err != nil {
+		log.Printf("failed to load presence audience: %v", err)
+		return
+	}
+	if everyone {
+		select {
+		case h.broadcast <- &msg:
+		case <-h.quit:
+		}
+		return
+	}
+	if len(userIDs) == 0 {
+		return
+	}
+
+	msgs := make([]*WSMessage, 0, len(userIDs))
+	for _, id := range userIDs {
+		m := msg
+		m.ReceiverID = id
+		m.ReceiverType = ReceiverUser
+		msgs = append(msgs, &m)
+	}
+	select {
+	case h.events <- msgs:
+	case <-h.quit:
 	}
-	h.broadcastToAll(msg)
 }
 
 func (h *Hub) broadcastToAll(msg WSMessage) {
@@ -29,6 +29,21 @@ func (f fakeHubMessageService) GetMessages(http.ResponseWriter, *http.Request) (
 	return http.StatusOK, nil, nil
 }
 
+type fakePresenceService struct {
+	everyone bool
+	userIDs  []string
+	offline  []string
+}
+
+func (f *fakePresenceService) PresenceAudience(context.Context, string) (bool, []string, error) {
+	return f.everyone, f.userIDs, nil
+}
+
+func (f *fakePresenceService) MarkOffline(_ context.Context, userID string) error {
+	f.offline = append(f.offline, userID)
+	return nil
+}
+
 func TestExtractMessageTextSupportsTextAndContent(t *testing.T) {
 	tests := []struct {
 		name string
@@ -67,7 +82,7 @@ func TestRouteMessageDeliversPersistedMessage(t *testing.T) {
 		ReceiverID: "receiver-1",
 		Body:       "hello",
 		CreatedAt:  time.Date(2026, 8, 9, 12, 0, 0, 0, time.UTC),
-	}})
+	}}, nil)
 	receiver := &Client{userID: "receiver-1", send: make(chan *WSMessage, 1)}
 	sender := &Client{userID: "sender-1", send: make(chan *WSMessage, 1)}
 	hub.clients["receiver-1"] = map[*Client]bool{receiver: true}
@@ -111,7 +126,7 @@ func TestRouteMessageDeliversPersistedMessage(t *testing.T) {
 }
 
 func TestRouteMessageSendsErrorWhenPersistenceFails(t *testing.T) {
-	hub := NewHub(fakeHubMessageService{err: errors.New("persist failed")})
+	hub := NewHub(fakeHubMessageService{err: errors.New("persist failed")}, nil)
 	receiver := &Client{userID: "receiver-1", send: make(chan *WSMessage, 1)}
 	sender := &Client{userID: "sender-1", send: make(chan *WSMessage, 1)}
 	hub.clients["receiver-1"] = map[*Client]bool{receiver: true}
@@ -140,3 +155,90 @@ func TestRouteMessageSendsErrorWhenPersistenceFails(t *testing.T) {
 		t.Fatalf("expected sender error")
 	}
 }
+
+func TestDisconnectSessionsClosesOnlyRevokedSessions(t *testing.T) {
+	hub := NewHub(fakeHubMessageService{}, nil)
+	revoked := &Client{userID: "user-1", sessionID: "session-1", send: make(chan *WSMessage, 1)}
+	active := &Client{userID: "user-1", sessionID: "session-2", send: make(chan *WSMessage, 1)}
+	hub.clients["user-1"] = map[*Client]bool{revoked: true, active: true}
+
+	hub.disconnectSessions([]string{"session-1"})
+
+	if _, ok := <-revoked.send; ok {
+		t.Fatalf("expected revoked client send channel to be closed")
+	}
+	if !hub.clients["user-1"][active] {
+		t.Fatalf("expected other session to stay connected")
+	}
+
+	// A later unregister from ReadPump must not close the channel twice
+	hub.removeClient(revoked)
+}
+
+func TestPublishDeliversEventToEachUser(t *testing.T) {
+	hub := NewHub(fakeHubMessageService{}, nil)
+	friend := &Client{userID: "user-2", send: make(chan *WSMessage, 1)}
+	stranger := &Client{userID: "user-3", send: make(chan *WSMessage, 1)}
+	hub.clients["user-2"] = map[*Client]bool{friend: true}
+	hub.clients["user-3"] = map[*Client]bool{stranger: true}
+
+	go hub.Run()
+	defer hub.Stop()
+
+	hub.Publish("profile_updated", "user-1", map[string]string{"display_name": "Alex"}, "user-2")
+
+	select {
+	case msg := <-friend.send:
+		if msg.Event != "profile_updated" || msg.SenderID != "user-1" || string(msg.Data) != `{"display_name":"Alex"}` {
+			t.Fatalf("unexpected event %#v", msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected event to be delivered")
+	}
+
+	select {
+	case msg := <-stranger.send:
+		t.Fatalf("expected no event for user-3, got %#v", msg)
+	default:
+	}
+}
+
+func TestPresenceOnlyReachesAllowedUsers(t *testing.T) {
+	presence := &fakePresenceService{userIDs: []string{"user-2"}}
+	hub := NewHub(fakeHubMessageService{}, presence)
+	friend := &Client{userID: "user-2", send: make(chan *WSMessage, 2)}
+	stranger := &Client{userID: "user-3", send: make(chan *WSMessage, 2)}
+	hub.clients["user-2"] = map[*Client]bool{friend: true}
+	hub.clients["user-3"] = map[*Client]bool{stranger: true}
+
+	go hub.Run()
+	defer hub.Stop()
+
+	// The audience is resolved off the hub goroutine, which keeps serving
+	user := &Client{userID: "user-1", send: make(chan *WSMessage, 2)}
+	hub.Register(user)
+	for _, want := range []string{"user_online", "user_offline"} {
+		if want == "user_offline" {
+			hub.unregister <- user
+		}
+		select {
+		case msg := <-friend.send:
+			if msg.Event != want || msg.SenderID != "user-1" {
+				t.Fatalf("expected %s, got %#v", want, msg)
+			}
+			if want == "user_offline" && len(msg.Data) == 0 {
+				t.Fatalf("expected last seen time, got %#v", msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected friend to see %s of user-1", want)
+		}
+	}
+	select {
+	case msg := <-stranger.send:
+		t.Fatalf("expected no presence for user-3, got %#v", msg)
+	default:
+	}
+	if len(presence.offline) != 1 || presence.offline[0] != "user-1" {
+		t.Fatalf("expected last seen to be recorded, got %v", presence.offline)
+	}
+}
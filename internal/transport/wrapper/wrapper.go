@@ -75,6 +75,66 @@ func getUserFriendlyMessage(err error) string {
 	if errors.Is(err, errs.ErrUnauthorized) {
 		return "unauthorized"
 	}
+	if errors.Is(err, errs.ErrRefreshTokenReused) {
+		return "session revoked, please log in again"
+	}
+	if errors.Is(err, errs.ErrEmailNotVerified) {
+		return "please verify your email address first"
+	}
+	if errors.Is(err, errs.ErrInvalidCode) {
+		return "invalid or expired code"
+	}
+	if errors.Is(err, errs.ErrInvalidPassword) {
+		return "current password is incorrect"
+	}
+	if errors.Is(err, errs.ErrPasswordSet) {
+		return "confirm with your password instead"
+	}
+	if errors.Is(err, errs.ErrMFANotEnabled) {
+		return "two-factor authentication is not enabled"
+	}
+	if errors.Is(err, errs.ErrMFAAlreadyEnabled) {
+		return "two-factor authentication is already enabled"
+	}
+	if errors.Is(err, errs.ErrTooManyAttempts) {
+		return "too many failed attempts, please try again later"
+	}
+	if errors.Is(err, errs.ErrSSOFailed) {
+		return "single sign-on failed, please try again"
+	}
+	if errors.Is(err, errs.ErrSSONoAccount) {
+		return "no account is linked to this identity"
+	}
+	if errors.Is(err, errs.ErrSSOLinkRequired) {
+		return "an account with this email already exists, sign in with your password and verify your email first"
+	}
+	if errors.Is(err, errs.ErrRegistrationClosed) {
+		return "registration is closed"
+	}
+	if errors.Is(err, errs.ErrInviteRequired) {
+		return "an invite code is required to register"
+	}
+	if errors.Is(err, errs.ErrInvalidInvite) {
+		return "invite code is invalid or has expired"
+	}
+	if errors.Is(err, errs.ErrTooManyInvites) {
+		return "you have too many active invite codes, revoke one first"
+	}
+	if errors.Is(err, errs.ErrInvalidHandle) {
+		return "handle must be 3-30 letters, digits or underscores"
+	}
+	if errors.Is(err, errs.ErrHandleTaken) {
+		return "handle is already taken"
+	}
+	if errors.Is(err, errs.ErrHandleCooldown) {
+		return "handle was changed too recently"
+	}
+	if errors.Is(err, errs.ErrExportInProgress) {
+		return "a data export is already in progress"
+	}
+	if errors.Is(err, errs.ErrExportTooSoon) {
+		return "a data export was requested too recently"
+	}
 	if errors.Is(err, errs.ErrForbidden) {
 		return "forbidden"
 	}
@@ -97,6 +157,15 @@ func getUserFriendlyMessage(err error) string {
 	if errors.Is(err, errs.ErrBlockedRelationship) {
 		return "one of the users has blocked the other"
 	}
+	if errors.Is(err, errs.ErrRequestsNotAllowed) {
+		return "this user is not accepting friend requests"
+	}
+	if errors.Is(err, errs.ErrRequestCooldown) {
+		return "you cannot send this user a friend request yet"
+	}
+	if errors.Is(err, errs.ErrRequestLimit) {
+		return "you have sent too many friend requests today, please try again later"
+	}
 	if errors.Is(err, errs.ErrRequestNotFound) {
 		return "friend request not found"
 	}
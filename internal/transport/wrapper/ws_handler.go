@@ -1,12 +1,13 @@
 package wrapper
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 
 	"github.com/ak-repo/go-chat-system/internal/platform/config"
-	"github.com/ak-repo/go-chat-system/internal/transport/middleware"
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
 	ws "github.com/ak-repo/go-chat-system/internal/transport/websocket"
 
 	"github.com/gorilla/websocket"
@@ -39,22 +40,51 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// TicketStore redeems the one-time tickets issued by POST /ws/ticket.
+type TicketStore interface {
+	ConsumeWSTicket(ctx context.Context, ticketHash string) (userID, sessionID string, err error)
+	IsRevoked(ctx context.Context, sessionID, tokenID string) (bool, error)
+}
+
 type WSHandler struct {
-	hub *ws.Hub
+	hub     *ws.Hub
+	tickets TicketStore
 }
 
-func NewWebsocketHandler(hub *ws.Hub) *WSHandler {
-	return &WSHandler{hub: hub}
+func NewWebsocketHandler(hub *ws.Hub, tickets TicketStore) *WSHandler {
+	return &WSHandler{hub: hub, tickets: tickets}
 }
 
+// Handler authenticates with ?ticket= instead of the access token, since
+// browsers cannot set headers on WebSocket requests and URLs end up in logs.
 func (wh *WSHandler) Handler(w http.ResponseWriter, r *http.Request) {
-
-	uid, ok := r.Context().Value(middleware.UserIDKey).(string)
-	if !ok || uid == "" {
+	ticket := r.URL.Query().Get("ticket")
+	if ticket == "" {
 		http.Error(w, "unauthorized", http.StatusUnauthorized)
 		return
 	}
 
+	uid, sid, err := wh.tickets.ConsumeWSTicket(r.Context(), utils.HashToken(ticket))
+	if err != nil {
+		http.Error(w, "authentication unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if uid == "" {
+		http.Error(w, "invalid ticket", http.StatusUnauthorized)
+		return
+	}
+
+	// The session may have been logged out since the ticket was issued
+	revoked, err := wh.tickets.IsRevoked(r.Context(), sid, "")
+	if err != nil {
+		http.Error(w, "authentication unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	if revoked {
+		http.Error(w, "session revoked", http.StatusUnauthorized)
+		return
+	}
+
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Printf("websocket upgrade failed: %v", err)
@@ -62,7 +92,7 @@ func (wh *WSHandler) Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	client := ws.NewClient(wh.hub, conn, uid)
+	client := ws.NewClient(wh.hub, conn, uid, sid)
 	wh.hub.Register(client)
 
 	go client.WritePump()
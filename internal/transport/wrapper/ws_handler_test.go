@@ -0,0 +1,56 @@
+package wrapper
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ak-repo/go-chat-system/internal/shared/utils"
+)
+
+type fakeTicketStore struct {
+	tickets map[string]string
+	revoked bool
+}
+
+func (f *fakeTicketStore) ConsumeWSTicket(_ context.Context, ticketHash string) (string, string, error) {
+	userID, ok := f.tickets[ticketHash]
+	delete(f.tickets, ticketHash)
+	if !ok {
+		return "", "", nil
+	}
+	return userID, "session-1", nil
+}
+
+func (f *fakeTicketStore) IsRevoked(context.Context, string, string) (bool, error) {
+	return f.revoked, nil
+}
+
+func TestWSHandlerAcceptsTicketOnce(t *testing.T) {
+	store := &fakeTicketStore{tickets: map[string]string{utils.HashToken("ticket-1"): "user-1"}}
+	handler := NewWebsocketHandler(nil, store)
+
+	connect := func(query string) int {
+		rec := httptest.NewRecorder()
+		handler.Handler(rec, httptest.NewRequest(http.MethodGet, "/api/v1/ws"+query, nil))
+		return rec.Code
+	}
+
+	if status := connect("?token=access-token"); status != http.StatusUnauthorized {
+		t.Fatalf("expected access token in the URL to be ignored, got %d", status)
+	}
+	// A plain GET fails the upgrade, which shows the ticket was accepted
+	if status := connect("?ticket=ticket-1"); status != http.StatusBadRequest {
+		t.Fatalf("expected ticket to pass authentication, got %d", status)
+	}
+	if status := connect("?ticket=ticket-1"); status != http.StatusUnauthorized {
+		t.Fatalf("expected reused ticket to be rejected, got %d", status)
+	}
+
+	store.tickets[utils.HashToken("ticket-2")] = "user-1"
+	store.revoked = true
+	if status := connect("?ticket=ticket-2"); status != http.StatusUnauthorized {
+		t.Fatalf("expected ticket of a revoked session to be rejected, got %d", status)
+	}
+}
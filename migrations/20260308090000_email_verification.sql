@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+ALTER TABLE users ADD COLUMN verified_at TIMESTAMPTZ DEFAULT NULL;
+
+-- Accounts created before verification existed keep working
+UPDATE users SET verified_at = created_at WHERE verified_at IS NULL;
+
+-- Short-lived, single-use codes sent by email. Only the hash is stored.
+CREATE TABLE verification_codes (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    purpose TEXT NOT NULL,
+    code_hash TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ DEFAULT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_verification_codes_user_purpose
+ON verification_codes (user_id, purpose)
+WHERE used_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS verification_codes;
+ALTER TABLE users DROP COLUMN IF EXISTS verified_at;
+-- +goose StatementEnd
@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Set once the purge job has anonymized a soft-deleted account
+ALTER TABLE users ADD COLUMN purged_at TIMESTAMPTZ DEFAULT NULL;
+
+CREATE INDEX idx_users_pending_purge
+ON users (deleted_at)
+WHERE deleted_at IS NOT NULL AND purged_at IS NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_users_pending_purge;
+ALTER TABLE users DROP COLUMN IF EXISTS purged_at;
+-- +goose StatementEnd
@@ -0,0 +1,44 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Bring existing names in line with the handle policy ([A-Za-z0-9_]{3,30})
+UPDATE users
+SET username = left(regexp_replace(username, '[^A-Za-z0-9_]', '_', 'g'), 30)
+WHERE purged_at IS NULL AND username !~ '^[A-Za-z0-9_]{3,30}$';
+
+UPDATE users
+SET username = rpad(username, 3, '_')
+WHERE purged_at IS NULL AND length(username) < 3;
+
+-- Anonymized accounts get a name no real handle can take
+UPDATE users
+SET username = 'deleted-' || id::text
+WHERE purged_at IS NOT NULL;
+
+-- Case-insensitive duplicates: the oldest account keeps the name
+WITH ranked AS (
+    SELECT id, ROW_NUMBER() OVER (PARTITION BY lower(username) ORDER BY created_at, id) AS rn
+    FROM users
+)
+UPDATE users u
+SET username = left(u.username, 23) || '_' || left(replace(u.id::text, '-', ''), 6)
+FROM ranked r
+WHERE r.id = u.id AND r.rn > 1;
+
+CREATE UNIQUE INDEX users_username_lower_key ON users (lower(username));
+
+ALTER TABLE users ADD COLUMN username_changed_at TIMESTAMPTZ DEFAULT NULL;
+
+-- Handles given up by a rename stay reserved for their previous owner
+CREATE TABLE reserved_handles (
+    handle_lower TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    reserved_until TIMESTAMPTZ NOT NULL
+);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS reserved_handles;
+ALTER TABLE users DROP COLUMN IF EXISTS username_changed_at;
+DROP INDEX IF EXISTS users_username_lower_key;
+-- +goose StatementEnd
@@ -0,0 +1,23 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Audit trail of security relevant account events (lockouts, ...).
+-- subject is the identifier the event is about, e.g. the normalized email of
+-- a login attempt, which may not belong to any user.
+CREATE TABLE security_events (
+    id UUID PRIMARY KEY,
+    user_id UUID REFERENCES users(id) ON DELETE SET NULL,
+    event_type TEXT NOT NULL,
+    subject TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_security_events_user ON security_events (user_id, created_at DESC);
+CREATE INDEX idx_security_events_type ON security_events (event_type, created_at DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS security_events;
+-- +goose StatementEnd
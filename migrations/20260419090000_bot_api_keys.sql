@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- API keys of bot accounts (users.role = 'bot'). Keys are shown once and
+-- stored as SHA-256 hashes.
+CREATE TABLE api_keys (
+    id UUID PRIMARY KEY,
+    bot_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    name TEXT NOT NULL,
+    key_prefix TEXT NOT NULL,
+    key_hash TEXT NOT NULL UNIQUE,
+    scopes TEXT[] NOT NULL DEFAULT '{}',
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_used_at TIMESTAMPTZ DEFAULT NULL,
+    revoked_at TIMESTAMPTZ DEFAULT NULL
+);
+
+CREATE INDEX idx_api_keys_bot ON api_keys (bot_id);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS api_keys;
+-- +goose StatementEnd
@@ -0,0 +1,19 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Client details recorded when a session starts, shown in the device list.
+ALTER TABLE sessions
+    ADD COLUMN device_name TEXT NOT NULL DEFAULT '',
+    ADD COLUMN user_agent TEXT NOT NULL DEFAULT '',
+    ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_sessions_user_agent ON sessions (user_id, user_agent);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_sessions_user_agent;
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS ip,
+    DROP COLUMN IF EXISTS user_agent,
+    DROP COLUMN IF EXISTS device_name;
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Per-user privacy settings (see model.PrivacySettings) and the last time
+-- the user was connected.
+ALTER TABLE users
+    ADD COLUMN discoverability TEXT NOT NULL DEFAULT 'everyone'
+        CHECK (discoverability IN ('everyone', 'friends_of_friends', 'nobody')),
+    ADD COLUMN email_searchable BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN friend_requests_from TEXT NOT NULL DEFAULT 'everyone'
+        CHECK (friend_requests_from IN ('everyone', 'friends_of_friends', 'nobody')),
+    ADD COLUMN presence_visibility TEXT NOT NULL DEFAULT 'friends'
+        CHECK (presence_visibility IN ('everyone', 'friends', 'nobody')),
+    ADD COLUMN last_seen_at TIMESTAMPTZ DEFAULT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+    DROP COLUMN IF EXISTS last_seen_at,
+    DROP COLUMN IF EXISTS presence_visibility,
+    DROP COLUMN IF EXISTS friend_requests_from,
+    DROP COLUMN IF EXISTS email_searchable,
+    DROP COLUMN IF EXISTS discoverability;
+-- +goose StatementEnd
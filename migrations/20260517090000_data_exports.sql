@@ -0,0 +1,31 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Personal data export jobs. The worker claims pending rows and writes the
+-- archive to disk; downloads use a short-lived token stored as a hash.
+CREATE TABLE data_exports (
+    id UUID PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending'
+        CHECK (status IN ('pending', 'running', 'ready', 'failed', 'expired')),
+    file_path TEXT NOT NULL DEFAULT '',
+    size_bytes BIGINT NOT NULL DEFAULT 0,
+    download_token_hash TEXT,
+    link_expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    started_at TIMESTAMPTZ,
+    completed_at TIMESTAMPTZ,
+    expires_at TIMESTAMPTZ
+);
+
+CREATE INDEX idx_data_exports_user ON data_exports (user_id, created_at DESC);
+CREATE INDEX idx_data_exports_queue ON data_exports (created_at) WHERE status IN ('pending', 'running');
+CREATE UNIQUE INDEX idx_data_exports_token ON data_exports (download_token_hash) WHERE download_token_hash IS NOT NULL;
+
+-- At most one export per user is queued or running at a time
+CREATE UNIQUE INDEX data_exports_active_key ON data_exports (user_id) WHERE status IN ('pending', 'running');
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP TABLE IF EXISTS data_exports;
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Invite codes for sign-up. Only the hash of a code is stored; the prefix
+-- tells codes apart in lists. An empty email means anyone may redeem it.
+CREATE TABLE invite_codes (
+    id UUID PRIMARY KEY,
+    code_prefix TEXT NOT NULL,
+    code_hash TEXT NOT NULL UNIQUE,
+    created_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    email TEXT NOT NULL DEFAULT '',
+    max_uses INT NOT NULL CHECK (max_uses > 0),
+    uses INT NOT NULL DEFAULT 0,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX idx_invite_codes_created_by ON invite_codes (created_by, created_at DESC);
+
+-- Who invited whom, and with which code
+ALTER TABLE users
+    ADD COLUMN invited_by UUID REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN invite_id UUID REFERENCES invite_codes(id) ON DELETE SET NULL;
+
+CREATE INDEX idx_users_invited_by ON users (invited_by) WHERE invited_by IS NOT NULL;
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+ALTER TABLE users
+    DROP COLUMN IF EXISTS invite_id,
+    DROP COLUMN IF EXISTS invited_by;
+DROP TABLE IF EXISTS invite_codes;
+-- +goose StatementEnd
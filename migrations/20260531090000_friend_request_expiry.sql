@@ -0,0 +1,28 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Pending requests expire; existing ones get the default 30 days from when
+-- they were sent. modified_at tells when a request was answered, which the
+-- rejection cooldown is counted from.
+ALTER TABLE friend_requests
+    ADD COLUMN expires_at TIMESTAMPTZ;
+
+UPDATE friend_requests
+SET expires_at = created_at + INTERVAL '30 days'
+WHERE status = 'pending';
+
+CREATE INDEX idx_friend_requests_expiry
+ON friend_requests (expires_at)
+WHERE status = 'pending';
+
+CREATE INDEX idx_friend_requests_rejected
+ON friend_requests (sender_id, receiver_id, modified_at DESC)
+WHERE status = 'rejected';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_friend_requests_rejected;
+DROP INDEX IF EXISTS idx_friend_requests_expiry;
+ALTER TABLE friend_requests
+    DROP COLUMN IF EXISTS expires_at;
+-- +goose StatementEnd
@@ -0,0 +1,22 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Blockers may note why they blocked someone; only they ever see it. The
+-- block list pages by (created_at, blocked_id), newest first.
+ALTER TABLE blocks
+    ADD COLUMN reason TEXT NOT NULL DEFAULT '';
+
+DROP INDEX IF EXISTS idx_blocks_blocker;
+
+CREATE INDEX idx_blocks_blocker_created
+ON blocks (blocker_id, created_at DESC, blocked_id DESC);
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_blocks_blocker_created;
+
+CREATE INDEX idx_blocks_blocker ON blocks (blocker_id);
+
+ALTER TABLE blocks
+    DROP COLUMN IF EXISTS reason;
+-- +goose StatementEnd
@@ -0,0 +1,13 @@
+-- +goose Up
+-- +goose StatementBegin
+-- Friend suggestions skip users with a pending request either way; look the
+-- pairs up directly instead of scanning all requests of the receiver.
+CREATE INDEX idx_friend_requests_pending_pair
+ON friend_requests (sender_id, receiver_id)
+WHERE status = 'pending';
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+DROP INDEX IF EXISTS idx_friend_requests_pending_pair;
+-- +goose StatementEnd
@@ -2,6 +2,7 @@
 -- Seed: demo users + friendship
 -- ----------------------------------------------------------------------------
 -- Creates two demo users (alice, bob) and a mutual friendship between them.
+-- Both users are created with a verified email address.
 --
 -- Credentials (both users):
 --   email:    alice@example.com / bob@example.com
@@ -20,10 +21,10 @@
 --   make seed
 -- ============================================================================
 
-INSERT INTO users (id, username, email, password_hash, role)
+INSERT INTO users (id, username, email, password_hash, role, verified_at)
 VALUES
-    ('00000000-0000-0000-0000-000000000001', 'alice', 'alice@example.com', '$2a$10$C03cCQ2P5mFrojgz0MUStOUPrrUQ0IH3I5Q/bSMMWcFkUnhfBWuhy', 'user'),
-    ('00000000-0000-0000-0000-000000000002', 'bob',   'bob@example.com',   '$2a$10$C03cCQ2P5mFrojgz0MUStOUPrrUQ0IH3I5Q/bSMMWcFkUnhfBWuhy', 'user')
+    ('00000000-0000-0000-0000-000000000001', 'alice', 'alice@example.com', '$2a$10$C03cCQ2P5mFrojgz0MUStOUPrrUQ0IH3I5Q/bSMMWcFkUnhfBWuhy', 'user', NOW()),
+    ('00000000-0000-0000-0000-000000000002', 'bob',   'bob@example.com',   '$2a$10$C03cCQ2P5mFrojgz0MUStOUPrrUQ0IH3I5Q/bSMMWcFkUnhfBWuhy', 'user', NOW())
 ON CONFLICT (email) DO NOTHING;
 
 -- Mutual friendship (both directions), resolved by email so it also works when
@@ -1,4 +1,7 @@
+import axios from 'axios';
 import apiClient, {
+  BASE_URL,
+  getToken,
   setToken,
   setRefreshToken,
   clearTokens,
@@ -95,8 +98,17 @@ export async function refreshToken(
   return apiResponse;
 }
 
-// Logout - clear tokens
+// Logout - revoke the session server-side, then clear tokens.
+// Plain axios so a 401 here never triggers the refresh interceptor.
 export function logout(): void {
+  const token = getToken();
+  if (token) {
+    axios
+      .post(`${BASE_URL}/auth/logout`, null, {
+        headers: { Authorization: `Bearer ${token}` },
+      })
+      .catch(() => undefined);
+  }
   clearTokens();
 }
 
@@ -16,4 +16,4 @@ export * from './messages';
 
 // WebSocket
 export { default as wsClient } from './websocket';
-export type { WSEventType, WSMessage, ChatMessage, TypingData, ReadData, AckData } from './websocket';
\ No newline at end of file
+export type { WSEventType, WSMessage, ChatMessage, TypingData, ReadData, AckData, ProfileUpdatedData } from './websocket';
\ No newline at end of file
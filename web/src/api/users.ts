@@ -21,3 +21,73 @@ export async function searchUsers(
   );
   return toApiResponse(response.data);
 }
+
+// Public profile
+export interface Profile {
+  id: string;
+  username: string;
+  display_name: string;
+  bio: string;
+  avatar_url: string;
+  status_text: string;
+  status_emoji: string;
+  timezone: string;
+}
+
+export interface Me extends Profile {
+  email: string;
+  role: string;
+  email_verified: boolean;
+}
+
+export type ProfileUpdate = Partial<
+  Pick<Profile, 'display_name' | 'bio' | 'avatar_url' | 'status_text' | 'status_emoji' | 'timezone'>
+>;
+
+// Get own account and profile
+export async function getMe(): Promise<ApiResponse<{ user: Me }>> {
+  const response = await apiClient.get<ApiResponse<{ user: Me }>>('/users/me');
+  return toApiResponse(response.data);
+}
+
+// Update only the given profile fields
+export async function updateMe(data: ProfileUpdate): Promise<ApiResponse<{ profile: Profile }>> {
+  const response = await apiClient.patch<ApiResponse<{ profile: Profile }>>('/users/me', data);
+  return toApiResponse(response.data);
+}
+
+// Get another user's public profile
+export async function getProfile(userId: string): Promise<ApiResponse<{ profile: Profile }>> {
+  const response = await apiClient.get<ApiResponse<{ profile: Profile }>>(
+    `/users/${encodeURIComponent(userId)}`
+  );
+  return toApiResponse(response.data);
+}
+
+// Look up a user by @handle (case-insensitive)
+export async function getProfileByHandle(handle: string): Promise<ApiResponse<{ profile: Profile }>> {
+  const response = await apiClient.get<ApiResponse<{ profile: Profile }>>(
+    `/users/by-handle/${encodeURIComponent(handle.replace(/^@/, ''))}`
+  );
+  return toApiResponse(response.data);
+}
+
+export interface HandleAvailability {
+  handle: string;
+  available: boolean;
+  reason?: 'invalid' | 'taken';
+}
+
+// Check whether a handle can be used (works before sign-up)
+export async function checkHandle(handle: string): Promise<ApiResponse<HandleAvailability>> {
+  const response = await apiClient.get<ApiResponse<HandleAvailability>>(
+    `/users/handle-available?handle=${encodeURIComponent(handle)}`
+  );
+  return toApiResponse(response.data);
+}
+
+// Change own handle (subject to a cooldown)
+export async function changeHandle(handle: string): Promise<ApiResponse<{ profile: Profile }>> {
+  const response = await apiClient.patch<ApiResponse<{ profile: Profile }>>('/users/me/handle', { handle });
+  return toApiResponse(response.data);
+}
@@ -1,13 +1,22 @@
-import { BASE_URL, getToken } from './client';
+import apiClient, { BASE_URL, getToken, toApiResponse } from './client';
+import type { ApiResponse } from './client';
+import type { Profile } from './users';
 
-function getWSUrl(): string {
+function getWSUrl(ticket: string): string {
   const url = new URL(`${BASE_URL}/ws`);
   url.protocol = url.protocol === 'https:' ? 'wss:' : 'ws:';
+  url.searchParams.set('ticket', ticket);
   return url.toString();
 }
 
+// One-time ticket (valid ~30s) so the access token never goes into the URL
+async function createTicket(): Promise<ApiResponse<{ ticket: string; expires_at: string }>> {
+  const response = await apiClient.post<ApiResponse<{ ticket: string; expires_at: string }>>('/ws/ticket');
+  return toApiResponse(response.data);
+}
+
 // WebSocket message types
-export type WSEventType = 'message' | 'typing' | 'read' | 'ack' | 'error';
+export type WSEventType = 'message' | 'typing' | 'read' | 'ack' | 'error' | 'profile_updated';
 
 export interface WSMessage<T = unknown> {
   event: WSEventType;
@@ -32,6 +41,9 @@ export interface ReadData {
   read_at: string;
 }
 
+// Sent by the server when a friend (or this user on another device) edits their profile
+export type ProfileUpdatedData = Profile;
+
 export interface AckData {
   message_id: string;
   status: 'sent' | 'delivered' | 'read' | 'failed';
@@ -49,15 +61,27 @@ class WSClient {
   private onStateChange: ((connected: boolean) => void) | null = null;
 
   // Connect to WebSocket
-  connect(token?: string): void {
+  async connect(): Promise<void> {
     this.shouldReconnect = true;
 
-    const authToken = token || getToken();
-    if (!authToken) {
+    if (!getToken()) {
       console.error('No auth token available for WebSocket connection');
       return;
     }
 
+    let ticket: string | undefined;
+    try {
+      ticket = (await createTicket()).data?.ticket;
+    } catch (error) {
+      console.error('Failed to get WebSocket ticket:', error);
+    }
+    if (!ticket) {
+      if (this.shouldReconnect && this.reconnectAttempts < this.maxReconnectAttempts) {
+        this.scheduleReconnect();
+      }
+      return;
+    }
+
     // Close existing connection before creating a new one
     if (this.ws) {
       this.ws.onclose = null;
@@ -65,8 +89,7 @@ class WSClient {
       this.ws = null;
     }
 
-    const url = `${getWSUrl()}?token=${authToken}`;
-    this.ws = new WebSocket(url);
+    this.ws = new WebSocket(getWSUrl(ticket));
 
     this.ws.onopen = () => {
       console.log('WebSocket connected');
@@ -92,7 +115,7 @@ class WSClient {
       this.isConnected = false;
       this.onStateChange?.(false);
       if (this.shouldReconnect && this.reconnectAttempts < this.maxReconnectAttempts) {
-        this.scheduleReconnect(authToken);
+        this.scheduleReconnect();
       }
     };
 
@@ -103,11 +126,11 @@ class WSClient {
   }
 
   // Schedule reconnection
-  private scheduleReconnect(token: string): void {
+  private scheduleReconnect(): void {
     this.reconnectAttempts++;
     const delay = this.reconnectDelay * Math.pow(2, this.reconnectAttempts - 1);
     console.log(`Reconnecting in ${delay}ms (attempt ${this.reconnectAttempts})`);
-    setTimeout(() => this.connect(token), delay);
+    setTimeout(() => this.connect(), delay);
   }
 
   // Disconnect
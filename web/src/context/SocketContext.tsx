@@ -37,7 +37,7 @@ export function SocketProvider({ children }: { children: ReactNode }) {
     tokenRef.current = token;
     
     if (isAuthenticated && token) {
-      wsClient.connect(token);
+      wsClient.connect();
     } else {
       wsClient.disconnect();
     }
@@ -46,7 +46,7 @@ export function SocketProvider({ children }: { children: ReactNode }) {
   // Manual reconnect
   const reconnect = () => {
     if (tokenRef.current) {
-      wsClient.connect(tokenRef.current);
+      wsClient.connect();
     }
   };
 